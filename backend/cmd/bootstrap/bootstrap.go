@@ -4,9 +4,9 @@ package bootstrap
 import (
 	"fmt"
 	"gotoraft/config"
-	"gotoraft/internal/foorpc"
 	"gotoraft/internal/kvstore/store"
 	"gotoraft/internal/observer"
+	"gotoraft/internal/resp"
 	"gotoraft/internal/router"
 	"gotoraft/internal/websocket"
 	"gotoraft/pkg/logger"
@@ -18,8 +18,10 @@ type App struct {
 	config    *config.Config
 	router    *router.Router
 	wsManager *websocket.Manager
-	store     *store.Store                // kv存储
+	store     *store.Store                // kv存储，即 0 号 Raft 组
+	shards    *store.Shards               // 按哈希槽划分的所有 Raft 组
 	observer  *observer.RaftStateObserver // Raft状态观察器
+	resp      *resp.Server                // Redis 协议前端，未配置时为 nil
 }
 
 // NewApp 创建一个新的 App 实例
@@ -58,6 +60,11 @@ func (app *App) Init() error {
 		return fmt.Errorf("failed to initialize Raft: %v", err)
 	}
 
+	// 8. 启动 Redis 协议前端
+	if err := app.initRESP(); err != nil {
+		return fmt.Errorf("failed to initialize RESP server: %v", err)
+	}
+
 	return nil
 }
 
@@ -85,12 +92,8 @@ func (app *App) initLogger() error {
 
 // initStore 初始化存储
 func (app *App) initStore() error {
-	peers := []string{"node1", "node2", "node3"} // 示例节点
-	rpcClient, err := foorpc.Dial("tcp", "node1:port") // 替换为实际地址和端口
-	if err != nil {
-		return err
-	}
-	app.store = store.NewStore(peers, "node1", rpcClient)
+	app.store = store.InitStore()
+	app.shards = store.InitShards(app.store)
 	return nil
 }
 
@@ -121,7 +124,7 @@ func (app *App) initRouter() {
 	// 创建路由需要传递所有依赖组件
 	app.router = router.NewRouter(
 		app.wsManager,
-		app.store,
+		app.shards,
 		app.observer,
 	)
 
@@ -133,8 +136,22 @@ func (app *App) initRouter() {
 
 // initRaft 初始化 Raft
 func (app *App) initRaft() error {
-	// 初始化 Raft
-	app.store.raft.StartRPCServer()
+	// 初始化 Raft，没有配置加入地址时以单节点引导集群
+	cfg := app.config.Store
+	return app.shards.Open(len(cfg.JoinAddrs) == 0, cfg.NodeID)
+}
+
+// initRESP 配置了监听地址时启动 Redis 协议前端
+func (app *App) initRESP() error {
+	cfg := app.config.Store
+	if cfg.RESPBind == "" {
+		return nil
+	}
+	app.resp = resp.NewServer(app.shards, cfg.RESPPeers)
+	if err := app.resp.Listen(cfg.RESPBind); err != nil {
+		return err
+	}
+	logger.Infof("RESP 前端已启动，监听地址: %s", app.resp.Addr())
 	return nil
 }
 
@@ -147,12 +164,10 @@ func (app *App) Run() error {
 
 func (app *App) Shutdown() {
 	// 关闭顺序与初始化顺序相反
+	if app.resp != nil {
+		app.resp.Close()
+	}
 	app.observer.Stop()
-	app.store.Shutdown()
+	app.shards.Shutdown()
 	app.wsManager.Shutdown()
 }
-
-func (app *App) initObserver() {
-	app.observer = observer.NewObserver(app.store)
-	go app.observer.Start()
-}
@@ -0,0 +1,192 @@
+// Package kvtool 实现导入导出等命令行子命令，通过 HTTP API 访问运行中的节点；reencrypt 离线处理节点的数据目录
+package kvtool
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultEndpoint 节点 HTTP API 的默认地址
+const defaultEndpoint = "http://127.0.0.1:8080"
+
+// IsCommand 判断 name 是否为本包提供的子命令
+func IsCommand(name string) bool {
+	return name == "export" || name == "import" || name == "reencrypt"
+}
+
+// Run 执行子命令，args[0] 为子命令名称，返回进程退出码
+func Run(args []string) int {
+	var err error
+	switch args[0] {
+	case "export":
+		err = runExport(args[1:])
+	case "import":
+		err = runImport(args[1:])
+	case "reencrypt":
+		err = runReencrypt(args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q", args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// runExport 导出键空间到文件或标准输出
+//
+//	gotoraft export [-endpoint URL] [-prefix P] [-format jsonl|csv] [-level L] [-o FILE]
+func runExport(args []string) error {
+	fs := newFlagSet("export")
+	endpoint := fs.String("endpoint", defaultEndpoint, "node HTTP API address")
+	prefix := fs.String("prefix", "", "only export keys under this prefix")
+	format := fs.String("format", "", "jsonl or csv (default: from -o extension, else jsonl)")
+	level := fs.String("level", "", "read consistency level: stale, default or linearizable")
+	out := fs.String("o", "-", "output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	q := url.Values{}
+	q.Set("format", formatFor(*format, *out))
+	if *prefix != "" {
+		q.Set("prefix", *prefix)
+	}
+	if *level != "" {
+		q.Set("level", *level)
+	}
+	resp, err := http.Get(strings.TrimRight(*endpoint, "/") + "/api/kv/export?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// runImport 从文件或标准输入导入键，逐批次在标准错误输出进度
+//
+//	gotoraft import [-endpoint URL] [-format jsonl|csv] [-batch-size N] [-dry-run] FILE
+func runImport(args []string) error {
+	fs := newFlagSet("import")
+	endpoint := fs.String("endpoint", defaultEndpoint, "node HTTP API address")
+	format := fs.String("format", "", "jsonl or csv (default: from file extension, else jsonl)")
+	batchSize := fs.Int("batch-size", 0, "records per Raft proposal (default: server limit)")
+	dryRun := fs.Bool("dry-run", false, "only report conflicts with existing keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import [flags] FILE (- for stdin)")
+	}
+	path := fs.Arg(0)
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	q := url.Values{}
+	q.Set("format", formatFor(*format, path))
+	q.Set("progress", "true")
+	if *batchSize > 0 {
+		q.Set("batchSize", strconv.Itoa(*batchSize))
+	}
+	if *dryRun {
+		q.Set("dryRun", "true")
+	}
+	resp, err := http.Post(strings.TrimRight(*endpoint, "/")+"/api/kv/import?"+q.Encode(), "application/octet-stream", in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiError(resp)
+	}
+
+	// 响应为 NDJSON：若干行进度，最后一行为结果
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var line struct {
+			Type    string          `json:"type"`
+			Status  string          `json:"status"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			return fmt.Errorf("invalid response line: %v", err)
+		}
+		if line.Type == "progress" {
+			fmt.Fprintf(os.Stderr, "progress: %s\n", line.Data)
+			continue
+		}
+		fmt.Printf("%s\n", line.Data)
+		if line.Status != "success" {
+			return fmt.Errorf("%s", line.Message)
+		}
+		return nil
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// formatFor 未指定格式时按文件扩展名推断
+func formatFor(format, path string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return "csv"
+	}
+	return "jsonl"
+}
+
+// apiError 将非 200 响应转换为错误
+func apiError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(b, &body) == nil && body.Message != "" {
+		return fmt.Errorf("%s: %s", resp.Status, body.Message)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
+
+// newFlagSet 创建解析出错时返回错误而不是退出的 FlagSet
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
@@ -0,0 +1,54 @@
+package kvtool
+
+import (
+	"fmt"
+	"gotoraft/internal/kvstore/store"
+	"os"
+)
+
+// runReencrypt 用密钥文件中的最后一个密钥重新加密已停止节点的 Raft 日志、状态文件和快照
+// 轮换密钥时先在密钥文件末尾追加新密钥，旧数据仍可用其中的旧密钥读取；-keyfile 为空时解密为明文
+//
+//	gotoraft reencrypt -dir RAFT_DIR [-keyfile FILE] [-old-keyfile FILE]
+func runReencrypt(args []string) error {
+	fs := newFlagSet("reencrypt")
+	dir := fs.String("dir", "", "raft_dir of the stopped node")
+	keyFile := fs.String("keyfile", "", "key file to encrypt with (its last key), empty to decrypt")
+	oldKeyFile := fs.String("old-keyfile", "", "key file to decrypt existing data (default: -keyfile)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: reencrypt -dir RAFT_DIR [-keyfile FILE] [-old-keyfile FILE]")
+	}
+	if *oldKeyFile == "" {
+		*oldKeyFile = *keyFile
+	}
+
+	var from, to *store.Keyring
+	var err error
+	if *oldKeyFile != "" {
+		if from, err = store.LoadKeyring(*oldKeyFile); err != nil {
+			return err
+		}
+	}
+	if *keyFile != "" {
+		if to, err = store.LoadKeyring(*keyFile); err != nil {
+			return err
+		}
+	}
+
+	files, err := store.Reencrypt(*dir, from, to)
+	for _, f := range files {
+		fmt.Fprintln(os.Stderr, "rewrote", f)
+	}
+	if err != nil {
+		return err
+	}
+	if to == nil {
+		fmt.Printf("decrypted %d files\n", len(files))
+	} else {
+		fmt.Printf("re-encrypted %d files with key %q\n", len(files), to.ActiveKey())
+	}
+	return nil
+}
@@ -42,7 +42,7 @@ type StoreConfig struct {
 	RaftDir string `mapstructure:"raft_dir"`
 	// Raft 绑定地址
 	RaftBind string `mapstructure:"raft_bind"`
-	// 是否使用内存存储
+	// 是否使用内存存储，为 false 时 Raft 日志和状态机的状态文件保存在 RaftDir 中
 	Inmem bool `mapstructure:"inmem"`
 	// 添加以下配置
 	NodeID     string   `mapstructure:"node_id"`
@@ -52,6 +52,29 @@ type StoreConfig struct {
 		ElectionTimeout  time.Duration `mapstructure:"election_timeout"`
 		CommitTimeout    time.Duration `mapstructure:"commit_timeout"`
 	} `mapstructure:"raft_config"`
+	// Idempotency-Key 的保留时间
+	IdempotencyWindow time.Duration `mapstructure:"idempotency_window"`
+	// 批量写入最多包含的操作数
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+	// 存储大小的配额（字节），超出时触发 NOSPACE 告警并拒绝新的写入，0 表示不限
+	QuotaBytes int64 `mapstructure:"quota_bytes"`
+	// 副本一致性审计：本节点 foorpc 审计服务的监听地址、其他节点的 ID 及审计地址、Leader 后台审计的间隔
+	AuditBind     string            `mapstructure:"audit_bind"`
+	AuditPeers    map[string]string `mapstructure:"audit_peers"`
+	AuditInterval time.Duration     `mapstructure:"audit_interval"`
+	// 变更数据捕获：已应用日志写入的目录（为空时不记录）、单个文件的大小上限（字节）和保留的文件数
+	CDCDir         string `mapstructure:"cdc_dir"`
+	CDCMaxFileSize int64  `mapstructure:"cdc_max_file_size"`
+	CDCMaxFiles    int    `mapstructure:"cdc_max_files"`
+	// 多 Raft 组：每个进程中的 Raft 组数（<= 1 表示不分片）、哈希槽数，以及各节点 ID 的 HTTP 地址（用于转发到组的 Leader）
+	ShardGroups int               `mapstructure:"shard_groups"`
+	ShardSlots  int               `mapstructure:"shard_slots"`
+	HTTPPeers   map[string]string `mapstructure:"http_peers"`
+	// Redis 协议（RESP2）前端：监听地址（为空时不提供）、其他节点的 ID 及其 RESP 地址（用于转发到组的 Leader）
+	RESPBind  string            `mapstructure:"resp_bind"`
+	RESPPeers map[string]string `mapstructure:"resp_peers"`
+	// 静态加密：密钥文件的路径，为空时 Raft 日志、状态文件和快照以明文保存
+	EncryptionKeyFile string `mapstructure:"encryption_key_file"`
 }
 
 var (
@@ -109,6 +132,9 @@ func setDefaults() {
 	viper.SetDefault("store.raft_dir", "data/raft")
 	viper.SetDefault("store.raft_bind", "0.0.0.0:10000")
 	viper.SetDefault("store.inmem", true)
+	viper.SetDefault("store.node_id", "node1")
+	viper.SetDefault("store.idempotency_window", "24h")
+	viper.SetDefault("store.max_batch_size", 1000)
 }
 
 // createDefaultConfig 创建默认配置文件
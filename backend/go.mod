@@ -5,6 +5,7 @@ go 1.22
 require (
 	github.com/gin-contrib/cors v1.7.3
 	github.com/gin-gonic/gin v1.10.0
+	github.com/google/uuid v1.4.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/hashicorp/raft v1.7.2
 	github.com/spf13/viper v1.19.0
@@ -1,6 +1,7 @@
 package foorpc
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -99,7 +100,8 @@ func (s *Server) ServeConn(conn net.Conn) {
 
 	var opt Option
 	// 读取客户端发送的Option信息
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
 		log.Println("rpc server: options error: ", err)
 		return
 	}
@@ -113,7 +115,20 @@ func (s *Server) ServeConn(conn net.Conn) {
 		log.Printf("rpc server: invalid codec type %s", opt.CodecType)
 		return
 	}
-	s.serveCodec(f(conn), opt)
+	// 客户端可能紧接着发送请求，Decoder 多读入的数据（去掉 Option 之后的换行）属于之后的请求
+	buffered, _ := io.ReadAll(dec.Buffered())
+	buffered = bytes.TrimLeft(buffered, " \t\r\n")
+	s.serveCodec(f(&optionConn{Reader: io.MultiReader(bytes.NewReader(buffered), conn), Conn: conn}), opt)
+}
+
+// optionConn 先读取解析 Option 时缓冲的数据，再从连接中读取
+type optionConn struct {
+	io.Reader
+	net.Conn
+}
+
+func (c *optionConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
 }
 
 // invalidRequest is a placeholder for invalid request
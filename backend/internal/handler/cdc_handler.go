@@ -0,0 +1,95 @@
+// internal/handler/cdc_handler.go
+package handler
+
+import (
+	"encoding/json"
+	"gotoraft/internal/kvstore/store"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CDCHandler 处理变更数据捕获的读取请求
+type CDCHandler struct {
+	shards *store.Shards
+}
+
+// NewCDCHandler 创建一个新的变更数据捕获处理器
+func NewCDCHandler(shards *store.Shards) *CDCHandler {
+	return &CDCHandler{
+		shards: shards,
+	}
+}
+
+// HandleStream 处理读取变更记录的请求，每行一条与变更文件相同格式的记录
+// 查询参数：from 为起始索引（含），为空时从保留的最旧记录开始；follow 默认为 true，读完已有记录后继续推送新的记录
+// 消费者记录最后收到的 index，断开后以 from=index+1 继续；读取失败时最后一行为 {"status":"error"}
+// 每个 Raft 组有独立的日志索引和变更文件，有多个组时需要用查询参数 group 指定组，分别消费
+func (h *CDCHandler) HandleStream(c *gin.Context) {
+	group, ok := queryGroup(c, h.shards)
+	if !ok {
+		return
+	}
+	if group < 0 {
+		if h.shards.Len() > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "group is required when there are multiple raft groups",
+			})
+			return
+		}
+		group = 0
+	}
+	from, err := parseRevision(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid from: " + c.Query("from"),
+		})
+		return
+	}
+	follow := true
+	if v := c.Query("follow"); v != "" {
+		if follow, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid follow: " + v,
+			})
+			return
+		}
+	}
+
+	r, err := h.shards.Group(group).Changes(from, follow)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	defer r.Close()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	ctx := c.Request.Context()
+	for {
+		rec, err := r.Next(ctx)
+		if err == io.EOF || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			enc.Encode(gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+		if err := enc.Encode(rec); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
@@ -2,105 +2,130 @@
 package handler
 
 import (
+	"fmt"
 	"gotoraft/internal/kvstore/store"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 // ClusterHandler 处理集群管理的请求
 type ClusterHandler struct {
-	store *store.Store
+	store  *store.Store
+	shards *store.Shards
 }
 
 // NewClusterHandler 创建一个新的集群管理处理器
-func NewClusterHandler(store *store.Store) *ClusterHandler {
+func NewClusterHandler(shards *store.Shards) *ClusterHandler {
 	return &ClusterHandler{
-		store: store,
+		store:  shards.Group(0),
+		shards: shards,
 	}
 }
 
-// JoinRequest 加入集群的请求
-type JoinRequest struct {
-	NodeID   string `json:"nodeId" binding:"required"`
-	RaftAddr string `json:"raftAddr" binding:"required"`
-}
-
-// HandleJoin 处理加入集群的请求
+// HandleJoin 处理加入集群的请求，成员变更尚未实现
 func (h *ClusterHandler) HandleJoin(c *gin.Context) {
-	var req JoinRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid request: " + err.Error(),
-		})
-		return
-	}
-
-	if err := h.store.Join(req.NodeID, req.RaftAddr); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to join cluster: " + err.Error(),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Node joined the cluster successfully",
-		"data": gin.H{
-			"nodeId":   req.NodeID,
-			"raftAddr": req.RaftAddr,
-		},
+	c.JSON(http.StatusNotImplemented, gin.H{
+		"status":  "error",
+		"message": "Cluster membership changes are not supported yet",
 	})
 }
 
-// LeaveRequest 离开集群的请求
-type LeaveRequest struct {
-	NodeID string `json:"nodeId" binding:"required"`
-}
-
-// HandleLeave 处理离开集群的请求
+// HandleLeave 处理离开集群的请求，成员变更尚未实现
 func (h *ClusterHandler) HandleLeave(c *gin.Context) {
-	var req LeaveRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"status":  "error",
-			"message": "Invalid request: " + err.Error(),
-		})
-		return
-	}
+	c.JSON(http.StatusNotImplemented, gin.H{
+		"status":  "error",
+		"message": "Cluster membership changes are not supported yet",
+	})
+}
 
-	if err := h.store.Leave(req.NodeID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to leave cluster: " + err.Error(),
-		})
-		return
+// HandleClusterStatus 处理获取集群状态的请求，返回本节点上每个 Raft 组的角色、Leader、成员和拥有的哈希槽
+func (h *ClusterHandler) HandleClusterStatus(c *gin.Context) {
+	groups := h.shards.Status()
+	leading := 0
+	for _, g := range groups {
+		if g.State == "Leader" {
+			leading++
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "success",
-		"message": "Node left the cluster successfully",
+		"status": "success",
 		"data": gin.H{
-			"nodeId": req.NodeID,
+			"nodeId":  h.store.NodeID(),
+			"slots":   h.shards.NumSlots(),
+			"leading": leading,
+			"groups":  groups,
 		},
 	})
 }
 
-// HandleClusterStatus 处理获取集群状态的请求
-func (h *ClusterHandler) HandleClusterStatus(c *gin.Context) {
-	status, err := h.store.GetClusterStatus()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"status":  "error",
-			"message": "Failed to get cluster status: " + err.Error(),
-		})
+// HandleAudit 处理副本一致性审计的请求，比较各节点在修订号 revision 时的状态摘要
+// revision 为空时使用本节点当前的修订号，存在分歧时返回 409 及分歧的节点和日志范围
+// 查询参数 group 指定审计的 Raft 组，为空时审计所有组并返回各组的结果，修订号在组之间不可比较，此时不能指定 revision
+func (h *ClusterHandler) HandleAudit(c *gin.Context) {
+	var rev uint64
+	if v := c.Query("revision"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid revision: " + v,
+			})
+			return
+		}
+		rev = n
+	}
+	group, ok := queryGroup(c, h.shards)
+	if !ok {
 		return
 	}
+	groups := []int{group}
+	if group < 0 {
+		if rev != 0 && h.shards.Len() > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "revision requires group when there are multiple raft groups",
+			})
+			return
+		}
+		groups = groups[:0]
+		for i := 0; i < h.shards.Len(); i++ {
+			groups = append(groups, i)
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status": "success",
-		"data":   status,
+	reports := make([]*store.AuditReport, 0, len(groups))
+	consistent := true
+	for _, i := range groups {
+		report, err := h.shards.Group(i).Audit(c.Request.Context(), rev)
+		if err != nil {
+			msg := "Failed to audit replicas: " + err.Error()
+			if h.shards.Len() > 1 {
+				msg = fmt.Sprintf("Failed to audit replicas of raft group %d: %v", i, err)
+			}
+			c.JSON(statusFromStoreError(err), gin.H{
+				"status":  "error",
+				"message": msg,
+			})
+			return
+		}
+		report.Group = i
+		consistent = consistent && report.Consistent
+		reports = append(reports, report)
+	}
+
+	code, status := http.StatusOK, "success"
+	if !consistent {
+		code, status = http.StatusConflict, "error"
+	}
+	var data any = reports
+	if len(reports) == 1 {
+		data = reports[0]
+	}
+	c.JSON(code, gin.H{
+		"status": status,
+		"data":   data,
 	})
 }
@@ -2,7 +2,25 @@
 
 package handler
 
+import (
+	"gotoraft/config"
+	"net/http"
 
-type ConfigHandler struct {
-	
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigHandler 处理配置查询的请求
+type ConfigHandler struct{}
+
+// NewConfigHandler 创建一个新的配置处理器
+func NewConfigHandler() *ConfigHandler {
+	return &ConfigHandler{}
+}
+
+// HandleGetConfig 返回本节点启动时加载的配置
+func (h *ConfigHandler) HandleGetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   config.GetConfig(),
+	})
 }
@@ -2,25 +2,41 @@
 package handler
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/middleware"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // KVStoreHandler 处理KV存储的请求
+// 单键请求和事务按键路由到所在的 Raft 组，备份、导入导出等整库操作使用 0 号组
 type KVStoreHandler struct {
-	store *store.Store
+	store  *store.Store
+	shards *store.Shards
 }
 
 // NewKVStoreHandler 创建一个新的KV存储处理器
-func NewKVStoreHandler(store *store.Store) *KVStoreHandler {
+func NewKVStoreHandler(shards *store.Shards) *KVStoreHandler {
 	return &KVStoreHandler{
-		store: store,
+		store:  shards.Group(0),
+		shards: shards,
 	}
 }
 
+// readIndexWait 是读请求等待本节点应用到 X-Raft-Index 的最长时间
+const readIndexWait = 5 * time.Second
+
 // HandleGet 处理获取键值的请求
+// 带有同一个 Raft 组的写响应返回的 X-Raft-Index 时，先等待本节点应用到该索引，未指定 level 时可由 Follower 提供读取
+// meta=true 时同时返回键的元数据，见 keyMetadata
 func (h *KVStoreHandler) HandleGet(c *gin.Context) {
 	key := c.Param("key")
 	if key == "" {
@@ -31,33 +47,357 @@ func (h *KVStoreHandler) HandleGet(c *gin.Context) {
 		return
 	}
 
-	value, err := h.store.Get(key)
+	lvl, err := store.ParseConsistencyLevel(c.Query("level"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"message": err.Error(),
 		})
 		return
 	}
 
+	rev, err := parseRevision(c.Query("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	group, _ := keyGroup(h.shards, ks, ks.key(key))
+
+	// 凭证来自其他组的写入时与本次读取无关，忽略
+	var index uint64
+	if token := c.GetHeader(middleware.AppliedIndexHeader); token != "" {
+		tokenGroup, n, err := middleware.ParseAppliedIndex(token)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid " + middleware.AppliedIndexHeader + ": " + token,
+			})
+			return
+		}
+		if tokenGroup == group {
+			index = n
+			// 等到本节点包含凭证对应的写入后，读取本地状态即可
+			if c.Query("level") == "" {
+				lvl = store.Stale
+			}
+		}
+	}
+
+	s, ok := route(c, h.shards, group, lvl)
+	if !ok {
+		return
+	}
+	if index > 0 {
+		if err := s.WaitForIndex(index, readIndexWait); err != nil {
+			c.JSON(statusFromStoreError(err), gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	kv, err := s.GetAt(ks.key(key), rev, lvl)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"key":   key,
+		"value": kv.Value,
+	}
+	if meta, _ := strconv.ParseBool(c.Query("meta")); meta {
+		data["metadata"] = keyMetadata(s, kv)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
+		"data":   data,
+	})
+}
+
+// keyMetadata 返回键的元数据：最后一次修改该键的 Raft 日志索引和任期、创建时的日志索引、版本号、
+// Leader 追加该日志的时间，以及按本节点时钟计算的剩余存活时间（秒，向上取整，不过期时省略）
+func keyMetadata(s *store.Store, kv *store.KeyValue) gin.H {
+	meta := gin.H{
+		"modRevision":    kv.ModRevision,
+		"modTerm":        kv.ModTerm,
+		"createRevision": kv.CreateRevision,
+		"version":        kv.Version,
+		"modTime":        kv.ModTime,
+	}
+	if kv.Lease != 0 {
+		meta["lease"] = kv.Lease
+	}
+	if ttl, ok := s.RemainingTTL(kv, time.Now()); ok {
+		meta["ttl"] = int64((ttl + time.Second - 1) / time.Second)
+	}
+	return meta
+}
+
+// HandleHistory 处理获取键历史版本的请求，删除以 version 为 0 的版本表示
+func (h *KVStoreHandler) HandleHistory(c *gin.Context) {
+	key := c.Param("key")
+	lvl, err := store.ParseConsistencyLevel(c.Query("level"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, key, lvl)
+	if !ok {
+		return
+	}
+	history, err := s.History(ks.key(key), lvl)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"key":     key,
+			"history": ks.kvs(history),
+		},
+	})
+}
+
+// CompactRequest 压缩历史的请求
+type CompactRequest struct {
+	Revision uint64 `json:"revision" binding:"required"`
+}
+
+// HandleCompact 处理压缩历史版本的管理请求，早于 revision 的历史将不可读取
+func (h *KVStoreHandler) HandleCompact(c *gin.Context) {
+	var req CompactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if err := h.store.Compact(req.Revision); err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to compact: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "History compacted successfully",
 		"data": gin.H{
-			"key":   key,
-			"value": value,
+			"revision": req.Revision,
 		},
 	})
 }
 
+// routeKey 返回键所在的组，请求已转发到该组的 Leader 时返回 false
+func (h *KVStoreHandler) routeKey(c *gin.Context, ks keyspace, key string, lvl store.ConsistencyLevel) (*store.Store, bool) {
+	group, _ := keyGroup(h.shards, ks, ks.key(key))
+	return route(c, h.shards, group, lvl)
+}
+
+// routeKeys 返回事务或批量写入中所有键共同所在的组
+// 键属于不同的组时写入错误响应，使用相同的 {tag} 可以让相关的键落在同一个组
+func (h *KVStoreHandler) routeKeys(c *gin.Context, ks keyspace, keys []string) (*store.Store, bool) {
+	group, err := keyGroup(h.shards, ks, keys...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	return route(c, h.shards, group, store.Default)
+}
+
+// parseRevision 解析修订号参数，空字符串表示当前修订号
+func parseRevision(v string) (uint64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	rev, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid revision: %q", v)
+	}
+	return rev, nil
+}
+
+// 客户端会话的请求头，两者同时提供时写请求可以安全重试
+const (
+	headerClientID  = "X-Client-ID"
+	headerClientSeq = "X-Client-Seq"
+)
+
+// writeOptions 从请求头中读取命名空间、客户端 ID 和序号，以及 Idempotency 中间件计算的幂等键和摘要
+// 格式错误时写入 400 响应
+func writeOptions(c *gin.Context) ([]store.WriteOption, bool) {
+	var wopts []store.WriteOption
+	if ns := c.GetHeader(headerNamespace); ns != "" {
+		wopts = append(wopts, store.WithNamespace(ns))
+	}
+	if key := c.GetString(middleware.ContextIdempotencyKey); key != "" {
+		wopts = append(wopts, store.WithIdempotencyKey(key, c.GetString(middleware.ContextFingerprint)))
+	}
+
+	clientID := c.GetHeader(headerClientID)
+	if clientID == "" {
+		return wopts, true
+	}
+	seq, err := strconv.ParseUint(c.GetHeader(headerClientSeq), 10, 64)
+	if err != nil || seq == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": headerClientSeq + " must be a positive integer when " + headerClientID + " is set",
+		})
+		return nil, false
+	}
+	return append(wopts, store.WithClientSeq(clientID, seq)), true
+}
+
+// 范围扫描的分页大小
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+)
+
+// HandleList 处理范围和前缀扫描请求
+// 查询参数：prefix、start、end、limit、cursor、keysOnly、level
+// cursor 为上一页响应中的 nextCursor，优先于 start；翻页时传回 revision 可获得一致的视图
+// 有多个 Raft 组时合并各组的结果，本节点需要是各组的 Leader 或使用 level=stale，且不支持 revision
+func (h *KVStoreHandler) HandleList(c *gin.Context) {
+	lvl, err := store.ParseConsistencyLevel(c.Query("level"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	limit := defaultScanLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxScanLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": fmt.Sprintf("limit must be between 1 and %d", maxScanLimit),
+			})
+			return
+		}
+	}
+
+	rev, err := parseRevision(c.Query("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	opts := store.ScanOptions{
+		Prefix:   ks.key(c.Query("prefix")),
+		Start:    c.Query("start"),
+		End:      c.Query("end"),
+		Limit:    limit,
+		Revision: rev,
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		start, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid cursor",
+			})
+			return
+		}
+		opts.Start = string(start)
+	}
+	if opts.Start != "" {
+		opts.Start = ks.key(opts.Start)
+	}
+	if opts.End != "" {
+		opts.End = ks.key(opts.End)
+	}
+
+	scan := h.shards.Scan
+	if ks != "" {
+		scan = h.store.Scan
+	}
+	res, err := scan(opts, lvl)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to scan keys: " + err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"count":    len(res.KVs),
+		"more":     res.More,
+		"revision": res.Revision,
+	}
+	if res.More {
+		data["nextCursor"] = base64.RawURLEncoding.EncodeToString([]byte(ks.strip(res.Next)))
+	}
+	if keysOnly, _ := strconv.ParseBool(c.Query("keysOnly")); keysOnly {
+		keys := make([]string, 0, len(res.KVs))
+		for _, kv := range res.KVs {
+			keys = append(keys, ks.strip(kv.Key))
+		}
+		data["keys"] = keys
+	} else {
+		data["kvs"] = ks.kvs(res.KVs)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
 // HandleSet 处理设置键值的请求
 type SetRequest struct {
-	Key   string `json:"key" binding:"required"`
-	Value string `json:"value" binding:"required"`
+	Key   string  `json:"key" binding:"required"`
+	Value *string `json:"value" binding:"required"` // 可以为空字符串
+	TTL   int64   `json:"ttl" binding:"min=0"`      // 存活时间（秒），0 表示不过期
+	Lease int64   `json:"lease"`                    // 绑定的租约 ID，0 表示不绑定
 }
 
 func (h *KVStoreHandler) HandleSet(c *gin.Context) {
 	var req SetRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"status":  "error",
 			"message": "Invalid request: " + err.Error(),
@@ -65,19 +405,44 @@ func (h *KVStoreHandler) HandleSet(c *gin.Context) {
 		return
 	}
 
-	if err := h.store.Set(req.Key, req.Value); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, req.Key, store.Default)
+	if !ok || !requireGroupLease(c, h.shards, s, req.Lease) {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	kv, err := s.Put(ks.key(req.Key), *req.Value, store.PutOptions{
+		TTL:   time.Duration(req.TTL) * time.Second,
+		Lease: req.Lease,
+	}, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
 			"status":  "error",
 			"message": "Failed to set value: " + err.Error(),
 		})
 		return
 	}
 
+	// 输出存储层返回的状态而不是请求体，重试的请求得到第一次写入的结果
+	var ttl int64
+	if d, ok := s.RemainingTTL(kv, time.Now()); ok {
+		ttl = int64((d + time.Second - 1) / time.Second)
+	}
+	kv = ks.kv(kv)
 	c.JSON(http.StatusOK, gin.H{
 		"status": "success",
 		"data": gin.H{
-			"key":   req.Key,
-			"value": req.Value,
+			"key":      kv.Key,
+			"value":    kv.Value,
+			"ttl":      ttl,
+			"lease":    kv.Lease,
+			"revision": kv.ModRevision,
 		},
 	})
 }
@@ -93,19 +458,374 @@ func (h *KVStoreHandler) HandleDelete(c *gin.Context) {
 		return
 	}
 
-	if err := h.store.Delete(key); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, key, store.Default)
+	if !ok {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	prev, err := s.Delete(ks.key(key), wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
 			"status":  "error",
 			"message": "Failed to delete key: " + err.Error(),
 		})
 		return
 	}
 
+	// prevKv 为存储层返回的删除前的状态，键不存在时为 null
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Key deleted successfully",
 		"data": gin.H{
-			"key": key,
+			"key":     key,
+			"deleted": prev != nil,
+			"prevKv":  ks.kv(prev),
+		},
+	})
+}
+
+// CASRequest 条件写入的请求，prevValue 与 prevRevision 至少提供一个
+type CASRequest struct {
+	Value        *string `json:"value" binding:"required"`
+	PrevValue    *string `json:"prevValue"`
+	PrevRevision uint64  `json:"prevRevision"`
+	TTL          int64   `json:"ttl" binding:"min=0"` // 存活时间（秒），0 表示不过期
+	Lease        int64   `json:"lease"`               // 绑定的租约 ID，0 表示不绑定
+}
+
+// HandleCompareAndSwap 处理比较并交换的请求
+func (h *KVStoreHandler) HandleCompareAndSwap(c *gin.Context) {
+	key := c.Param("key")
+	var req CASRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if req.PrevValue == nil && req.PrevRevision == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: prevValue or prevRevision is required",
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, key, store.Default)
+	if !ok || !requireGroupLease(c, h.shards, s, req.Lease) {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	kv, err := s.CompareAndSwap(ks.key(key), *req.Value, store.Condition{
+		PrevValue:    req.PrevValue,
+		PrevRevision: req.PrevRevision,
+	}, store.PutOptions{TTL: time.Duration(req.TTL) * time.Second, Lease: req.Lease}, wopts...)
+	h.respondConditional(c, key, ks.kv(kv), err)
+}
+
+// SetIfAbsentRequest 键不存在时写入的请求
+type SetIfAbsentRequest struct {
+	Value *string `json:"value" binding:"required"`
+	TTL   int64   `json:"ttl" binding:"min=0"` // 存活时间（秒），0 表示不过期
+	Lease int64   `json:"lease"`               // 绑定的租约 ID，0 表示不绑定
+}
+
+// HandleSetIfAbsent 处理仅在键不存在时写入的请求
+func (h *KVStoreHandler) HandleSetIfAbsent(c *gin.Context) {
+	key := c.Param("key")
+	var req SetIfAbsentRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, key, store.Default)
+	if !ok || !requireGroupLease(c, h.shards, s, req.Lease) {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	kv, err := s.SetIfAbsent(ks.key(key), *req.Value, store.PutOptions{
+		TTL:   time.Duration(req.TTL) * time.Second,
+		Lease: req.Lease,
+	}, wopts...)
+	h.respondConditional(c, key, ks.kv(kv), err)
+}
+
+// CompareAndDeleteRequest 值匹配时删除的请求
+type CompareAndDeleteRequest struct {
+	PrevValue *string `json:"prevValue" binding:"required"`
+}
+
+// HandleCompareAndDelete 处理当前值匹配时才删除的请求
+func (h *KVStoreHandler) HandleCompareAndDelete(c *gin.Context) {
+	key := c.Param("key")
+	var req CompareAndDeleteRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, key, store.Default)
+	if !ok {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	kv, err := s.CompareAndDelete(ks.key(key), *req.PrevValue, wopts...)
+	h.respondConditional(c, key, ks.kv(kv), err)
+}
+
+// IncrRequest 自增的请求，delta 缺省为 1，可以为负数
+type IncrRequest struct {
+	Delta *int64 `json:"delta"`
+	Min   *int64 `json:"min"`                 // 结果的下界（含）
+	Max   *int64 `json:"max"`                 // 结果的上界（含）
+	TTL   int64  `json:"ttl" binding:"min=0"` // 新建计数器的存活时间（秒）
+}
+
+// HandleIncrement 处理原子自增的请求，返回新值
+func (h *KVStoreHandler) HandleIncrement(c *gin.Context) {
+	key := c.Param("key")
+	var req IncrRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	delta := int64(1)
+	if req.Delta != nil {
+		delta = *req.Delta
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	s, ok := h.routeKey(c, ks, key, store.Default)
+	if !ok {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	kv, err := s.Increment(ks.key(key), delta, store.IncrOptions{
+		Min: req.Min,
+		Max: req.Max,
+		TTL: time.Duration(req.TTL) * time.Second,
+	}, wopts...)
+	kv = ks.kv(kv)
+	if err != nil {
+		h.respondConditional(c, key, kv, err)
+		return
+	}
+
+	n, _ := strconv.ParseInt(kv.Value, 10, 64)
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"key":      key,
+			"value":    n,
+			"revision": kv.ModRevision,
+			"kv":       kv,
+		},
+	})
+}
+
+// respondConditional 输出条件操作的结果，前置条件不满足时同时返回键的当前状态
+func (h *KVStoreHandler) respondConditional(c *gin.Context, key string, kv *store.KeyValue, err error) {
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   kv,
+		})
+	case errors.Is(err, store.ErrPreconditionFailed), errors.Is(err, store.ErrKeyExists),
+		errors.Is(err, store.ErrCounterOutOfRange), errors.Is(err, store.ErrNotANumber):
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+			"data": gin.H{
+				"key":     key,
+				"current": kv,
+			},
+		})
+	default:
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+}
+
+// statusFromStoreError 将存储层错误映射为 HTTP 状态码
+func statusFromStoreError(err error) int {
+	switch {
+	case errors.Is(err, store.ErrKeyNotFound), errors.Is(err, store.ErrLeaseNotFound),
+		errors.Is(err, store.ErrNamespaceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, store.ErrPreconditionFailed), errors.Is(err, store.ErrKeyExists),
+		errors.Is(err, store.ErrStaleSequence), errors.Is(err, store.ErrIdempotencyKeyReused),
+		errors.Is(err, store.ErrCounterOutOfRange), errors.Is(err, store.ErrRestoreInProgress),
+		errors.Is(err, store.ErrNamespaceExists), errors.Is(err, store.ErrSpaceNotFreed),
+		errors.Is(err, store.ErrMigrationBusy):
+		return http.StatusConflict
+	case errors.Is(err, store.ErrNotANumber):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, store.ErrNotLeader), errors.Is(err, store.ErrSlotFrozen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, store.ErrSlotMoved):
+		// 本节点的槽路由还没有更新，客户端重试时会被路由到新的组
+		return http.StatusMisdirectedRequest
+	case errors.Is(err, store.ErrCompacted), errors.Is(err, store.ErrCDCPurged):
+		return http.StatusGone
+	case errors.Is(err, store.ErrFutureRevision), errors.Is(err, store.ErrInvalidBatch),
+		errors.Is(err, store.ErrInvalidBackup), errors.Is(err, store.ErrInvalidFormat),
+		errors.Is(err, store.ErrInvalidRecord), errors.Is(err, store.ErrInvalidNamespace),
+		errors.Is(err, store.ErrCrossGroup), errors.Is(err, store.ErrInvalidMigration):
+		return http.StatusBadRequest
+	case errors.Is(err, store.ErrBatchTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, store.ErrQuotaExceeded), errors.Is(err, store.ErrNoSpace):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, store.ErrAuditNotConfigured), errors.Is(err, store.ErrCDCDisabled):
+		return http.StatusNotImplemented
+	case errors.Is(err, store.ErrIndexTimeout):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleTxn 处理多键事务请求：所有 compare 成立时执行 success，否则执行 failure
+func (h *KVStoreHandler) HandleTxn(c *gin.Context) {
+	var txn store.Txn
+	if err := c.ShouldBindBodyWith(&txn, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+	if err := txn.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	ks.txn(&txn)
+	s, ok := h.routeKeys(c, ks, txn.Keys())
+	if !ok {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.Txn(&txn, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to run txn: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   ks.txnResult(res),
+	})
+}
+
+// BatchRequest 批量写入的请求，ops 只能是 put 或 delete
+type BatchRequest struct {
+	Ops []store.Op `json:"ops" binding:"required,min=1"`
+}
+
+// HandleBatch 处理批量写入的请求，所有操作作为一条日志原子地应用
+func (h *KVStoreHandler) HandleBatch(c *gin.Context) {
+	var req BatchRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	ks, ok := requestKeyspace(c, h.store)
+	if !ok {
+		return
+	}
+	ops := ks.ops(req.Ops)
+	keys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		keys = append(keys, op.Key)
+	}
+	s, ok := h.routeKeys(c, ks, keys)
+	if !ok {
+		return
+	}
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	res, err := s.Batch(ops, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to apply batch: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"revision": res.Revision,
+			"results":  ks.txnResult(res).Results,
 		},
 	})
 }
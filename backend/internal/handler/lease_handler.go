@@ -0,0 +1,150 @@
+// internal/handler/lease_handler.go
+package handler
+
+import (
+	"gotoraft/internal/kvstore/store"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LeaseHandler 处理租约的请求
+type LeaseHandler struct {
+	store *store.Store
+}
+
+// NewLeaseHandler 创建一个新的租约处理器
+func NewLeaseHandler(kvStore *store.Store) *LeaseHandler {
+	return &LeaseHandler{
+		store: kvStore,
+	}
+}
+
+// GrantLeaseRequest 授予租约的请求
+type GrantLeaseRequest struct {
+	TTL int64 `json:"ttl" binding:"required,min=1"` // 存活时间（秒）
+}
+
+// HandleGrant 处理授予租约的请求
+func (h *LeaseHandler) HandleGrant(c *gin.Context) {
+	var req GrantLeaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	lease, err := h.store.GrantLease(time.Duration(req.TTL)*time.Second, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to grant lease: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   lease,
+	})
+}
+
+// HandleKeepAlive 处理续期租约的请求
+func (h *LeaseHandler) HandleKeepAlive(c *gin.Context) {
+	id, ok := parseLeaseID(c)
+	if !ok {
+		return
+	}
+
+	lease, err := h.store.KeepAlive(id)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to keep lease alive: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   lease,
+	})
+}
+
+// HandleRevoke 处理撤销租约的请求，绑定的键会被全部删除
+func (h *LeaseHandler) HandleRevoke(c *gin.Context) {
+	id, ok := parseLeaseID(c)
+	if !ok {
+		return
+	}
+
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	lease, err := h.store.RevokeLease(id, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to revoke lease: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Lease revoked successfully",
+		"data":    lease,
+	})
+}
+
+// HandleGet 处理查询单个租约的请求
+func (h *LeaseHandler) HandleGet(c *gin.Context) {
+	id, ok := parseLeaseID(c)
+	if !ok {
+		return
+	}
+
+	lease, err := h.store.GetLease(id)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   lease,
+	})
+}
+
+// HandleList 处理列出所有租约的请求
+func (h *LeaseHandler) HandleList(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   h.store.Leases(),
+	})
+}
+
+// parseLeaseID 解析路径中的租约 ID，失败时写入 400 响应
+func parseLeaseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid lease id",
+		})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,314 @@
+// internal/handler/lock_handler.go
+// 分布式锁和 Leader 选举的 REST 接口，供不使用 Go 客户端的调用方使用
+package handler
+
+import (
+	"context"
+	"errors"
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/pkg/concurrency"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 锁和选举在存储中使用的前缀，Go 客户端使用相同的前缀即可与 REST 调用方互斥
+const (
+	lockPrefix     = "locks/"
+	electionPrefix = "elections/"
+)
+
+// LockHandler 处理分布式锁和选举的请求
+// 调用方先通过 /api/lease 授予并续期租约，锁和领导权在租约过期时自动释放
+type LockHandler struct {
+	kv concurrency.KV
+}
+
+// NewLockHandler 创建一个新的锁处理器
+func NewLockHandler(kvStore *store.Store) *LockHandler {
+	return &LockHandler{
+		kv: &storeKV{store: kvStore},
+	}
+}
+
+// LockRequest 加锁的请求，timeout 为 0 时只尝试一次
+type LockRequest struct {
+	Lease   int64 `json:"lease" binding:"required,min=1"`
+	Timeout int64 `json:"timeout" binding:"min=0,max=300"` // 最长等待时间（秒）
+}
+
+// HandleLock 处理加锁的请求，成功时返回 fencing token
+func (h *LockHandler) HandleLock(c *gin.Context) {
+	var req LockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	session := concurrency.ResumeSession(h.kv, req.Lease)
+	defer session.Close()
+	m := concurrency.NewMutex(session, lockPrefix+c.Param("name"))
+
+	var err error
+	if req.Timeout == 0 {
+		err = m.TryLock(c.Request.Context())
+	} else {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+		err = m.Lock(ctx)
+	}
+	if err != nil {
+		c.JSON(statusFromLockError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to acquire lock: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"key":   m.Key(),
+			"lease": req.Lease,
+			"token": m.Token(),
+		},
+	})
+}
+
+// HandleUnlock 处理解锁的请求，查询参数 lease 为加锁时使用的租约
+func (h *LockHandler) HandleUnlock(c *gin.Context) {
+	lease, err := strconv.ParseInt(c.Query("lease"), 10, 64)
+	if err != nil || lease <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid lease id",
+		})
+		return
+	}
+
+	session := concurrency.ResumeSession(h.kv, lease)
+	defer session.Close()
+	m := concurrency.NewMutex(session, lockPrefix+c.Param("name"))
+	if err := m.Unlock(c.Request.Context()); err != nil {
+		c.JSON(statusFromLockError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to release lock: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Lock released successfully",
+	})
+}
+
+// CampaignRequest 参选的请求
+type CampaignRequest struct {
+	Lease   int64  `json:"lease" binding:"required,min=1"`
+	Value   string `json:"value"`
+	Timeout int64  `json:"timeout" binding:"required,min=1,max=300"` // 最长等待时间（秒）
+}
+
+// HandleCampaign 处理参选的请求，当选后返回
+func (h *LockHandler) HandleCampaign(c *gin.Context) {
+	var req CampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	session := concurrency.ResumeSession(h.kv, req.Lease)
+	defer session.Close()
+	e := concurrency.NewElection(session, electionPrefix+c.Param("name"))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+	if err := e.Campaign(ctx, req.Value); err != nil {
+		c.JSON(statusFromLockError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to campaign: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": concurrency.LeaderInfo{
+			Key:   e.Key(),
+			Value: req.Value,
+			Lease: req.Lease,
+			Token: e.Token(),
+		},
+	})
+}
+
+// ResignRequest 放弃领导权的请求
+type ResignRequest struct {
+	Lease int64 `json:"lease" binding:"required,min=1"`
+}
+
+// HandleResign 处理放弃领导权或退出选举的请求
+func (h *LockHandler) HandleResign(c *gin.Context) {
+	var req ResignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	session := concurrency.ResumeSession(h.kv, req.Lease)
+	defer session.Close()
+	e := concurrency.NewElection(session, electionPrefix+c.Param("name"))
+	if err := e.Resign(c.Request.Context()); err != nil {
+		c.JSON(statusFromLockError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to resign: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Resigned successfully",
+	})
+}
+
+// HandleLeader 处理查询当前 Leader 的请求
+func (h *LockHandler) HandleLeader(c *gin.Context) {
+	session := concurrency.ResumeSession(h.kv, 0)
+	defer session.Close()
+	e := concurrency.NewElection(session, electionPrefix+c.Param("name"))
+
+	leader, err := e.Leader(c.Request.Context())
+	if err != nil {
+		c.JSON(statusFromLockError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   leader,
+	})
+}
+
+// statusFromLockError 将锁和选举的错误映射为 HTTP 状态码
+func statusFromLockError(err error) int {
+	switch {
+	case errors.Is(err, concurrency.ErrLocked):
+		return http.StatusConflict
+	case errors.Is(err, concurrency.ErrNoLeader), errors.Is(err, concurrency.ErrSessionExpired):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout
+	default:
+		return statusFromStoreError(err)
+	}
+}
+
+// storeKV 基于本地存储实现 concurrency.KV，写操作仍然经过 Raft
+type storeKV struct {
+	store *store.Store
+}
+
+func (s *storeKV) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	lease, err := s.store.GrantLease(ttl)
+	if err != nil {
+		return 0, err
+	}
+	return lease.ID, nil
+}
+
+func (s *storeKV) KeepAlive(ctx context.Context, lease int64) error {
+	_, err := s.store.KeepAlive(lease)
+	return err
+}
+
+func (s *storeKV) Revoke(ctx context.Context, lease int64) error {
+	_, err := s.store.RevokeLease(lease)
+	return err
+}
+
+func (s *storeKV) Create(ctx context.Context, key, value string, lease int64) (concurrency.KeyValue, bool, error) {
+	res, err := s.store.Txn(&store.Txn{
+		Compare: []store.Compare{{Key: key, Target: store.CompareCreateRevision, Result: "="}},
+		Success: []store.Op{{Type: store.OpPut, Key: key, Value: value, Lease: lease}},
+		Failure: []store.Op{{Type: store.OpGet, Key: key}},
+	})
+	if err != nil {
+		return concurrency.KeyValue{}, false, err
+	}
+	if len(res.Results) == 0 || res.Results[0].KV == nil {
+		return concurrency.KeyValue{}, false, store.ErrKeyNotFound
+	}
+	return toConcurrencyKV(res.Results[0].KV), res.Succeeded, nil
+}
+
+func (s *storeKV) Delete(ctx context.Context, key string) error {
+	_, err := s.store.Txn(&store.Txn{Success: []store.Op{{Type: store.OpDelete, Key: key}}})
+	return err
+}
+
+func (s *storeKV) List(ctx context.Context, prefix string) ([]concurrency.KeyValue, uint64, error) {
+	var (
+		kvs []concurrency.KeyValue
+		rev uint64
+	)
+	opts := store.ScanOptions{Prefix: prefix, Limit: maxScanLimit}
+	lvl := store.Linearizable
+	for {
+		res, err := s.store.Scan(opts, lvl)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i := range res.KVs {
+			kvs = append(kvs, toConcurrencyKV(&res.KVs[i]))
+		}
+		rev = res.Revision
+		if !res.More {
+			return kvs, rev, nil
+		}
+		opts.Start, opts.Revision, lvl = res.Next, rev, store.Stale
+	}
+}
+
+func (s *storeKV) Wait(ctx context.Context, key string, prefix bool, rev uint64) error {
+	w, err := s.store.Watch(store.WatchOptions{Key: key, Prefix: prefix, StartRevision: rev + 1})
+	if errors.Is(err, store.ErrCompacted) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer w.Cancel()
+
+	select {
+	case <-w.Events():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func toConcurrencyKV(kv *store.KeyValue) concurrency.KeyValue {
+	return concurrency.KeyValue{
+		Key:            kv.Key,
+		Value:          kv.Value,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Lease:          kv.Lease,
+	}
+}
@@ -0,0 +1,157 @@
+// internal/handler/migration_handler.go
+package handler
+
+import (
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/websocket"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wsTypeMigration 是推送给 WebSocket 客户端的槽迁移进度消息类型
+const wsTypeMigration = "migration"
+
+// MigrationHandler 处理哈希槽在 Raft 组之间迁移的请求
+type MigrationHandler struct {
+	shards *store.Shards
+}
+
+// NewMigrationHandler 创建迁移处理器，并将迁移的每个阶段推送给所有 WebSocket 客户端
+func NewMigrationHandler(shards *store.Shards, wsManager *websocket.Manager) *MigrationHandler {
+	shards.SetMigrationHandler(func(m store.Migration) {
+		wsManager.BroadcastJSON(gin.H{
+			"type":      wsTypeMigration,
+			"migration": m,
+		})
+	})
+	return &MigrationHandler{
+		shards: shards,
+	}
+}
+
+// MigrateRequest 迁移槽的请求
+type MigrateRequest struct {
+	Slot  *int `json:"slot" binding:"required"`
+	Group *int `json:"group" binding:"required"` // 目标组
+}
+
+// HandleMigrate 处理迁移单个槽的请求，迁移在后台执行，通过 HandleGet 或 WebSocket 查看进度
+func (h *MigrationHandler) HandleMigrate(c *gin.Context) {
+	var req MigrateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	m, err := h.shards.Migrate(*req.Slot, *req.Group)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to start migration: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "success",
+		"data":   m,
+	})
+}
+
+// HandleRebalance 处理重新平衡的请求，将槽从较多的组迁移到较少的组
+func (h *MigrationHandler) HandleRebalance(c *gin.Context) {
+	planned, err := h.shards.Rebalance()
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to rebalance: " + err.Error(),
+			"data":    planned,
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"migrations": planned,
+			"count":      len(planned),
+		},
+	})
+}
+
+// HandleList 处理列出迁移记录的请求
+func (h *MigrationHandler) HandleList(c *gin.Context) {
+	migrations := h.shards.Migrations()
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"migrations": migrations,
+			"count":      len(migrations),
+		},
+	})
+}
+
+// HandleGet 处理查询单个迁移进度的请求
+func (h *MigrationHandler) HandleGet(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid migration ID: " + c.Param("id"),
+		})
+		return
+	}
+	m, ok := h.shards.GetMigration(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Migration not found: " + c.Param("id"),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   m,
+	})
+}
+
+// HandleAbort 处理中止迁移的请求：尚未交接的迁移被回滚，源组中该槽恢复写入
+// 用于执行迁移的节点长时间不可用、槽一直被冻结的情况，已经交接的迁移不能中止
+func (h *MigrationHandler) HandleAbort(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid migration ID: " + c.Param("id"),
+		})
+		return
+	}
+	if _, ok := h.shards.GetMigration(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Migration not found: " + c.Param("id"),
+		})
+		return
+	}
+
+	m, err := h.shards.AbortMigration(id)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to abort migration: " + err.Error(),
+			"data":    m,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   m,
+	})
+}
@@ -0,0 +1,232 @@
+// internal/handler/namespace_handler.go
+package handler
+
+import (
+	"gotoraft/internal/kvstore/store"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerNamespace 指定请求所在命名空间的请求头，未指定时直接访问完整的键空间
+const headerNamespace = "X-Namespace"
+
+// keyspace 是请求所在的命名空间，请求中的键加上 "<ns>/" 前缀后访问存储，响应中的键去掉该前缀
+type keyspace string
+
+// requestKeyspace 读取请求头中的命名空间，命名空间无效或不存在时写入错误响应
+func requestKeyspace(c *gin.Context, s *store.Store) (keyspace, bool) {
+	ns := c.GetHeader(headerNamespace)
+	if ns == "" {
+		return "", true
+	}
+	if _, err := s.GetNamespace(ns); err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error() + ": " + ns,
+		})
+		return "", false
+	}
+	return keyspace(ns), true
+}
+
+// key 返回存储中的键
+func (ks keyspace) key(key string) string {
+	return store.NamespaceKey(string(ks), key)
+}
+
+// strip 返回命名空间中的键
+func (ks keyspace) strip(key string) string {
+	if ks == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, string(ks)+store.NamespaceSeparator)
+}
+
+// kv 返回去掉命名空间前缀的副本
+func (ks keyspace) kv(kv *store.KeyValue) *store.KeyValue {
+	if ks == "" || kv == nil {
+		return kv
+	}
+	out := *kv
+	out.Key = ks.strip(out.Key)
+	return &out
+}
+
+// kvs 返回去掉命名空间前缀的副本
+func (ks keyspace) kvs(kvs []store.KeyValue) []store.KeyValue {
+	if ks == "" {
+		return kvs
+	}
+	out := make([]store.KeyValue, len(kvs))
+	for i := range kvs {
+		out[i] = *ks.kv(&kvs[i])
+	}
+	return out
+}
+
+// ops 为操作中的键加上命名空间前缀
+func (ks keyspace) ops(ops []store.Op) []store.Op {
+	if ks == "" {
+		return ops
+	}
+	out := make([]store.Op, len(ops))
+	for i, op := range ops {
+		op.Key = ks.key(op.Key)
+		out[i] = op
+	}
+	return out
+}
+
+// txn 为事务中的键加上命名空间前缀
+func (ks keyspace) txn(t *store.Txn) {
+	if ks == "" {
+		return
+	}
+	for i := range t.Compare {
+		t.Compare[i].Key = ks.key(t.Compare[i].Key)
+	}
+	t.Success = ks.ops(t.Success)
+	t.Failure = ks.ops(t.Failure)
+}
+
+// txnResult 返回去掉命名空间前缀的事务结果
+func (ks keyspace) txnResult(r *store.TxnResult) *store.TxnResult {
+	if ks == "" || r == nil {
+		return r
+	}
+	out := *r
+	out.Results = make([]store.OpResult, len(r.Results))
+	for i, res := range r.Results {
+		res.Key = ks.strip(res.Key)
+		res.KV = ks.kv(res.KV)
+		out.Results[i] = res
+	}
+	return &out
+}
+
+// NamespaceHandler 处理命名空间的管理请求
+type NamespaceHandler struct {
+	store *store.Store
+}
+
+// NewNamespaceHandler 创建一个新的命名空间处理器
+func NewNamespaceHandler(kvStore *store.Store) *NamespaceHandler {
+	return &NamespaceHandler{
+		store: kvStore,
+	}
+}
+
+// CreateNamespaceRequest 创建命名空间的请求
+type CreateNamespaceRequest struct {
+	Name  string      `json:"name" binding:"required"`
+	Quota store.Quota `json:"quota"`
+}
+
+// HandleCreate 处理创建命名空间的请求，前缀下已有的键计入用量
+func (h *NamespaceHandler) HandleCreate(c *gin.Context) {
+	var req CreateNamespaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	ns, err := h.store.CreateNamespace(req.Name, req.Quota, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to create namespace: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   ns,
+	})
+}
+
+// HandleSetQuota 处理修改命名空间配额的请求，请求体为新的配额
+func (h *NamespaceHandler) HandleSetQuota(c *gin.Context) {
+	var q store.Quota
+	if err := c.ShouldBindJSON(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	ns, err := h.store.SetNamespaceQuota(c.Param("name"), q, wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to update quota: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   ns,
+	})
+}
+
+// HandleDelete 处理删除命名空间的请求，其中所有的键在同一条日志中删除
+func (h *NamespaceHandler) HandleDelete(c *gin.Context) {
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	ns, err := h.store.DeleteNamespace(c.Param("name"), wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to delete namespace: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Namespace deleted successfully",
+		"data":    ns,
+	})
+}
+
+// HandleGet 处理查询单个命名空间及其用量的请求
+func (h *NamespaceHandler) HandleGet(c *gin.Context) {
+	ns, err := h.store.GetNamespace(c.Param("name"))
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   ns,
+	})
+}
+
+// HandleList 处理列出所有命名空间的请求
+func (h *NamespaceHandler) HandleList(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   h.store.Namespaces(),
+	})
+}
@@ -0,0 +1,110 @@
+// internal/handler/route.go
+package handler
+
+import (
+	"bytes"
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/middleware"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerForwarded 标记由其他节点转发来的请求，收到后不再转发，避免 Leader 变化时循环转发
+const headerForwarded = "X-Raft-Forwarded"
+
+// keyGroup 返回键所在的 Raft 组
+// 命名空间中的键固定在 0 号组，与命名空间及其配额在同一个状态机中
+func keyGroup(shards *store.Shards, ks keyspace, keys ...string) (int, error) {
+	if ks != "" {
+		return 0, nil
+	}
+	return shards.GroupOfKeys(keys...)
+}
+
+// route 返回处理请求的组
+// 需要 Leader 的请求（写入以及非 stale 的读取）在本节点不是该组的 Leader 时转发到 Leader，此时写入响应并返回 false
+// 无法转发时仍由本节点处理，由存储层返回 ErrNotLeader
+func route(c *gin.Context, shards *store.Shards, group int, lvl store.ConsistencyLevel) (*store.Store, bool) {
+	s := shards.Group(group)
+	c.Set(middleware.ContextAppliedIndex, func() (int, uint64) {
+		rev, _ := s.Revisions()
+		return group, rev
+	})
+	if lvl == store.Stale || s.IsLeader() || c.GetHeader(headerForwarded) != "" {
+		return s, true
+	}
+	addr, ok := shards.LeaderHTTP(group)
+	if !ok {
+		return s, true
+	}
+	target, err := url.Parse(addr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": "Invalid leader address: " + addr,
+		})
+		return nil, false
+	}
+
+	// 处理器已经读取的请求体由 ShouldBindBodyWith 缓存在 gin.Context 中
+	if body, ok := c.Get(gin.BodyBytesKey); ok {
+		c.Request.Body = io.NopCloser(bytes.NewReader(body.([]byte)))
+		c.Request.ContentLength = int64(len(body.([]byte)))
+	}
+	c.Request.Header.Set(headerForwarded, "1")
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"status":  "error",
+			"message": "Failed to forward to leader: " + err.Error(),
+		})
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+	return nil, false
+}
+
+// requireGroupLease 检查绑定租约的写入落在 0 号组，租约只在 0 号组中维护
+func requireGroupLease(c *gin.Context, shards *store.Shards, s *store.Store, lease int64) bool {
+	if lease == 0 || s == shards.Group(0) {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status":  "error",
+		"message": "Leases are only available for keys in raft group 0, use a namespace or a {tag} that hashes to group 0",
+	})
+	return false
+}
+
+// queryGroup 读取查询参数 group，没有指定时返回 -1，组号无效时写入错误响应并返回 false
+func queryGroup(c *gin.Context, shards *store.Shards) (int, bool) {
+	v := c.Query("group")
+	if v == "" {
+		return -1, true
+	}
+	group, err := strconv.Atoi(v)
+	if err != nil || group < 0 || group >= shards.Len() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": "Invalid group: " + v,
+		})
+		return 0, false
+	}
+	return group, true
+}
+
+// requireSingleGroup 拒绝只能作用于单个 Raft 组的整库操作，有多个组时写入错误响应并返回 false
+func requireSingleGroup(c *gin.Context, shards *store.Shards, op string) bool {
+	if shards.Len() == 1 {
+		return true
+	}
+	c.JSON(http.StatusNotImplemented, gin.H{
+		"status":  "error",
+		"message": op + " is not supported with multiple raft groups",
+	})
+	return false
+}
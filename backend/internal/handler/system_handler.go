@@ -3,6 +3,8 @@
 package handler
 
 import (
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/websocket"
 	"net/http"
 	"runtime"
 	"time"
@@ -21,9 +23,15 @@ const (
 	stopped status = "stopped"
 	healthy status = "healthy"
 	pong    status = "pong"
-	error   status = "error"
+	failed  status = "error"
+
+	alarmed  status = "alarm"    // 存储空间告警，只允许读取和删除
+	degraded status = "degraded" // 部分服务受限但仍可用
 )
 
+// wsTypeAlarm 是推送给 WebSocket 客户端的告警消息类型
+const wsTypeAlarm = "alarm"
+
 type Response struct {
 	Status  status      `json:"status"`
 	Data    interface{} `json:"data"`
@@ -38,12 +46,23 @@ type SystemHandler struct {
 	version      string
 	readTimeout  time.Duration
 	writeTimeout time.Duration
+
+	store *store.Store
 }
 
-func NewSystemHandler() *SystemHandler {
+// NewSystemHandler 创建系统处理器，并将存储空间告警的变化推送给所有 WebSocket 客户端
+func NewSystemHandler(kvStore *store.Store, wsManager *websocket.Manager) *SystemHandler {
+	kvStore.SetAlarmHandler(func(ev store.AlarmEvent) {
+		wsManager.BroadcastJSON(gin.H{
+			"type":   wsTypeAlarm,
+			"active": ev.Active,
+			"alarm":  ev.Alarm,
+		})
+	})
 	return &SystemHandler{
 		startTime: time.Now(),
 		version:   version,
+		store:     kvStore,
 	}
 }
 
@@ -96,10 +115,16 @@ func (h *SystemHandler) HandleHealth(c *gin.Context) {
 		"api":     healthy,
 		"storage": healthy,
 	}
+	alarm := h.store.Alarm()
+	if alarm != nil {
+		services["storage"] = alarmed
+	}
 
-	// 检查所有服务状态
+	// 检查所有服务状态，告警期间仍可读取和删除
 	for _, status := range services {
-		if status != healthy {
+		if status == alarmed {
+			healthStatus = degraded
+		} else if status != healthy {
 			healthStatus = stopped
 			break
 		}
@@ -110,6 +135,45 @@ func (h *SystemHandler) HandleHealth(c *gin.Context) {
 		"timestamp": time.Now().Format(time.RFC3339),
 		"version":   version,
 		"services":  services,
+		"alarm":     alarm,
+		"storage": gin.H{
+			"size":       h.store.StorageSize(),
+			"quotaBytes": h.store.QuotaBytes(),
+		},
+	})
+}
+
+// HandleAlarm 处理查询存储空间告警的请求，没有告警时 data 为 null
+func (h *SystemHandler) HandleAlarm(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data": gin.H{
+			"alarm":      h.store.Alarm(),
+			"size":       h.store.StorageSize(),
+			"quotaBytes": h.store.QuotaBytes(),
+		},
+	})
+}
+
+// HandleDisarmAlarm 处理解除存储空间告警的请求，需要先压缩历史或删除数据使存储大小回到配额以内
+func (h *SystemHandler) HandleDisarmAlarm(c *gin.Context) {
+	wopts, ok := writeOptions(c)
+	if !ok {
+		return
+	}
+	alarm, err := h.store.DisarmAlarm(wopts...)
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to disarm alarm: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Alarm disarmed",
+		"data":    alarm,
 	})
 }
 
@@ -134,7 +198,7 @@ func ErrorHandler() gin.HandlerFunc {
 		c.Next()
 		if len(c.Errors) > 0 {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  error,
+				"status":  failed,
 				"message": c.Errors.String(),
 			})
 		}
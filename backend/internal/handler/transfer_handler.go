@@ -0,0 +1,158 @@
+// internal/handler/transfer_handler.go
+package handler
+
+import (
+	"encoding/json"
+	"gotoraft/internal/kvstore/store"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportWriter 在第一次写入时才写出响应头，导出在写入数据之前失败时仍可返回 JSON 错误
+type exportWriter struct {
+	c       *gin.Context
+	format  string
+	started bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		contentType := "application/x-ndjson"
+		if w.format == store.FormatCSV {
+			contentType = "text/csv; charset=utf-8"
+		}
+		w.c.Header("Content-Type", contentType)
+		w.c.Header("Content-Disposition", `attachment; filename="gotoraft-export.`+w.format+`"`)
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+// HandleExport 导出所有 Raft 组中的键，查询参数：format（jsonl 或 csv）、prefix、level
+func (h *KVStoreHandler) HandleExport(c *gin.Context) {
+	format, err := store.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	lvl, err := store.ParseConsistencyLevel(c.Query("level"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w := &exportWriter{c: c, format: format}
+	_, err = h.shards.Export(w, store.ExportOptions{
+		Format: format,
+		Prefix: c.Query("prefix"),
+		Level:  lvl,
+	})
+	if err != nil && !w.started {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": "Failed to export keys: " + err.Error(),
+		})
+		return
+	}
+	if !w.started {
+		// 没有任何键时 JSONL 的内容为空，仍返回一个空文件
+		w.Write(nil)
+	}
+}
+
+// HandleImport 导入 JSONL 或 CSV 文件，记录按所在的 Raft 组分成批次提交
+// 查询参数：format、batchSize、dryRun（只报告与现有键的冲突）、progress（以 NDJSON 流式返回进度）
+// 请求体可以是文件本身，也可以是字段名为 file 的 multipart 表单
+func (h *KVStoreHandler) HandleImport(c *gin.Context) {
+	format, err := store.ParseFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	opts := store.ImportOptions{Format: format}
+	if v := c.Query("batchSize"); v != "" {
+		opts.BatchSize, err = strconv.Atoi(v)
+		if err != nil || opts.BatchSize <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "batchSize must be a positive integer",
+			})
+			return
+		}
+	}
+	opts.DryRun, _ = strconv.ParseBool(c.Query("dryRun"))
+	streaming, _ := strconv.ParseBool(c.Query("progress"))
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	if !streaming {
+		res, err := h.shards.Import(body, opts)
+		if err != nil {
+			c.JSON(statusFromStoreError(err), gin.H{
+				"status":  "error",
+				"message": "Failed to import keys: " + err.Error(),
+				"data":    res,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "success",
+			"data":   res,
+		})
+		return
+	}
+
+	// 流式返回：每个批次一行 {"type":"progress"}，最后一行为结果或错误
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	opts.Progress = func(p store.ImportProgress) {
+		enc.Encode(gin.H{"type": "progress", "data": p})
+		c.Writer.Flush()
+	}
+	res, err := h.shards.Import(body, opts)
+	if err != nil {
+		enc.Encode(gin.H{
+			"type":    "result",
+			"status":  "error",
+			"message": "Failed to import keys: " + err.Error(),
+			"data":    res,
+		})
+		return
+	}
+	enc.Encode(gin.H{"type": "result", "status": "success", "data": res})
+}
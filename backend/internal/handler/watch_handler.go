@@ -0,0 +1,182 @@
+// Package handler 提供HTTP和WebSocket处理器
+// 键变更监听，通过 WebSocket 和 Server-Sent Events 推送
+package handler
+
+import (
+	"encoding/json"
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/websocket"
+	"gotoraft/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebSocket 上监听相关的消息类型
+const (
+	wsTypeWatch       = "watch"        // 客户端 -> 服务端：开始监听
+	wsTypeCancelWatch = "cancel_watch" // 客户端 -> 服务端：取消监听
+	wsTypeWatchEvent  = "watch_event"  // 服务端 -> 客户端：键变更事件
+	wsTypeWatchError  = "watch_error"  // 服务端 -> 客户端：监听失败或被关闭
+)
+
+// WatchMessage 客户端通过 WebSocket 发来的监听请求
+type WatchMessage struct {
+	Type          string `json:"type"`
+	WatchID       string `json:"watchId"`
+	Key           string `json:"key"`
+	Prefix        bool   `json:"prefix"`
+	StartRevision uint64 `json:"startRevision"`
+}
+
+// WatchHandler 处理键变更的监听
+type WatchHandler struct {
+	shards    *store.Shards
+	wsManager *websocket.Manager
+
+	mu      sync.Mutex
+	watches map[string]map[string]*store.Watcher // clientID -> watchID -> watcher
+}
+
+// NewWatchHandler 创建一个新的监听处理器，并接管 WebSocket 客户端的消息
+func NewWatchHandler(shards *store.Shards, wsManager *websocket.Manager) *WatchHandler {
+	h := &WatchHandler{
+		shards:    shards,
+		wsManager: wsManager,
+		watches:   make(map[string]map[string]*store.Watcher),
+	}
+	wsManager.SetMessageHandler(h.handleMessage)
+	wsManager.SetCloseHandler(h.cancelClient)
+	return h
+}
+
+// handleMessage 处理 WebSocket 客户端的监听请求
+func (h *WatchHandler) handleMessage(clientID string, message []byte) {
+	var msg WatchMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+
+	switch msg.Type {
+	case wsTypeWatch:
+		h.startWatch(clientID, msg)
+	case wsTypeCancelWatch:
+		h.mu.Lock()
+		w := h.watches[clientID][msg.WatchID]
+		delete(h.watches[clientID], msg.WatchID)
+		h.mu.Unlock()
+		if w != nil {
+			w.Cancel()
+		}
+	}
+}
+
+func (h *WatchHandler) startWatch(clientID string, msg WatchMessage) {
+	if msg.WatchID == "" {
+		h.sendWatchError(clientID, msg.WatchID, "watchId is required")
+		return
+	}
+	w, err := h.shards.Watch(store.WatchOptions{
+		Key:           msg.Key,
+		Prefix:        msg.Prefix,
+		StartRevision: msg.StartRevision,
+	})
+	if err != nil {
+		h.sendWatchError(clientID, msg.WatchID, err.Error())
+		return
+	}
+
+	h.mu.Lock()
+	if h.watches[clientID] == nil {
+		h.watches[clientID] = make(map[string]*store.Watcher)
+	}
+	if old := h.watches[clientID][msg.WatchID]; old != nil {
+		old.Cancel()
+	}
+	h.watches[clientID][msg.WatchID] = w
+	h.mu.Unlock()
+
+	go func() {
+		for ev := range w.Events() {
+			err := h.wsManager.SendJSON(clientID, gin.H{
+				"type":    wsTypeWatchEvent,
+				"watchId": msg.WatchID,
+				"event":   ev,
+			})
+			if err != nil {
+				logger.Errorf("Failed to deliver watch event to %s: %v", clientID, err)
+				w.Cancel()
+			}
+		}
+		if err := w.Err(); err != nil {
+			h.sendWatchError(clientID, msg.WatchID, err.Error())
+		}
+	}()
+}
+
+func (h *WatchHandler) sendWatchError(clientID, watchID, message string) {
+	h.wsManager.SendJSON(clientID, gin.H{
+		"type":    wsTypeWatchError,
+		"watchId": watchID,
+		"message": message,
+	})
+}
+
+// cancelClient 客户端断开时取消其所有监听
+func (h *WatchHandler) cancelClient(clientID string) {
+	h.mu.Lock()
+	watches := h.watches[clientID]
+	delete(h.watches, clientID)
+	h.mu.Unlock()
+
+	for _, w := range watches {
+		w.Cancel()
+	}
+}
+
+// HandleSSE 以 Server-Sent Events 推送键变更
+// 查询参数：key、prefix、startRevision，有多个 Raft 组时前缀监听不支持 startRevision
+func (h *WatchHandler) HandleSSE(c *gin.Context) {
+	prefix, _ := strconv.ParseBool(c.Query("prefix"))
+	startRevision, err := parseRevision(c.Query("startRevision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w, err := h.shards.Watch(store.WatchOptions{
+		Key:           c.Query("key"),
+		Prefix:        prefix,
+		StartRevision: startRevision,
+	})
+	if err != nil {
+		c.JSON(statusFromStoreError(err), gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+	defer w.Cancel()
+
+	c.Stream(func(out io.Writer) bool {
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				if err := w.Err(); err != nil {
+					c.SSEvent("error", gin.H{"message": err.Error()})
+				}
+				return false
+			}
+			c.SSEvent(string(ev.Type), ev)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"gotoraft/pkg/logger"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// 存储空间告警的错误
+var (
+	ErrNoSpace       = errors.New("storage space exceeded")
+	ErrSpaceNotFreed = errors.New("storage size still exceeds the quota")
+)
+
+// AlarmNoSpace 是存储超出配额时的告警类型
+const AlarmNoSpace = "NOSPACE"
+
+// alarmCheckInterval 是 Leader 检查存储大小的间隔
+const alarmCheckInterval = time.Second
+
+// Alarm 是通过 Raft 复制的告警，告警期间拒绝新的写入，读取和删除不受影响
+type Alarm struct {
+	Type     string `json:"type"`
+	Revision uint64 `json:"revision"` // 触发告警的修订号
+	RaisedAt int64  `json:"raisedAt"` // 触发时间（Unix 毫秒），取自日志时间
+	Size     int64  `json:"size"`     // 触发时的存储大小
+	Quota    int64  `json:"quota"`    // 触发时 Leader 配置的配额
+}
+
+// AlarmEvent 是告警状态的变化，Active 为 false 表示告警被解除
+type AlarmEvent struct {
+	Active bool  `json:"active"`
+	Alarm  Alarm `json:"alarm"`
+}
+
+// SetQuotaBytes 设置存储大小的配额（字节），超出时由 Leader 提议 NOSPACE 告警，0 表示不限
+func (s *Store) SetQuotaBytes(n int64) {
+	s.quotaBytes.Store(max(n, 0))
+}
+
+// SetAlarmHandler 设置告警状态变化的回调
+// 回调在状态机应用日志时同步调用，不能阻塞，也不能调用 Store 的方法
+func (s *Store) SetAlarmHandler(fn func(AlarmEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alarmHandler = fn
+}
+
+// Alarm 返回当前的告警，没有告警时返回 nil
+func (s *Store) Alarm() *Alarm {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.alarm == nil {
+		return nil
+	}
+	out := *s.alarm
+	return &out
+}
+
+// StorageSize 返回存储大小，即所有保留的历史版本中键和值的总字节数
+func (s *Store) StorageSize() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.size
+}
+
+// QuotaBytes 返回本节点配置的存储配额，0 表示不限
+func (s *Store) QuotaBytes() int64 {
+	return s.quotaBytes.Load()
+}
+
+// DisarmAlarm 解除 NOSPACE 告警，返回被解除的告警，没有告警时返回 nil
+// 存储大小仍超出配额时返回 ErrSpaceNotFreed，需要先压缩历史并删除数据
+// 只有 Leader 能提议，命令带上 Leader 的配额，由状态机按应用时的存储大小检查，
+// 不会解除之后又被 Leader 的 runAlarm 重新触发
+func (s *Store) DisarmAlarm(wopts ...WriteOption) (*Alarm, error) {
+	res, err := s.apply(&command{Op: opAlarmDisarm, Alarm: &Alarm{Type: AlarmNoSpace, Quota: s.QuotaBytes()}}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.alarm, nil
+}
+
+// checkAlarm 在告警期间拒绝会增加数据的命令，调用方需持有读锁
+// 删除、压缩、过期、租约续期和撤销仍然允许，以便释放空间
+func (s *Store) checkAlarm(c *command) error {
+	if s.alarm == nil {
+		return nil
+	}
+	switch c.Op {
+	case opSet, opCompareSwap, opSetIfAbsent, opIncr, opLeaseGrant:
+		return ErrNoSpace
+	case opTxn:
+		if c.Txn != nil && (hasPut(c.Txn.Success) || hasPut(c.Txn.Failure)) {
+			return ErrNoSpace
+		}
+	}
+	return nil
+}
+
+func hasPut(ops []Op) bool {
+	for _, op := range ops {
+		if op.Type == OpPut {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAlarmActivate 触发告警，已有告警时保持不变，调用方需持有写锁
+func (s *Store) applyAlarmActivate(c *command, log *raft.Log) *applyResult {
+	if s.alarm == nil && c.Alarm != nil {
+		s.alarm = &Alarm{
+			Type:     AlarmNoSpace,
+			Revision: log.Index,
+			RaisedAt: logTime(log),
+			Size:     c.Alarm.Size,
+			Quota:    c.Alarm.Quota,
+		}
+		s.notifyAlarm(AlarmEvent{Active: true, Alarm: *s.alarm})
+	}
+	if s.alarm == nil {
+		return &applyResult{}
+	}
+	out := *s.alarm
+	return &applyResult{alarm: &out}
+}
+
+// applyAlarmDisarm 解除告警并返回被解除的告警，调用方需持有写锁
+// 存储大小超出命令中 Leader 的配额时保留告警
+func (s *Store) applyAlarmDisarm(c *command) *applyResult {
+	if s.alarm == nil {
+		return &applyResult{}
+	}
+	if c.Alarm != nil && c.Alarm.Quota > 0 && s.size > c.Alarm.Quota {
+		return &applyResult{err: fmt.Errorf("%w: %d bytes, quota %d", ErrSpaceNotFreed, s.size, c.Alarm.Quota)}
+	}
+	out := *s.alarm
+	s.alarm = nil
+	s.notifyAlarm(AlarmEvent{Active: false, Alarm: out})
+	return &applyResult{alarm: &out}
+}
+
+// notifyAlarm 调用告警回调，调用方需持有写锁
+func (s *Store) notifyAlarm(ev AlarmEvent) {
+	if s.alarmHandler != nil {
+		s.alarmHandler(ev)
+	}
+}
+
+// runAlarm 在 Leader 上定期检查存储大小，超出配额时提议 NOSPACE 告警，直到 Store 关闭
+func (s *Store) runAlarm() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(alarmCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownCh:
+			return
+		case <-ticker.C:
+			quota := s.QuotaBytes()
+			if quota == 0 || s.raft.State() != raft.Leader {
+				continue
+			}
+			s.mu.RLock()
+			size, active := s.size, s.alarm != nil
+			s.mu.RUnlock()
+			if active || size <= quota {
+				continue
+			}
+			logger.Warnf("storage size %d exceeds quota %d, raising %s alarm", size, quota, AlarmNoSpace)
+			if _, err := s.apply(&command{Op: opAlarmActivate, Alarm: &Alarm{Type: AlarmNoSpace, Size: size, Quota: quota}}); err != nil {
+				logger.Warnf("failed to propose %s alarm: %v", AlarmNoSpace, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestAlarm_RejectsWritesUntilDisarmed(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	var events []AlarmEvent
+	s.SetAlarmHandler(func(ev AlarmEvent) { events = append(events, ev) })
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "a", Value: "1"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "b", Value: "2"})
+	res := applyCommand(t, f, 3, &command{Op: opAlarmActivate, Alarm: &Alarm{Size: 4, Quota: 3}})
+	if res.alarm == nil || res.alarm.Type != AlarmNoSpace || res.alarm.Revision != 3 {
+		t.Fatalf("activate: %+v", res.alarm)
+	}
+
+	rejected := []*command{
+		{Op: opSet, Key: "c", Value: "3"},
+		{Op: opSetIfAbsent, Key: "c", Value: "3"},
+		{Op: opIncr, Key: "n", Delta: 1},
+		{Op: opLeaseGrant, TTL: 1},
+		{Op: opTxn, Txn: &Txn{Failure: []Op{{Type: OpPut, Key: "c", Value: "3"}}}},
+	}
+	for i, c := range rejected {
+		if res := applyCommand(t, f, uint64(4+i), c); !errors.Is(res.err, ErrNoSpace) {
+			t.Fatalf("%s during alarm: got %v, want %v", c.Op, res.err, ErrNoSpace)
+		}
+	}
+	// 删除和只含删除的事务仍然允许，以便释放空间
+	if res := applyCommand(t, f, 10, &command{Op: opDelete, Key: "a"}); res.err != nil {
+		t.Fatalf("delete during alarm: %v", res.err)
+	}
+	res = applyCommand(t, f, 11, &command{Op: opTxn, Txn: &Txn{Success: []Op{{Type: OpDelete, Key: "b"}}}})
+	if res.err != nil {
+		t.Fatalf("delete txn during alarm: %v", res.err)
+	}
+	if _, err := s.Get("b", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("b should be deleted, got %v", err)
+	}
+
+	res = applyCommand(t, f, 12, &command{Op: opAlarmDisarm})
+	if res.alarm == nil || s.Alarm() != nil {
+		t.Fatalf("disarm: %+v, current %+v", res.alarm, s.Alarm())
+	}
+	if res := applyCommand(t, f, 13, &command{Op: opSet, Key: "c", Value: "3"}); res.err != nil {
+		t.Fatalf("set after disarm: %v", res.err)
+	}
+	if len(events) != 2 || !events[0].Active || events[1].Active {
+		t.Fatalf("alarm events: %+v", events)
+	}
+}
+
+func TestAlarm_DisarmChecksLeaderQuotaAtApply(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "vvvv"})
+	applyCommand(t, f, 2, &command{Op: opAlarmActivate, Alarm: &Alarm{Size: 5, Quota: 4}})
+
+	// 配额取自命令，与应用它的节点本地的配置无关
+	s.SetQuotaBytes(100)
+	res := applyCommand(t, f, 3, &command{Op: opAlarmDisarm, Alarm: &Alarm{Type: AlarmNoSpace, Quota: 4}})
+	if !errors.Is(res.err, ErrSpaceNotFreed) || s.Alarm() == nil {
+		t.Fatalf("disarm above quota: %v, alarm %+v", res.err, s.Alarm())
+	}
+
+	applyCommand(t, f, 4, &command{Op: opDelete, Key: "k"})
+	applyCommand(t, f, 5, &command{Op: opCompact, Revision: 4})
+	res = applyCommand(t, f, 6, &command{Op: opAlarmDisarm, Alarm: &Alarm{Type: AlarmNoSpace, Quota: 4}})
+	if res.err != nil || res.alarm == nil || s.Alarm() != nil {
+		t.Fatalf("disarm after freeing space: %+v, %v", res.alarm, res.err)
+	}
+}
+
+func TestAlarm_StorageSizeTracksCompaction(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "aaaa"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "bb"})
+	applyCommand(t, f, 3, &command{Op: opDelete, Key: "k"})
+	if size := s.StorageSize(); size != 5+3+1 {
+		t.Fatalf("size with history: %d, want 9", size)
+	}
+	applyCommand(t, f, 4, &command{Op: opCompact, Revision: 3})
+	if size := s.StorageSize(); size != 0 {
+		t.Fatalf("size after compaction: %d, want 0", size)
+	}
+}
+
+func TestAlarm_SurvivesSnapshot(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "vv"})
+	applyCommand(t, f, 3, &command{Op: opAlarmActivate, Alarm: &Alarm{Size: 5, Quota: 1}})
+
+	snap, _ := f.Snapshot()
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	restored := NewStore(t.TempDir(), "", true)
+	rf := newFSM(restored)
+	if err := rf.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if a := restored.Alarm(); a == nil || a.Revision != 3 || a.Quota != 1 {
+		t.Fatalf("alarm after restore: %+v", a)
+	}
+	if size := restored.StorageSize(); size != s.StorageSize() {
+		t.Fatalf("size after restore: %d, want %d", size, s.StorageSize())
+	}
+	if res := applyCommand(t, rf, 4, &command{Op: opSet, Key: "x", Value: "y"}); !errors.Is(res.err, ErrNoSpace) {
+		t.Fatalf("set after restore: got %v, want %v", res.err, ErrNoSpace)
+	}
+}
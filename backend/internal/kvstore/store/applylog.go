@@ -0,0 +1,37 @@
+package store
+
+import "github.com/hashicorp/raft"
+
+// LogEntry 是状态机应用的一条日志的摘要，用于可视化的日志视图
+type LogEntry struct {
+	Index     uint64   `json:"index"`
+	Term      uint64   `json:"term"`
+	Timestamp int64    `json:"timestamp"` // 日志时间（Unix 毫秒）
+	Op        string   `json:"op"`
+	Key       string   `json:"key,omitempty"`
+	Expired   []string `json:"expired,omitempty"` // expire 日志实际删除的键
+	Error     string   `json:"error,omitempty"`
+}
+
+// SetLogHandler 设置应用日志的回调，每条应用的命令日志调用一次
+// 回调在状态机应用日志时同步调用，不能阻塞，也不能调用 Store 的方法
+func (s *Store) SetLogHandler(fn func(LogEntry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logHandler = fn
+}
+
+// notifyLog 调用应用日志的回调，调用方需持有写锁
+func (s *Store) notifyLog(log *raft.Log, c *command, res *applyResult) {
+	if s.logHandler == nil {
+		return
+	}
+	entry := LogEntry{Index: log.Index, Term: log.Term, Timestamp: logTime(log), Op: c.Op, Key: c.Key}
+	if c.Op == opExpire {
+		entry.Expired = res.expired
+	}
+	if res.err != nil {
+		entry.Error = res.err.Error()
+	}
+	s.logHandler(entry)
+}
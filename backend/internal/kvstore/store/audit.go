@@ -0,0 +1,326 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotoraft/internal/foorpc"
+	"gotoraft/pkg/logger"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	auditServiceMethod = "AuditService.Hash"
+	auditTimeout       = 10 * time.Second // 单次后台审计的超时时间
+	auditDialTimeout   = 3 * time.Second  // 连接其他节点的超时时间
+	minAuditInterval   = 10 * time.Second // 后台审计的最短间隔
+	hashWait           = 5 * time.Second  // 节点落后时等待其应用到目标修订号的时间
+	maxAuditBisections = 64               // 定位分歧时最多比较的次数
+)
+
+// ErrAuditNotConfigured 表示没有配置其他节点的审计地址
+var ErrAuditNotConfigured = errors.New("audit peers are not configured")
+
+// AuditConfig 副本一致性审计的配置
+type AuditConfig struct {
+	Bind     string            // 本节点审计服务的监听地址，为空时不提供服务
+	Peers    map[string]string // 其他节点的 ID 及其审计服务地址
+	Interval time.Duration     // Leader 后台审计的间隔，0 表示只按需审计
+}
+
+// StateHash 是节点的键值状态在某个修订号的摘要
+// 只包含各键在该修订号可见的版本，因此与之后的写入和压缩无关
+type StateHash struct {
+	NodeID          string `json:"nodeId"`
+	Revision        uint64 `json:"revision"`
+	CompactRevision uint64 `json:"compactRevision"` // 节点当前的压缩修订号，早于它的状态无法计算
+	Keys            int    `json:"keys"`
+	Hash            string `json:"hash"` // SHA-256（十六进制）
+}
+
+// AuditNode 是一个节点的审计结果，无法取得摘要时 Error 非空
+type AuditNode struct {
+	NodeID string     `json:"nodeId"`
+	Hash   *StateHash `json:"hash,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// AuditMismatch 描述一个节点与参照节点的分歧
+// 两者在 GoodRevision 时一致，在 BadRevision 时不一致，分歧由 (GoodRevision, BadRevision] 之间的日志引起
+// GoodRevision 为 0 表示在双方保留的历史中没有找到一致的修订号
+type AuditMismatch struct {
+	NodeID          string `json:"nodeId"`
+	ReferenceNodeID string `json:"referenceNodeId"`
+	GoodRevision    uint64 `json:"goodRevision"`
+	BadRevision     uint64 `json:"badRevision"`
+	Error           string `json:"error,omitempty"` // 定位分歧时出现的错误
+}
+
+// AuditReport 是一次一致性审计的结果
+type AuditReport struct {
+	Group      int             `json:"group"` // 审计的 Raft 组，由调用方填写
+	Revision   uint64          `json:"revision"`
+	Consistent bool            `json:"consistent"`
+	Nodes      []AuditNode     `json:"nodes"` // 按节点 ID 排序
+	Mismatches []AuditMismatch `json:"mismatches,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	Duration   string          `json:"duration"`
+}
+
+// AuditArgs 是审计服务的请求
+type AuditArgs struct {
+	Revision uint64
+	Wait     time.Duration // 节点落后时等待的时间
+}
+
+// AuditService 通过 foorpc 向其他节点提供本节点的状态摘要
+type AuditService struct {
+	store *Store
+}
+
+// Hash 返回本节点在 args.Revision 时的状态摘要
+func (a *AuditService) Hash(args AuditArgs, reply *StateHash) error {
+	h, err := a.store.HashKV(args.Revision, args.Wait)
+	if err != nil {
+		return err
+	}
+	*reply = *h
+	return nil
+}
+
+// SetAudit 设置一致性审计，需要在 Open 之前调用
+func (s *Store) SetAudit(cfg AuditConfig) {
+	if cfg.Interval > 0 {
+		cfg.Interval = max(cfg.Interval, minAuditInterval)
+	}
+	s.audit = cfg
+}
+
+// HashKV 计算键值状态在修订号 rev 时的摘要，rev 为 0 表示当前修订号
+// 尚未应用到 rev 时最多等待 wait，超时返回 ErrIndexTimeout，早于压缩修订号时返回 ErrCompacted
+func (s *Store) HashKV(rev uint64, wait time.Duration) (*StateHash, error) {
+	if err := s.WaitForIndex(rev, wait); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rev, err := s.checkRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	var buf []byte
+	keys := 0
+	s.data.Ascend("", func(ki *keyIndex) bool {
+		kv := ki.at(rev)
+		if kv == nil {
+			return true
+		}
+		keys++
+		buf = buf[:0]
+		buf = binary.AppendUvarint(buf, uint64(len(kv.Key)))
+		buf = append(buf, kv.Key...)
+		buf = binary.AppendUvarint(buf, uint64(len(kv.Value)))
+		buf = append(buf, kv.Value...)
+		buf = binary.AppendUvarint(buf, kv.CreateRevision)
+		buf = binary.AppendUvarint(buf, kv.ModRevision)
+		buf = binary.AppendVarint(buf, kv.Version)
+		buf = binary.AppendVarint(buf, kv.ExpireAt)
+		buf = binary.AppendVarint(buf, kv.Lease)
+		h.Write(buf)
+		return true
+	})
+	return &StateHash{
+		NodeID:          s.nodeID,
+		Revision:        rev,
+		CompactRevision: s.compactRevision,
+		Keys:            keys,
+		Hash:            hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// serveAudit 启动审计服务，由 Open 调用
+func (s *Store) serveAudit() error {
+	server := foorpc.NewServer()
+	if err := server.Register(&AuditService{store: s}); err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", s.audit.Bind)
+	if err != nil {
+		return fmt.Errorf("audit listen: %s", err)
+	}
+	s.auditListener = lis
+	go server.Accept(lis)
+	return nil
+}
+
+// AuditAddr 返回本节点审计服务的监听地址，没有启动时返回空字符串
+func (s *Store) AuditAddr() string {
+	if s.auditListener == nil {
+		return ""
+	}
+	return s.auditListener.Addr().String()
+}
+
+// Audit 比较各节点在修订号 rev 时的状态摘要，rev 为 0 表示本节点当前的修订号
+// 出现最多的摘要作为参照（相同时优先本节点），与之不同的节点通过二分查找定位分歧的日志范围
+func (s *Store) Audit(ctx context.Context, rev uint64) (*AuditReport, error) {
+	if len(s.audit.Peers) == 0 {
+		return nil, ErrAuditNotConfigured
+	}
+	start := time.Now()
+	if rev == 0 {
+		rev, _ = s.Revisions()
+	}
+
+	ids := []string{s.nodeID}
+	for id := range s.audit.Peers {
+		if id != s.nodeID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids[1:])
+
+	report := &AuditReport{Revision: rev, Consistent: true, StartedAt: start}
+	counts := make(map[string]int)
+	var ref *StateHash
+	for _, id := range ids {
+		node := AuditNode{NodeID: id}
+		h, err := s.hashOf(ctx, id, rev)
+		if err != nil {
+			node.Error = err.Error()
+			report.Consistent = false
+		} else {
+			node.Hash = h
+			counts[h.Hash]++
+			if ref == nil || counts[h.Hash] > counts[ref.Hash] {
+				ref = h
+			}
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+
+	if ref != nil {
+		for _, node := range report.Nodes {
+			if node.Hash == nil || node.Hash.Hash == ref.Hash {
+				continue
+			}
+			report.Consistent = false
+			report.Mismatches = append(report.Mismatches, s.bisect(ctx, ref, node.Hash))
+		}
+	}
+	sort.Slice(report.Nodes, func(i, j int) bool { return report.Nodes[i].NodeID < report.Nodes[j].NodeID })
+	report.Duration = time.Since(start).String()
+	return report, nil
+}
+
+// bisect 在双方保留的历史中二分查找两个节点最后一致和最先不一致的修订号
+func (s *Store) bisect(ctx context.Context, ref, bad *StateHash) AuditMismatch {
+	m := AuditMismatch{NodeID: bad.NodeID, ReferenceNodeID: ref.NodeID, BadRevision: bad.Revision}
+	lo, hi := max(ref.CompactRevision, bad.CompactRevision), bad.Revision
+
+	// 修订号 0 是空状态，总是一致的
+	if lo > 0 {
+		same, err := s.sameAt(ctx, ref.NodeID, bad.NodeID, lo)
+		if err != nil {
+			m.Error = err.Error()
+			return m
+		}
+		if !same {
+			// 分歧早于双方保留的历史
+			m.BadRevision = lo
+			return m
+		}
+	}
+	for i := 0; hi-lo > 1 && i < maxAuditBisections; i++ {
+		mid := lo + (hi-lo)/2
+		same, err := s.sameAt(ctx, ref.NodeID, bad.NodeID, mid)
+		if err != nil {
+			m.Error = err.Error()
+			break
+		}
+		if same {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	m.GoodRevision, m.BadRevision = lo, hi
+	return m
+}
+
+// sameAt 比较两个节点在修订号 rev 时的状态摘要
+func (s *Store) sameAt(ctx context.Context, a, b string, rev uint64) (bool, error) {
+	ha, err := s.hashOf(ctx, a, rev)
+	if err != nil {
+		return false, err
+	}
+	hb, err := s.hashOf(ctx, b, rev)
+	if err != nil {
+		return false, err
+	}
+	return ha.Hash == hb.Hash, nil
+}
+
+// hashOf 返回节点 id 在修订号 rev 时的状态摘要，本节点直接计算，其他节点通过 foorpc 获取
+func (s *Store) hashOf(ctx context.Context, id string, rev uint64) (*StateHash, error) {
+	if id == s.nodeID {
+		return s.HashKV(rev, hashWait)
+	}
+	addr, ok := s.audit.Peers[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown audit peer %q", id)
+	}
+	client, err := foorpc.Dial("tcp", addr, &foorpc.Option{ConnectTimeout: auditDialTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	defer client.Close()
+	var reply StateHash
+	if err := client.Call(ctx, auditServiceMethod, AuditArgs{Revision: rev, Wait: hashWait}, &reply); err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return &reply, nil
+}
+
+// runAudit 在 Leader 上定期审计各副本的一致性，发现分歧时记录错误日志，直到 Store 关闭
+func (s *Store) runAudit() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.audit.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownCh:
+			return
+		case <-ticker.C:
+			if s.raft.State() != raft.Leader {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+			report, err := s.Audit(ctx, 0)
+			cancel()
+			if err != nil {
+				logger.Warnf("consistency audit failed: %v", err)
+				continue
+			}
+			for _, node := range report.Nodes {
+				if node.Error != "" {
+					logger.Warnf("consistency audit: node %s at revision %d: %s", node.NodeID, report.Revision, node.Error)
+				}
+			}
+			for _, m := range report.Mismatches {
+				logger.Errorf("consistency audit: node %s diverges from %s between revisions (%d, %d] %s",
+					m.NodeID, m.ReferenceNodeID, m.GoodRevision, m.BadRevision, m.Error)
+			}
+		}
+	}
+}
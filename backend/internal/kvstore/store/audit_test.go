@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHashKV_StableAcrossLaterWritesAndCompaction(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	for i := uint64(1); i <= 5; i++ {
+		applyCommand(t, f, i, &command{Op: opSet, Key: fmt.Sprintf("k%d", i%3), Value: fmt.Sprint(i)})
+	}
+	before, err := s.HashKV(5, 0)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+
+	applyCommand(t, f, 6, &command{Op: opSet, Key: "k9", Value: "x"})
+	applyCommand(t, f, 7, &command{Op: opDelete, Key: "k1"})
+	applyCommand(t, f, 8, &command{Op: opCompact, Revision: 5})
+	after, err := s.HashKV(5, 0)
+	if err != nil {
+		t.Fatalf("hash after compaction: %v", err)
+	}
+	if before.Hash != after.Hash || before.Keys != 3 {
+		t.Fatalf("hash at revision 5 changed: %+v -> %+v", before, after)
+	}
+	if cur, _ := s.HashKV(0, 0); cur.Revision != 8 || cur.Hash == before.Hash {
+		t.Fatalf("current hash: %+v", cur)
+	}
+	if _, err := s.HashKV(4, 0); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("hash before compaction: got %v, want %v", err, ErrCompacted)
+	}
+	if _, err := s.HashKV(9, 10*time.Millisecond); !errors.Is(err, ErrIndexTimeout) {
+		t.Fatalf("hash of a future revision: got %v, want %v", err, ErrIndexTimeout)
+	}
+}
+
+func TestAudit_LocatesDivergenceOverRPC(t *testing.T) {
+	local := NewStore(t.TempDir(), "", true)
+	peer := NewStore(t.TempDir(), "", true)
+	local.nodeID, peer.nodeID = "n1", "n2"
+	peer.audit.Bind = "127.0.0.1:0"
+	if err := peer.serveAudit(); err != nil {
+		t.Fatalf("serve audit: %v", err)
+	}
+	defer peer.auditListener.Close()
+	local.audit.Peers = map[string]string{"n2": peer.AuditAddr()}
+
+	lf, pf := newFSM(local), newFSM(peer)
+	for i := uint64(1); i <= 20; i++ {
+		c := &command{Op: opSet, Key: fmt.Sprintf("k%d", i%4), Value: fmt.Sprint(i)}
+		if i == 13 {
+			c.Key = "once"
+		}
+		applyCommand(t, lf, i, c)
+		if i == 13 {
+			// 模拟不确定的状态机：同一条日志在副本上得到不同的结果
+			c = &command{Op: opSet, Key: c.Key, Value: "diverged"}
+		}
+		applyCommand(t, pf, i, c)
+	}
+
+	report, err := local.Audit(context.Background(), 12)
+	if err != nil || !report.Consistent {
+		t.Fatalf("audit before divergence: %+v, %v", report, err)
+	}
+	report, err = local.Audit(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	if report.Consistent || report.Revision != 20 || len(report.Mismatches) != 1 {
+		t.Fatalf("audit report: %+v", report)
+	}
+	m := report.Mismatches[0]
+	if m.NodeID != "n2" || m.ReferenceNodeID != "n1" || m.GoodRevision != 12 || m.BadRevision != 13 || m.Error != "" {
+		t.Fatalf("mismatch: %+v", m)
+	}
+}
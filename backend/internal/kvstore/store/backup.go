@@ -0,0 +1,191 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gotoraft/pkg/logger"
+	"io"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	backupFormat   = "gotoraft-backup"
+	backupVersion  = 1
+	restoreTimeout = time.Minute
+)
+
+// 备份和恢复的错误
+var (
+	ErrInvalidBackup     = errors.New("invalid backup")
+	ErrRestoreInProgress = errors.New("another restore is in progress")
+)
+
+// BackupInfo 是备份文件的头部，描述快照对应的 Raft 位置和校验和
+type BackupInfo struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Index     uint64    `json:"index"` // 快照包含的最后一条日志的索引
+	Term      uint64    `json:"term"`  // 该日志的任期
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`     // 状态数据的字节数
+	Checksum  string    `json:"checksum"` // 状态数据的 SHA-256（十六进制）
+}
+
+// Backup 是一份一致的状态机快照
+// 文件格式为一行 JSON 头部，之后是与 Raft 快照相同格式的状态数据
+type Backup struct {
+	Info  BackupInfo
+	state []byte
+}
+
+// CreateBackup 在当前已应用的位置创建备份
+func (s *Store) CreateBackup() (*Backup, error) {
+	s.mu.RLock()
+	state := s.snapshotState()
+	s.mu.RUnlock()
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return &Backup{
+		Info: BackupInfo{
+			Format:    backupFormat,
+			Version:   backupVersion,
+			Index:     state.Revision,
+			Term:      state.Term,
+			CreatedAt: time.Now().UTC(),
+			Size:      int64(len(b)),
+			Checksum:  hex.EncodeToString(sum[:]),
+		},
+		state: b,
+	}, nil
+}
+
+// WriteTo 将备份写入 w
+func (b *Backup) WriteTo(w io.Writer) (int64, error) {
+	hdr, err := json.Marshal(b.Info)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(hdr, '\n'))
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(b.state)
+	return int64(n + m), err
+}
+
+// ReadBackup 读取并校验备份文件的头部、长度、校验和以及状态数据的格式
+func ReadBackup(r io.Reader) (*Backup, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header: %v", ErrInvalidBackup, err)
+	}
+	var info BackupInfo
+	if err := json.Unmarshal(line, &info); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrInvalidBackup, err)
+	}
+	if info.Format != backupFormat || info.Version != backupVersion {
+		return nil, fmt.Errorf("%w: unsupported format %q version %d", ErrInvalidBackup, info.Format, info.Version)
+	}
+
+	state, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(state)) != info.Size {
+		return nil, fmt.Errorf("%w: size mismatch: header %d, got %d", ErrInvalidBackup, info.Size, len(state))
+	}
+	sum := sha256.Sum256(state)
+	if hex.EncodeToString(sum[:]) != info.Checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidBackup)
+	}
+	var decoded fsmState
+	if err := json.Unmarshal(state, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: malformed state: %v", ErrInvalidBackup, err)
+	}
+	return &Backup{Info: info, state: state}, nil
+}
+
+// RestoreBackup 通过 Raft 安装备份：Leader 先恢复自己的状态机，
+// 再以快照的形式发送给各 Follower，所有副本收敛到备份的状态
+// 恢复前先提交 restore_begin，由状态机保证同一时间只有一个恢复，Leader 变化后的新 Leader 同样会拒绝，
+// 期间的其他恢复返回 ErrRestoreInProgress；恢复完成时状态机清除该标记，恢复失败时提交 restore_abort
+func (s *Store) RestoreBackup(b *Backup) error {
+	if _, err := s.apply(&command{Op: opRestoreBegin, TTL: restoreTimeout}); err != nil {
+		return err
+	}
+
+	state, err := rebaseBackup(b)
+	if err == nil {
+		meta := &raft.SnapshotMeta{
+			Version: raft.SnapshotVersionMax,
+			Index:   b.Info.Index,
+			Term:    b.Info.Term,
+			Size:    int64(len(state)),
+		}
+		err = s.raft.Restore(meta, bytes.NewReader(state), restoreTimeout)
+	}
+	if err != nil {
+		if _, abortErr := s.apply(&command{Op: opRestoreAbort}); abortErr != nil {
+			logger.Errorf("failed to clear the restore guard: %v", abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// rebaseBackup 返回标记为需要变基的备份状态，修订号由各副本安装快照时决定，见 rebaseState
+func rebaseBackup(b *Backup) ([]byte, error) {
+	var state fsmState
+	if err := json.Unmarshal(b.state, &state); err != nil {
+		return nil, fmt.Errorf("%w: malformed state: %v", ErrInvalidBackup, err)
+	}
+	state.Rebase = true
+	state.RestoreUntil = 0
+	return json.Marshal(&state)
+}
+
+// rebaseState 把备份恢复安装的状态的修订号和任期设为快照的索引和任期
+// Raft 以 max(最后的日志索引, 备份的索引)+1 作为恢复的快照索引，它大于恢复前应用的所有日志，
+// 恢复后的修订号、监听的起始修订号和 X-Raft-Index 都不会比恢复前小；
+// 恢复、安装 Leader 发来的快照和启动时加载的都是最新的快照，所有副本得到相同的修订号
+func (s *Store) rebaseState(state *fsmState) error {
+	metas, err := s.snapshots.List()
+	if err != nil {
+		return err
+	}
+	if len(metas) == 0 {
+		return fmt.Errorf("%w: no snapshot to rebase onto", ErrInvalidBackup)
+	}
+	state.Revision = metas[0].Index
+	state.Term = metas[0].Term
+	state.Rebase = false
+	return nil
+}
+
+// applyRestoreBegin 标记恢复开始，已有未过期的标记时返回 ErrRestoreInProgress，调用方需持有写锁
+// 标记按日志时间在 TTL 之后过期，发起恢复的 Leader 崩溃时不会一直阻止之后的恢复
+func (s *Store) applyRestoreBegin(c *command, now int64) *applyResult {
+	if s.restoreUntil > now {
+		return &applyResult{err: ErrRestoreInProgress}
+	}
+	s.restoreUntil = now + c.TTL.Milliseconds()
+	return &applyResult{}
+}
+
+// applyRestoreAbort 清除恢复标记，调用方需持有写锁
+func (s *Store) applyRestoreAbort() *applyResult {
+	s.restoreUntil = 0
+	return &applyResult{}
+}
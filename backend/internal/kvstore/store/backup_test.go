@@ -0,0 +1,139 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStore_BackupRestore(t *testing.T) {
+	s := openSingleNode(t)
+
+	if _, err := s.Put("a", "1", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := s.Put("b", "2", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	backup, err := s.CreateBackup()
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if backup.Info.Index == 0 || backup.Info.Term == 0 {
+		t.Fatalf("backup should record raft index and term: %+v", backup.Info)
+	}
+	var buf bytes.Buffer
+	if _, err := backup.WriteTo(&buf); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+	file := buf.Bytes()
+
+	if _, err := s.Put("a", "changed", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := s.Delete("b"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	loaded, err := ReadBackup(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("read backup: %v", err)
+	}
+	before, _ := s.Revisions()
+	if err := s.RestoreBackup(loaded); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	// 修订号移到恢复所在的日志索引，不会回到备份时的修订号
+	after, _ := s.Revisions()
+	if after <= before {
+		t.Fatalf("revision went back from %d to %d after restore", before, after)
+	}
+	if metas, err := s.snapshots.List(); err != nil || len(metas) == 0 || metas[0].Index != after {
+		t.Fatalf("revision %d is not the index of the restored snapshot: %v, %v", after, metas, err)
+	}
+	if v, err := s.Get("a", Linearizable); err != nil || v != "1" {
+		t.Fatalf("a after restore: %q, %v", v, err)
+	}
+	if v, err := s.Get("b", Linearizable); err != nil || v != "2" {
+		t.Fatalf("b after restore: %q, %v", v, err)
+	}
+
+	// 恢复之后仍然可以正常写入
+	if kv, err := s.Put("c", "3", PutOptions{}); err != nil || kv.ModRevision <= after {
+		t.Fatalf("set after restore: %+v, %v", kv, err)
+	}
+}
+
+func TestReadBackup_RejectsCorruption(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v"})
+
+	backup, err := s.CreateBackup()
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	var buf bytes.Buffer
+	backup.WriteTo(&buf)
+
+	corrupted := bytes.Replace(buf.Bytes(), []byte(`"value":"v"`), []byte(`"value":"x"`), 1)
+	if _, err := ReadBackup(bytes.NewReader(corrupted)); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("corrupted backup: got %v, want %v", err, ErrInvalidBackup)
+	}
+	truncated := buf.Bytes()[:buf.Len()-1]
+	if _, err := ReadBackup(bytes.NewReader(truncated)); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("truncated backup: got %v, want %v", err, ErrInvalidBackup)
+	}
+}
+
+func TestStore_RestoreGuard(t *testing.T) {
+	s := openSingleNode(t)
+	backup, err := s.CreateBackup()
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+
+	// 另一个节点（例如之前的 Leader）发起的恢复还在进行
+	if _, err := s.apply(&command{Op: opRestoreBegin, TTL: restoreTimeout}); err != nil {
+		t.Fatalf("begin restore: %v", err)
+	}
+	if err := s.RestoreBackup(backup); !errors.Is(err, ErrRestoreInProgress) {
+		t.Fatalf("concurrent restore: got %v, want %v", err, ErrRestoreInProgress)
+	}
+	if _, err := s.apply(&command{Op: opRestoreAbort}); err != nil {
+		t.Fatalf("abort restore: %v", err)
+	}
+	if err := s.RestoreBackup(backup); err != nil {
+		t.Fatalf("restore after abort: %v", err)
+	}
+	// 完成的恢复清除标记
+	if err := s.RestoreBackup(backup); err != nil {
+		t.Fatalf("second restore: %v", err)
+	}
+}
+
+func TestFSM_RestoreGuardExpires(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	if res := applyCommand(t, f, 1, &command{Op: opRestoreBegin, TTL: 10 * time.Second}); res.err != nil {
+		t.Fatalf("begin: %v", res.err)
+	}
+	// 标记在快照中保存，安装快照的 Follower 同样拒绝
+	var sink memorySink
+	snap, _ := f.Snapshot()
+	snap.Persist(&sink)
+	follower := NewStore(t.TempDir(), "", true)
+	ff := newFSM(follower)
+	if err := ff.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore snapshot: %v", err)
+	}
+	if res := applyCommand(t, ff, 2, &command{Op: opRestoreBegin, TTL: 10 * time.Second}); !errors.Is(res.err, ErrRestoreInProgress) {
+		t.Fatalf("begin on follower: got %v, want %v", res.err, ErrRestoreInProgress)
+	}
+	// applyCommand 的日志时间每个索引加一秒
+	if res := applyCommand(t, f, 11, &command{Op: opRestoreBegin, TTL: 10 * time.Second}); res.err != nil {
+		t.Fatalf("begin after expiry: %v", res.err)
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxBatchSize 批量写入默认最多包含的操作数
+const DefaultMaxBatchSize = 1000
+
+// 批量写入的错误
+var (
+	ErrInvalidBatch  = errors.New("invalid batch")
+	ErrBatchTooLarge = errors.New("batch exceeds the maximum number of ops")
+)
+
+// SetMaxBatchSize 设置批量写入最多包含的操作数
+func (s *Store) SetMaxBatchSize(n int) {
+	if n > 0 {
+		s.maxBatchSize = n
+	}
+}
+
+// Batch 将一组 put 和 delete 作为一条日志原子地应用，要么全部生效要么全部不生效
+// 返回的结果与 ops 一一对应
+func (s *Store) Batch(ops []Op, wopts ...WriteOption) (*TxnResult, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("%w: no ops", ErrInvalidBatch)
+	}
+	if len(ops) > s.maxBatchSize {
+		return nil, fmt.Errorf("%w: %d > %d", ErrBatchTooLarge, len(ops), s.maxBatchSize)
+	}
+	for i, op := range ops {
+		if op.Key == "" {
+			return nil, fmt.Errorf("%w: op %d: key is required", ErrInvalidBatch, i)
+		}
+		if op.Type != OpPut && op.Type != OpDelete {
+			return nil, fmt.Errorf("%w: op %d: unsupported op type %q", ErrInvalidBatch, i, op.Type)
+		}
+	}
+	return s.Txn(&Txn{Success: ops}, wopts...)
+}
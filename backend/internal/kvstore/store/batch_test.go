@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStore_Batch(t *testing.T) {
+	s := openSingleNode(t)
+	s.SetMaxBatchSize(3)
+
+	if _, err := s.Put("old", "x", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	res, err := s.Batch([]Op{
+		{Type: OpPut, Key: "a", Value: "1"},
+		{Type: OpPut, Key: "b", Value: "2"},
+		{Type: OpDelete, Key: "old"},
+	})
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	if len(res.Results) != 3 {
+		t.Fatalf("results: %+v", res.Results)
+	}
+	for _, r := range res.Results[:2] {
+		if r.KV == nil || r.KV.ModRevision != res.Revision {
+			t.Fatalf("all ops should share the batch revision %d: %+v", res.Revision, r.KV)
+		}
+	}
+	if del := res.Results[2]; del.KV == nil || del.KV.Value != "x" {
+		t.Fatalf("delete result should carry the deleted value: %+v", del.KV)
+	}
+	if _, err := s.Get("old", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("deleted key: got %v", err)
+	}
+
+	tooLarge := make([]Op, 4)
+	for i := range tooLarge {
+		tooLarge[i] = Op{Type: OpPut, Key: "k", Value: "v"}
+	}
+	if _, err := s.Batch(tooLarge); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("oversized batch: got %v, want %v", err, ErrBatchTooLarge)
+	}
+	if _, err := s.Batch([]Op{{Type: OpGet, Key: "a"}}); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("get in batch: got %v, want %v", err, ErrInvalidBatch)
+	}
+
+	// 任何一个操作失败时整个批量都不生效
+	_, err = s.Batch([]Op{
+		{Type: OpPut, Key: "c", Value: "3"},
+		{Type: OpPut, Key: "d", Value: "4", Lease: 12345},
+	})
+	if !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("batch with unknown lease: got %v, want %v", err, ErrLeaseNotFound)
+	}
+	if _, err := s.Get("c", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("failed batch should not write, got %v", err)
+	}
+}
@@ -0,0 +1,408 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gotoraft/pkg/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	cdcFilePrefix = "cdc-"
+	cdcFileSuffix = ".jsonl"
+
+	DefaultCDCMaxFileSize = 64 << 20 // 单个变更文件的默认大小上限
+	DefaultCDCMaxFiles    = 16       // 默认保留的变更文件数
+)
+
+// 变更数据捕获的错误
+var (
+	ErrCDCDisabled = errors.New("change data capture is not enabled on this node")
+	ErrCDCPurged   = errors.New("requested index has been purged from the change log")
+)
+
+// OpRestore 是状态机从快照恢复时写入的变更记录的操作类型
+// 快照覆盖的日志不会逐条出现在变更记录中，消费者需要从该位置重新同步全量数据
+const OpRestore = "restore"
+
+// CDCConfig 变更数据捕获的配置
+type CDCConfig struct {
+	Dir         string // 变更文件所在的目录，为空时不记录
+	MaxFileSize int64  // 单个文件超过该大小后轮转
+	MaxFiles    int    // 保留的文件数，超出时删除最旧的文件
+}
+
+// ChangeRecord 是一条已应用的日志及其产生的键变更，变更文件中每行一条
+type ChangeRecord struct {
+	Index     uint64          `json:"index"`
+	Term      uint64          `json:"term"`
+	Timestamp int64           `json:"timestamp"` // 日志时间（Unix 毫秒），由 Leader 追加日志时确定
+	Op        string          `json:"op"`
+	Command   json.RawMessage `json:"command,omitempty"` // 日志中的原始命令
+	Changes   []Event         `json:"changes,omitempty"` // 命令产生的键变更，按应用顺序
+	Error     string          `json:"error,omitempty"`   // 命令在状态机中失败的原因，失败的命令不产生变更
+}
+
+// changeLog 将变更记录追加到按首条记录的索引命名的 JSONL 文件中
+type changeLog struct {
+	cfg CDCConfig
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	lastIndex uint64        // 已记录的最大索引，重放时跳过不晚于它的日志
+	appended  chan struct{} // 每次追加后关闭并替换，用于唤醒跟随读取的消费者
+}
+
+// SetCDC 设置变更数据捕获，需要在 Open 之前调用
+func (s *Store) SetCDC(cfg CDCConfig) {
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = DefaultCDCMaxFileSize
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultCDCMaxFiles
+	}
+	s.cdcConfig = cfg
+}
+
+// openChangeLog 打开目录中最新的变更文件，不存在时在第一次追加时创建
+func openChangeLog(cfg CDCConfig) (*changeLog, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &changeLog{cfg: cfg, appended: make(chan struct{})}
+	files, err := l.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return l, nil
+	}
+	path := files[len(files)-1].path
+	last, size, err := lastRecord(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.file, l.size, l.lastIndex = f, size, last
+	if last == 0 {
+		l.lastIndex = files[len(files)-1].first - 1
+	}
+	return l, nil
+}
+
+// lastRecord 返回文件中最后一条完整记录的索引，并截掉崩溃时写了一半的记录
+func lastRecord(path string) (uint64, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end < len(data) {
+		if err := os.Truncate(path, int64(end)); err != nil {
+			return 0, 0, err
+		}
+	}
+	var last uint64
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		var rec struct {
+			Index uint64 `json:"index"`
+		}
+		if len(line) > 0 && json.Unmarshal(line, &rec) == nil {
+			last = rec.Index
+		}
+	}
+	return last, int64(end), nil
+}
+
+// cdcFile 是一个变更文件及其首条记录的索引
+type cdcFile struct {
+	path  string
+	first uint64
+}
+
+// files 返回目录中的变更文件，按首条记录的索引升序
+func (l *changeLog) files() ([]cdcFile, error) {
+	entries, err := os.ReadDir(l.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []cdcFile
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, cdcFilePrefix) || !strings.HasSuffix(name, cdcFileSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, cdcFilePrefix), cdcFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, cdcFile{path: filepath.Join(l.cfg.Dir, name), first: first})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].first < files[j].first })
+	return files, nil
+}
+
+// append 追加一条记录，不晚于已记录索引的记录被忽略
+func (l *changeLog) append(rec *ChangeRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rec.Index <= l.lastIndex {
+		return nil
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if l.file == nil || l.size >= l.cfg.MaxFileSize {
+		if err := l.rotate(rec.Index); err != nil {
+			return err
+		}
+	}
+	// 整行一次写入，跟随读取的消费者不会读到半条记录之后的内容
+	if _, err := l.file.Write(line); err != nil {
+		return err
+	}
+	l.size += int64(len(line))
+	l.lastIndex = rec.Index
+	close(l.appended)
+	l.appended = make(chan struct{})
+	return nil
+}
+
+// rotate 关闭当前文件，创建以 first 命名的新文件，并删除超出保留数量的旧文件，调用方需持有 l.mu
+func (l *changeLog) rotate(first uint64) error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+	}
+	name := fmt.Sprintf("%s%020d%s", cdcFilePrefix, first, cdcFileSuffix)
+	f, err := os.OpenFile(filepath.Join(l.cfg.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	l.file, l.size = f, 0
+
+	files, err := l.files()
+	if err != nil {
+		return err
+	}
+	for len(files) > l.cfg.MaxFiles {
+		if err := os.Remove(files[0].path); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+func (l *changeLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// recordChange 将一条已应用的日志写入变更文件，调用方需持有写锁
+func (s *Store) recordChange(log *raft.Log, op string, res *applyResult) {
+	changes := s.cdcChanges
+	s.cdcChanges = nil
+	if s.cdc == nil {
+		return
+	}
+	rec := &ChangeRecord{
+		Index:     log.Index,
+		Term:      log.Term,
+		Timestamp: logTime(log),
+		Op:        op,
+		Command:   json.RawMessage(log.Data),
+		Changes:   changes,
+	}
+	if res != nil && res.err != nil {
+		rec.Error = res.err.Error()
+	}
+	if err := s.cdc.append(rec); err != nil {
+		logger.Errorf("failed to record change at index %d: %v", log.Index, err)
+	}
+}
+
+// recordRestore 记录状态机从快照恢复，调用方需持有写锁
+func (s *Store) recordRestore() {
+	s.cdcChanges = nil
+	if s.cdc == nil {
+		return
+	}
+	rec := &ChangeRecord{Index: s.revision, Term: s.term, Op: OpRestore}
+	if err := s.cdc.append(rec); err != nil {
+		logger.Errorf("failed to record restore at index %d: %v", s.revision, err)
+	}
+}
+
+// captureChange 收集 Apply 中产生的键变更，调用方需持有写锁
+func (s *Store) captureChange(ev Event) {
+	if s.cdc != nil {
+		s.cdcChanges = append(s.cdcChanges, ev)
+	}
+}
+
+// ChangeReader 从变更文件中按索引顺序读取记录
+type ChangeReader struct {
+	log    *changeLog
+	next   uint64 // 下一条需要的记录的最小索引
+	follow bool
+
+	file    *os.File
+	first   uint64 // 当前文件首条记录的索引
+	r       *bufio.Reader
+	partial []byte // 当前文件末尾尚未写完的记录
+}
+
+// Changes 返回从索引 from 开始的变更记录，from 为 0 时从保留的最旧记录开始
+// follow 为 true 时读完已有记录后继续等待新的记录，from 早于保留的最旧记录时返回 ErrCDCPurged
+func (s *Store) Changes(from uint64, follow bool) (*ChangeReader, error) {
+	if s.cdc == nil {
+		return nil, ErrCDCDisabled
+	}
+	files, err := s.cdc.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 && from > 0 && from < files[0].first {
+		return nil, fmt.Errorf("%w: oldest retained index is %d", ErrCDCPurged, files[0].first)
+	}
+	return &ChangeReader{log: s.cdc, next: from, follow: follow}, nil
+}
+
+// Next 返回下一条记录，没有更多记录时返回 io.EOF，follow 模式下等待直到 ctx 结束
+func (r *ChangeReader) Next(ctx context.Context) (*ChangeRecord, error) {
+	for {
+		r.log.mu.Lock()
+		appended := r.log.appended
+		r.log.mu.Unlock()
+
+		if rec, err := r.read(); err != nil || rec != nil {
+			return rec, err
+		}
+		target, err := r.nextFile()
+		if err != nil {
+			return nil, err
+		}
+		if target != nil {
+			if r.file != nil {
+				// 新文件出现之后当前文件不会再有写入，先读完其中剩余的记录
+				if rec, err := r.read(); err != nil || rec != nil {
+					return rec, err
+				}
+				r.file.Close()
+			}
+			if err := r.open(*target); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !r.follow {
+			return nil, io.EOF
+		}
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// read 从当前文件读取下一条不早于 next 的记录，读到文件末尾时返回 nil
+func (r *ChangeReader) read() (*ChangeRecord, error) {
+	if r.r == nil {
+		return nil, nil
+	}
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if err == io.EOF {
+			r.partial = append(r.partial, line...)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(r.partial) > 0 {
+			line = append(r.partial, line...)
+			r.partial = nil
+		}
+		var rec ChangeRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("corrupt change record in %s: %v", r.file.Name(), err)
+		}
+		if rec.Index < r.next {
+			continue
+		}
+		r.next = rec.Index + 1
+		return &rec, nil
+	}
+}
+
+// nextFile 返回接下来需要读取的文件，即当前文件之后首条索引不大于 next 的最后一个文件，没有时返回 nil
+func (r *ChangeReader) nextFile() (*cdcFile, error) {
+	files, err := r.log.files()
+	if err != nil {
+		return nil, err
+	}
+	var target *cdcFile
+	for i := range files {
+		f := &files[i]
+		if r.file != nil && f.first <= r.first {
+			continue
+		}
+		if target == nil || f.first <= r.next {
+			target = f
+		}
+		if f.first > r.next {
+			break
+		}
+	}
+	return target, nil
+}
+
+// open 打开变更文件，文件已被轮转删除时返回 ErrCDCPurged
+func (r *ChangeReader) open(target cdcFile) error {
+	f, err := os.Open(target.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s was removed", ErrCDCPurged, filepath.Base(target.path))
+		}
+		return err
+	}
+	r.file, r.first, r.r, r.partial = f, target.first, bufio.NewReader(f), nil
+	return nil
+}
+
+// Close 关闭读取器
+func (r *ChangeReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newCDCStore 创建一个在 dir 中记录变更的 Store，不启动 Raft
+func newCDCStore(t *testing.T, cfg CDCConfig) *Store {
+	t.Helper()
+	s := NewStore(t.TempDir(), "", true)
+	s.SetCDC(cfg)
+	cdc, err := openChangeLog(s.cdcConfig)
+	if err != nil {
+		t.Fatalf("open change log: %v", err)
+	}
+	s.cdc = cdc
+	t.Cleanup(func() { cdc.close() })
+	return s
+}
+
+func readChanges(t *testing.T, s *Store, from uint64) []*ChangeRecord {
+	t.Helper()
+	r, err := s.Changes(from, false)
+	if err != nil {
+		t.Fatalf("changes: %v", err)
+	}
+	defer r.Close()
+	var recs []*ChangeRecord
+	for {
+		rec, err := r.Next(context.Background())
+		if err == io.EOF {
+			return recs
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func TestCDC_RecordsAppliedCommandsAndRotates(t *testing.T) {
+	dir := t.TempDir()
+	s := newCDCStore(t, CDCConfig{Dir: dir, MaxFileSize: 300, MaxFiles: 3})
+	f := newFSM(s)
+	for i := uint64(1); i <= 20; i++ {
+		applyCommand(t, f, i, &command{Op: opSet, Key: fmt.Sprintf("k%d", i%3), Value: fmt.Sprint(i)})
+	}
+	applyCommand(t, f, 21, &command{Op: opSetIfAbsent, Key: "k1", Value: "x"})
+	applyCommand(t, f, 22, &command{Op: opTxn, Txn: &Txn{Success: []Op{
+		{Type: OpDelete, Key: "k1"},
+		{Type: OpPut, Key: "k2", Value: "y"},
+	}}})
+
+	files, _ := s.cdc.files()
+	if len(files) != 3 {
+		t.Fatalf("files after rotation: %d, want 3", len(files))
+	}
+	oldest := files[0].first
+	if _, err := s.Changes(oldest-1, false); !errors.Is(err, ErrCDCPurged) {
+		t.Fatalf("purged index: got %v, want %v", err, ErrCDCPurged)
+	}
+
+	recs := readChanges(t, s, 21)
+	if len(recs) != 2 {
+		t.Fatalf("records from 21: %d, want 2", len(recs))
+	}
+	if rec := recs[0]; rec.Op != opSetIfAbsent || rec.Error == "" || len(rec.Changes) != 0 {
+		t.Fatalf("failed command: %+v", rec)
+	}
+	txn := recs[1]
+	if txn.Index != 22 || txn.Timestamp != testEpoch.Add(22*time.Second).UnixMilli() || len(txn.Changes) != 2 ||
+		txn.Changes[0].Type != EventDelete || txn.Changes[1].KV.Value != "y" {
+		t.Fatalf("txn record: %+v", txn)
+	}
+
+	all := readChanges(t, s, 0)
+	for i, rec := range all {
+		if rec.Index != oldest+uint64(i) {
+			t.Fatalf("record %d has index %d, want %d", i, rec.Index, oldest+uint64(i))
+		}
+	}
+	if all[len(all)-1].Index != 22 {
+		t.Fatalf("last record: %d", all[len(all)-1].Index)
+	}
+}
+
+func TestCDC_ResumeAfterRestartSkipsRecordedIndexes(t *testing.T) {
+	dir := t.TempDir()
+	s := newCDCStore(t, CDCConfig{Dir: dir})
+	f := newFSM(s)
+	for i := uint64(1); i <= 5; i++ {
+		applyCommand(t, f, i, &command{Op: opSet, Key: "k", Value: fmt.Sprint(i)})
+	}
+	s.cdc.close()
+
+	// 模拟写了一半时崩溃
+	files, _ := s.cdc.files()
+	fh, _ := os.OpenFile(files[0].path, os.O_WRONLY|os.O_APPEND, 0)
+	fh.WriteString(`{"index":6,"te`)
+	fh.Close()
+
+	// 内存模式重启后从头重放日志
+	s = newCDCStore(t, CDCConfig{Dir: dir})
+	f = newFSM(s)
+	for i := uint64(1); i <= 7; i++ {
+		applyCommand(t, f, i, &command{Op: opSet, Key: "k", Value: fmt.Sprint(i)})
+	}
+	recs := readChanges(t, s, 4)
+	if len(recs) != 4 {
+		t.Fatalf("records from 4: %d, want 4", len(recs))
+	}
+	for i, rec := range recs {
+		if rec.Index != uint64(4+i) {
+			t.Fatalf("record %d has index %d", i, rec.Index)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 || filepath.Ext(entries[0].Name()) != ".jsonl" {
+		t.Fatalf("unexpected files: %v", entries)
+	}
+}
+
+func TestCDC_FollowWaitsForNewRecords(t *testing.T) {
+	s := newCDCStore(t, CDCConfig{Dir: t.TempDir(), MaxFileSize: 200})
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "a", Value: "1"})
+
+	r, err := s.Changes(1, true)
+	if err != nil {
+		t.Fatalf("changes: %v", err)
+	}
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	got := make(chan uint64)
+	go func() {
+		for {
+			rec, err := r.Next(ctx)
+			if err != nil {
+				close(got)
+				return
+			}
+			got <- rec.Index
+		}
+	}()
+	if idx := <-got; idx != 1 {
+		t.Fatalf("first record: %d", idx)
+	}
+	// 跟随读取跨越文件轮转
+	for i := uint64(2); i <= 6; i++ {
+		applyCommand(t, f, i, &command{Op: opSet, Key: "a", Value: fmt.Sprint(i)})
+		if idx := <-got; idx != i {
+			t.Fatalf("followed record: %d, want %d", idx, i)
+		}
+	}
+	if files, _ := s.cdc.files(); len(files) < 2 {
+		t.Fatalf("change log should have rotated, %d files", len(files))
+	}
+}
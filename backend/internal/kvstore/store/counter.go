@@ -0,0 +1,76 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// 计数器的错误
+var (
+	ErrNotANumber        = errors.New("value is not an integer")
+	ErrCounterOutOfRange = errors.New("counter would leave its allowed range")
+)
+
+// IncrOptions 自增操作的可选参数
+type IncrOptions struct {
+	Min *int64        // 结果的下界（含），nil 表示不限制
+	Max *int64        // 结果的上界（含），nil 表示不限制
+	TTL time.Duration // 键不存在时新建计数器的存活时间，已存在的计数器保留原有的 TTL 和租约
+}
+
+// Increment 将键的整数值原子地加上 delta（可以为负）并返回新值，不存在的键视为 0
+// 当前值不是整数时返回 ErrNotANumber，结果越界或溢出时返回 ErrCounterOutOfRange，两者都不修改键
+func (s *Store) Increment(key string, delta int64, opts IncrOptions, wopts ...WriteOption) (*KeyValue, error) {
+	if opts.Min != nil && opts.Max != nil && *opts.Min > *opts.Max {
+		return nil, fmt.Errorf("%w: min %d is greater than max %d", ErrCounterOutOfRange, *opts.Min, *opts.Max)
+	}
+	res, err := s.apply(&command{
+		Op:    opIncr,
+		Key:   key,
+		Delta: delta,
+		Min:   opts.Min,
+		Max:   opts.Max,
+		TTL:   opts.TTL,
+	}, wopts...)
+	if res == nil {
+		return nil, err
+	}
+	return res.kv, err
+}
+
+// applyIncr 在状态机中执行自增，调用方需持有写锁
+func (s *Store) applyIncr(c *command, index uint64, expireAt int64) *applyResult {
+	var n int64
+	cur, ok := s.current(c.Key)
+	if ok {
+		v, err := strconv.ParseInt(cur.Value, 10, 64)
+		if err != nil {
+			return &applyResult{kv: cur, err: fmt.Errorf("%w: %q", ErrNotANumber, cur.Value)}
+		}
+		n = v
+	}
+
+	if (c.Delta > 0 && n > math.MaxInt64-c.Delta) || (c.Delta < 0 && n < math.MinInt64-c.Delta) {
+		return &applyResult{kv: cur, err: fmt.Errorf("%w: overflow", ErrCounterOutOfRange)}
+	}
+	n += c.Delta
+	if c.Min != nil && n < *c.Min {
+		return &applyResult{kv: cur, err: fmt.Errorf("%w: %d < min %d", ErrCounterOutOfRange, n, *c.Min)}
+	}
+	if c.Max != nil && n > *c.Max {
+		return &applyResult{kv: cur, err: fmt.Errorf("%w: %d > max %d", ErrCounterOutOfRange, n, *c.Max)}
+	}
+
+	value := strconv.FormatInt(n, 10)
+	if err := s.checkQuota(pendingWrite{key: c.Key, value: value}); err != nil {
+		return &applyResult{kv: cur, err: err}
+	}
+	var lease int64
+	if ok {
+		expireAt, lease = cur.ExpireAt, cur.Lease
+	}
+	return &applyResult{kv: s.put(c.Key, value, index, expireAt, lease)}
+}
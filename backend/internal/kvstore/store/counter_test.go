@@ -0,0 +1,51 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func int64Ptr(n int64) *int64 { return &n }
+
+func TestFSM_Increment(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	res := applyCommand(t, f, 1, &command{Op: opIncr, Key: "n", Delta: 5, TTL: time.Minute})
+	if res.err != nil || res.kv.Value != "5" || res.kv.ExpireAt == 0 {
+		t.Fatalf("incr missing key: %+v, %v", res.kv, res.err)
+	}
+	expire := res.kv.ExpireAt
+
+	res = applyCommand(t, f, 2, &command{Op: opIncr, Key: "n", Delta: -3})
+	if res.err != nil || res.kv.Value != "2" || res.kv.Version != 2 {
+		t.Fatalf("decrement: %+v, %v", res.kv, res.err)
+	}
+	if res.kv.ExpireAt != expire {
+		t.Fatalf("increment should keep the counter ttl: got %d, want %d", res.kv.ExpireAt, expire)
+	}
+
+	res = applyCommand(t, f, 3, &command{Op: opIncr, Key: "n", Delta: -3, Min: int64Ptr(0)})
+	if !errors.Is(res.err, ErrCounterOutOfRange) || res.kv.Value != "2" {
+		t.Fatalf("below min: %+v, %v", res.kv, res.err)
+	}
+	res = applyCommand(t, f, 4, &command{Op: opIncr, Key: "n", Delta: 1, Max: int64Ptr(2)})
+	if !errors.Is(res.err, ErrCounterOutOfRange) {
+		t.Fatalf("above max: got %v, want %v", res.err, ErrCounterOutOfRange)
+	}
+
+	applyCommand(t, f, 5, &command{Op: opSet, Key: "s", Value: "abc"})
+	res = applyCommand(t, f, 6, &command{Op: opIncr, Key: "s", Delta: 1})
+	if !errors.Is(res.err, ErrNotANumber) {
+		t.Fatalf("non-numeric: got %v, want %v", res.err, ErrNotANumber)
+	}
+	if v, _ := s.Get("s", Stale); v != "abc" {
+		t.Fatalf("non-numeric value should be unchanged, got %q", v)
+	}
+
+	applyCommand(t, f, 7, &command{Op: opSet, Key: "big", Value: "9223372036854775807"})
+	if res := applyCommand(t, f, 8, &command{Op: opIncr, Key: "big", Delta: 1}); !errors.Is(res.err, ErrCounterOutOfRange) {
+		t.Fatalf("overflow: got %v, want %v", res.err, ErrCounterOutOfRange)
+	}
+}
@@ -0,0 +1,408 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/raft"
+)
+
+// 静态加密：Raft 日志和状态文件的每条记录、Raft 快照使用 AES-256-GCM 加密
+//
+// 密钥文件每行一个密钥，格式为 "<密钥 ID>:<32 字节密钥的 hex 或 base64>"，空行和 # 开头的行被忽略，
+// 最后一个密钥用于加密，其余的只用于解密。加密的数据带有密钥 ID，轮换密钥时在文件末尾追加新密钥并重启，
+// 之后用 gotoraft reencrypt 离线重新加密旧数据，再从文件中删除旧密钥。
+// 稳定存储只保存任期和投票，不加密
+
+// sealedMagic 加密数据的前缀，明文的日志和状态文件记录以非零的记录类型开头，快照以 '{' 开头，不会与之冲突
+const sealedMagic = "\x00GTE"
+
+var (
+	// ErrEncryptionKeyMissing 数据已加密，但没有配置密钥文件或密钥文件中没有对应 ID 的密钥
+	ErrEncryptionKeyMissing = errors.New("encryption key missing")
+	// ErrEncryptionKeyMismatch 解密失败，密钥与加密时使用的不同或数据被篡改
+	ErrEncryptionKeyMismatch = errors.New("wrong encryption key or corrupted data")
+	// ErrNotEncrypted 配置了密钥文件，但数据是明文
+	ErrNotEncrypted = errors.New("data is not encrypted, run `gotoraft reencrypt` first")
+)
+
+// SetKeyFile 设置静态加密的密钥文件，为空表示不加密，需要在 Open 之前调用
+func (s *Store) SetKeyFile(path string) {
+	s.keyFile = path
+}
+
+// Keyring 是从密钥文件加载的密钥
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// LoadKeyring 读取密钥文件
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(text, ":")
+		if !ok || id == "" || len(id) > 255 || strings.ContainsAny(id, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected <key id>:<key>", path, line)
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("%s:%d: duplicate key id %q", path, line, id)
+		}
+		key, err := decodeKey(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: key %q: %s", path, line, id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if k.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		k.active = id
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if k.active == "" {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return k, nil
+}
+
+// decodeKey 解码 hex 或 base64 编码的 32 字节密钥
+func decodeKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("not hex or base64")
+		}
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("got %d bytes, want 32", len(key))
+	}
+	return key, nil
+}
+
+// ActiveKey 返回用于加密的密钥 ID
+func (k *Keyring) ActiveKey() string {
+	return k.active
+}
+
+// seal 用当前密钥加密 plain，k 为 nil 时原样返回
+// 格式为 magic、1 字节密钥 ID 长度、密钥 ID、nonce、密文，magic 和密钥 ID 作为附加数据参与认证
+// 无法生成随机 nonce 时返回错误，调用方按写入失败处理
+func (k *Keyring) seal(plain []byte) ([]byte, error) {
+	if k == nil {
+		return plain, nil
+	}
+	aead := k.keys[k.active]
+	hdr := make([]byte, 0, len(sealedMagic)+1+len(k.active)+aead.NonceSize())
+	hdr = append(hdr, sealedMagic...)
+	hdr = append(hdr, byte(len(k.active)))
+	hdr = append(hdr, k.active...)
+	nonce := make([]byte, aead.NonceSize())
+	// 通过 rand.Reader 读取，较新的 Go 版本中 rand.Read 失败时直接终止进程
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("read random nonce: %w", err)
+	}
+	out := append(hdr, nonce...)
+	return aead.Seal(out, nonce, plain, hdr), nil
+}
+
+// open 解密 seal 的输出
+// 数据未加密时：k 为 nil 则原样返回，否则返回 ErrNotEncrypted；数据已加密而 k 为 nil 时返回 ErrEncryptionKeyMissing
+func (k *Keyring) open(b []byte) ([]byte, error) {
+	if !isSealed(b) {
+		if k != nil {
+			return nil, ErrNotEncrypted
+		}
+		return b, nil
+	}
+	rest := b[len(sealedMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, ErrEncryptionKeyMismatch
+	}
+	id := string(rest[1 : 1+rest[0]])
+	if k == nil {
+		return nil, fmt.Errorf("data is encrypted with key %q but no key file is configured: %w", id, ErrEncryptionKeyMissing)
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not in the key file: %w", id, ErrEncryptionKeyMissing)
+	}
+	hdrLen := len(sealedMagic) + 1 + len(id)
+	if len(b) < hdrLen+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrEncryptionKeyMismatch
+	}
+	nonce := b[hdrLen : hdrLen+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, b[hdrLen+aead.NonceSize():], b[:hdrLen])
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, ErrEncryptionKeyMismatch)
+	}
+	return plain, nil
+}
+
+func isSealed(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(sealedMagic))
+}
+
+// sealedSnapshotStore 加密写入的 Raft 快照，读取时解密
+// 快照在内存中整体加密，与状态机本身在内存中的大小相当
+type sealedSnapshotStore struct {
+	raft.SnapshotStore
+	keys *Keyring
+}
+
+// Create 实现 raft.SnapshotStore
+func (ss *sealedSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration,
+	configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := ss.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil || ss.keys == nil {
+		return sink, err
+	}
+	return &sealedSnapshotSink{SnapshotSink: sink, keys: ss.keys}, nil
+}
+
+// Open 实现 raft.SnapshotStore，返回的元数据中 Size 为明文的大小，发送给 Follower 时按此读取
+func (ss *sealedSnapshotStore) Open(id string) (*raft.SnapshotMeta, io.ReadCloser, error) {
+	meta, rc, err := ss.SnapshotStore.Open(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ss.keys == nil {
+		// 未配置密钥时不缓存快照，只检查它是否已加密
+		br := bufio.NewReader(rc)
+		if head, _ := br.Peek(len(sealedMagic)); isSealed(head) {
+			rc.Close()
+			return nil, nil, fmt.Errorf("snapshot %s is encrypted but no key file is configured: %w", id, ErrEncryptionKeyMissing)
+		}
+		return meta, struct {
+			io.Reader
+			io.Closer
+		}{br, rc}, nil
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := ss.keys.open(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	m := *meta
+	m.Size = int64(len(plain))
+	return &m, io.NopCloser(bytes.NewReader(plain)), nil
+}
+
+// sealedSnapshotSink 缓存快照内容，Close 时加密后写入
+type sealedSnapshotSink struct {
+	raft.SnapshotSink
+	keys *Keyring
+	buf  bytes.Buffer
+}
+
+func (s *sealedSnapshotSink) Write(p []byte) (int, error) {
+	return s.buf.Write(p)
+}
+
+func (s *sealedSnapshotSink) Close() error {
+	sealed, err := s.keys.seal(s.buf.Bytes())
+	if err != nil {
+		s.SnapshotSink.Cancel()
+		return err
+	}
+	if _, err := s.SnapshotSink.Write(sealed); err != nil {
+		s.SnapshotSink.Cancel()
+		return err
+	}
+	return s.SnapshotSink.Close()
+}
+
+// Reencrypt 离线地重新加密 dir 中的日志、状态文件和快照，节点必须已经停止
+// from 用于解密现有数据，明文数据原样读取；写入时使用 to 的当前密钥，to 为 nil 时写为明文。
+// 多 Raft 组的 group-<i> 子目录一并处理。每个文件原子地替换，中途失败时已处理的文件使用新密钥，
+// 其余文件不变，用同样的参数重新运行即可。返回重写的文件
+func Reencrypt(dir string, from, to *Keyring) ([]string, error) {
+	dirs := []string{dir}
+	groups, err := filepath.Glob(filepath.Join(dir, "group-*"))
+	if err != nil {
+		return nil, err
+	}
+	dirs = append(dirs, groups...)
+
+	var done []string
+	for _, d := range dirs {
+		files, err := reencryptDir(d, from, to)
+		done = append(done, files...)
+		if err != nil {
+			return done, fmt.Errorf("%s: %w", d, err)
+		}
+	}
+	if len(done) == 0 {
+		return nil, fmt.Errorf("no raft log, state file or snapshot found in %s", dir)
+	}
+	return done, nil
+}
+
+func reencryptDir(dir string, from, to *Keyring) ([]string, error) {
+	var done []string
+
+	// 日志文件和状态文件逐条记录重新加密
+	for _, name := range []string{logFileName, stateFileName} {
+		path := filepath.Join(dir, name)
+		ok, err := reencryptRecords(path, from, to)
+		if err != nil {
+			return done, fmt.Errorf("%s: %w", name, err)
+		}
+		if ok {
+			done = append(done, path)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "snapshots")); errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	// 保留所有快照，旧的快照在新快照写入后单独删除
+	snapshots, err := raft.NewFileSnapshotStore(dir, math.MaxInt32, io.Discard)
+	if err != nil {
+		return done, err
+	}
+	metas, err := snapshots.List()
+	if err != nil {
+		return done, err
+	}
+	for _, meta := range metas {
+		// 新快照可以用新密钥打开并还原出相同的内容之后，才删除旧快照
+		if err := reencryptSnapshot(snapshots, dir, meta.ID, from, to); err != nil {
+			return done, fmt.Errorf("snapshot %s: %w", meta.ID, err)
+		}
+		if err := os.RemoveAll(filepath.Join(dir, "snapshots", meta.ID)); err != nil {
+			return done, err
+		}
+		done = append(done, filepath.Join(dir, "snapshots", meta.ID))
+	}
+	return done, nil
+}
+
+// reencryptRecords 重新加密 path 处由记录组成的文件，文件不存在时返回 false
+// 与打开文件时相同，末尾不完整的记录被丢弃
+func reencryptRecords(path string, from, to *Keyring) (bool, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var buf []byte
+	r := bytes.NewReader(b)
+	for {
+		payload, _, err := readRecord(r)
+		if err == io.EOF || errors.Is(err, errTornRecord) {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		if payload, err = unsealAny(from, payload); err != nil {
+			return false, err
+		}
+		if payload, err = to.seal(payload); err != nil {
+			return false, err
+		}
+		buf = appendRecord(buf, payload)
+	}
+	return true, writeFileAtomic(path, buf)
+}
+
+// reencryptSnapshot 以相同的元数据写入重新加密的快照，并用 to 读回校验
+// 校验失败时删除新写入的快照并返回错误，原快照保持不变
+func reencryptSnapshot(snapshots raft.SnapshotStore, dir, id string, from, to *Keyring) error {
+	meta, rc, err := snapshots.Open(id)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if b, err = unsealAny(from, b); err != nil {
+		return err
+	}
+	sealed, err := to.seal(b)
+	if err != nil {
+		return err
+	}
+	// 元数据中旧格式的 Peers 由传输层编码，TCP 传输与内存传输都直接使用地址
+	_, trans := raft.NewInmemTransport("")
+	defer trans.Close()
+	sink, err := snapshots.Create(meta.Version, meta.Index, meta.Term, meta.Configuration, meta.ConfigurationIndex, trans)
+	if err != nil {
+		return err
+	}
+	if _, err := sink.Write(sealed); err != nil {
+		sink.Cancel()
+		return err
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+	if err := verifySnapshot(snapshots, sink.ID(), to, b); err != nil {
+		os.RemoveAll(filepath.Join(dir, "snapshots", sink.ID()))
+		return fmt.Errorf("verify rewritten snapshot %s: %w", sink.ID(), err)
+	}
+	return nil
+}
+
+// verifySnapshot 检查快照 id 能通过校验和、可以用 keys 解密，且内容为 want
+func verifySnapshot(snapshots raft.SnapshotStore, id string, keys *Keyring, want []byte) error {
+	_, rc, err := snapshots.Open(id)
+	if err != nil {
+		return err
+	}
+	b, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	plain, err := keys.open(b)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(plain, want) {
+		return errors.New("content differs from the original snapshot")
+	}
+	return nil
+}
+
+// unsealAny 解密数据，明文数据原样返回
+func unsealAny(k *Keyring, b []byte) ([]byte, error) {
+	if !isSealed(b) {
+		return b, nil
+	}
+	return k.open(b)
+}
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// writeKeyFile 生成指定 ID 的随机密钥，写入密钥文件并返回其路径
+func writeKeyFile(t *testing.T, name string, ids ...string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("# test keys\n")
+	for _, id := range ids {
+		key := make([]byte, 32)
+		rand.Read(key)
+		fmt.Fprintf(&b, "%s:%s\n", id, hex.EncodeToString(key))
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	return path
+}
+
+// appendKeyFile 将 src 中的密钥追加到 dst
+func appendKeyFile(t *testing.T, dst, src string) {
+	t.Helper()
+	b, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("read key file: %v", err)
+	}
+	f, err := os.OpenFile(dst, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open key file: %v", err)
+	}
+	defer f.Close()
+	f.Write(b)
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	old, err := LoadKeyring(writeKeyFile(t, "old", "k1"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	rotated, err := LoadKeyring(writeKeyFile(t, "rotated", "k0", "k2"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if rotated.ActiveKey() != "k2" {
+		t.Fatalf("active key: %s, want k2", rotated.ActiveKey())
+	}
+
+	plain := []byte("customer data")
+	sealed, err := old.seal(plain)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if bytes.Contains(sealed, plain) {
+		t.Fatalf("sealed data contains the plaintext")
+	}
+	if got, err := old.open(sealed); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("open: %q, %v", got, err)
+	}
+	if _, err := rotated.open(sealed); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Fatalf("unknown key id: got %v, want %v", err, ErrEncryptionKeyMissing)
+	}
+	if _, err := (*Keyring)(nil).open(sealed); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Fatalf("no keyring: got %v, want %v", err, ErrEncryptionKeyMissing)
+	}
+	if _, err := old.open(plain); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("plaintext: got %v, want %v", err, ErrNotEncrypted)
+	}
+
+	// 同一 ID 的不同密钥，以及被篡改的密文
+	wrong, _ := LoadKeyring(writeKeyFile(t, "wrong", "k1"))
+	if _, err := wrong.open(sealed); !errors.Is(err, ErrEncryptionKeyMismatch) {
+		t.Fatalf("wrong key: got %v, want %v", err, ErrEncryptionKeyMismatch)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := old.open(sealed); !errors.Is(err, ErrEncryptionKeyMismatch) {
+		t.Fatalf("tampered: got %v, want %v", err, ErrEncryptionKeyMismatch)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad")
+	for _, content := range []string{"", "k1\n", "k1:abcd\n", "k1:" + strings.Repeat("00", 32) + "\nk1:" + strings.Repeat("11", 32) + "\n"} {
+		os.WriteFile(bad, []byte(content), 0o600)
+		if _, err := LoadKeyring(bad); err == nil {
+			t.Fatalf("key file %q should be rejected", content)
+		}
+	}
+}
+
+// failingReader 模拟无法读取随机数
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy source unavailable")
+}
+
+func TestKeyring_SealFailureIsReturned(t *testing.T) {
+	keys, err := LoadKeyring(writeKeyFile(t, "keys", "k1"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	dir := t.TempDir()
+	ls, err := openFileLogStore(filepath.Join(dir, logFileName), keys)
+	if err != nil {
+		t.Fatalf("open log: %v", err)
+	}
+	defer ls.Close()
+	inner, err := raft.NewFileSnapshotStore(dir, 2, io.Discard)
+	if err != nil {
+		t.Fatalf("snapshot store: %v", err)
+	}
+	snapshots := &sealedSnapshotStore{SnapshotStore: inner, keys: keys}
+	_, trans := raft.NewInmemTransport("")
+	defer trans.Close()
+	sink, err := snapshots.Create(raft.SnapshotVersionMax, 1, 1, raft.Configuration{}, 1, trans)
+	if err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	sink.Write([]byte("state"))
+
+	reader := rand.Reader
+	rand.Reader = failingReader{}
+	defer func() { rand.Reader = reader }()
+	if _, err := keys.seal([]byte("x")); err == nil {
+		t.Fatalf("seal without entropy should fail")
+	}
+	if err := ls.StoreLogs(testLogs(1, 1)); err == nil {
+		t.Fatalf("store log without entropy should fail")
+	}
+	if last, _ := ls.LastIndex(); last != 0 {
+		t.Fatalf("failed write is visible: last index %d", last)
+	}
+	if err := sink.Close(); err == nil {
+		t.Fatalf("snapshot without entropy should fail")
+	}
+	rand.Reader = reader
+	if metas, _ := snapshots.List(); len(metas) != 0 {
+		t.Fatalf("failed snapshot was kept: %+v", metas)
+	}
+}
+
+// openEncryptedNode 在 dir 中用密钥文件打开持久化模式的单节点
+func openEncryptedNode(t *testing.T, dir, keyFile string) (*Store, error) {
+	t.Helper()
+	s := NewStore(dir, "127.0.0.1:0", false)
+	s.SetKeyFile(keyFile)
+	if err := s.Open(true, "node0"); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatalf("store did not become leader")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// 等待重启前的日志重放完成
+	if err := s.raft.Barrier(5 * time.Second).Error(); err != nil {
+		t.Fatalf("barrier: %v", err)
+	}
+	return s, nil
+}
+
+// assertNoPlaintext 检查 dir 中的文件都不包含 secret
+func assertNoPlaintext(t *testing.T, dir, secret string) {
+	t.Helper()
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Base(path) == stableFileName {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(b, []byte(secret)) {
+			t.Fatalf("%s contains the plaintext", path)
+		}
+		return nil
+	})
+}
+
+func TestStore_EncryptedRestartRotateReencrypt(t *testing.T) {
+	dir := t.TempDir()
+	keys := writeKeyFile(t, "keys", "k1")
+	s, err := openEncryptedNode(t, dir, keys)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := s.Put(fmt.Sprintf("k%d", i), fmt.Sprintf("secret-%d", i), PutOptions{}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := s.raft.Snapshot().Error(); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if _, err := s.Put("after", "secret-after-snapshot", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	// 模拟崩溃，重启时从快照恢复并重放之后的加密日志
+	close(s.shutdownCh)
+	s.wg.Wait()
+	s.raft.Shutdown().Error()
+	s.logStore.Close()
+	assertNoPlaintext(t, dir, "secret-")
+
+	if _, err := openEncryptedNode(t, dir, ""); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Fatalf("open without key: got %v, want %v", err, ErrEncryptionKeyMissing)
+	}
+	if _, err := openEncryptedNode(t, dir, writeKeyFile(t, "wrong", "k1")); !errors.Is(err, ErrEncryptionKeyMismatch) {
+		t.Fatalf("open with wrong key: got %v, want %v", err, ErrEncryptionKeyMismatch)
+	}
+
+	// 轮换：追加新密钥后旧数据仍可读，新数据使用新密钥
+	newKey := writeKeyFile(t, "new", "k2")
+	appendKeyFile(t, keys, newKey)
+	s, err = openEncryptedNode(t, dir, keys)
+	if err != nil {
+		t.Fatalf("open after rotation: %v", err)
+	}
+	for _, key := range []string{"k3", "after"} {
+		if _, err := s.Get(key, Linearizable); err != nil {
+			t.Fatalf("get %s after rotation: %v", key, err)
+		}
+	}
+	if _, err := s.Put("rotated", "secret-rotated", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := s.Shutdown(); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	// 离线重新加密后只需要新密钥
+	from, _ := LoadKeyring(keys)
+	to, _ := LoadKeyring(newKey)
+	files, err := Reencrypt(dir, from, to)
+	if err != nil {
+		t.Fatalf("reencrypt: %v", err)
+	}
+	if len(files) < 3 {
+		t.Fatalf("rewrote %v, want log, state file and snapshot", files)
+	}
+	assertNoPlaintext(t, dir, "secret-")
+	if _, err := openEncryptedNode(t, dir, writeKeyFile(t, "old", "k1")); !errors.Is(err, ErrEncryptionKeyMissing) {
+		t.Fatalf("open with only the old key: got %v, want %v", err, ErrEncryptionKeyMissing)
+	}
+	s, err = openEncryptedNode(t, dir, newKey)
+	if err != nil {
+		t.Fatalf("open with the new key: %v", err)
+	}
+	defer s.Shutdown()
+	for key, want := range map[string]string{"k9": "secret-9", "after": "secret-after-snapshot", "rotated": "secret-rotated"} {
+		if v, err := s.Get(key, Linearizable); err != nil || v != want {
+			t.Fatalf("get %s: %q, %v", key, v, err)
+		}
+	}
+}
@@ -1,29 +1,401 @@
 package store
 
 import (
+	"cmp"
+	"encoding/json"
+	"fmt"
 	"io"
+	"maps"
+	"slices"
 
 	"github.com/hashicorp/raft"
 )
 
 // FSM 实现 Raft 的状态机
-type FSM struct{}
+// 所有对 Store 数据的修改都只在 Apply 中发生，保证各副本结果一致
+type FSM struct {
+	store *Store
+}
+
+// applyResult 是 Apply 的返回值，通过 ApplyFuture.Response 交还给提交者
+type applyResult struct {
+	kv    *KeyValue  // 操作后的键状态；条件不满足时为当前状态；删除时为被删除的值
+	txn   *TxnResult // 事务的执行结果
+	lease *Lease     // 租约操作的结果
+	alarm *Alarm     // 告警操作的结果
+
+	migration *Migration // 迁移记录的变化
+
+	expired []string // 过期删除的键
+
+	namespace *Namespace // 命名空间操作的结果
+	err       error
+}
+
+func newFSM(s *Store) *FSM {
+	return &FSM{store: s}
+}
 
 // Apply 应用状态变化
 func (f *FSM) Apply(log *raft.Log) interface{} {
-	// 处理日志条目
-	// 例如，更新数据存储
-	return nil
+	if f.store.skipReplayed(log) {
+		return &applyResult{}
+	}
+
+	var c command
+	if err := json.Unmarshal(log.Data, &c); err != nil {
+		return &applyResult{err: fmt.Errorf("failed to unmarshal command: %s", err)}
+	}
+
+	s := f.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revision = log.Index
+	s.term = log.Term
+	now := logTime(log)
+	s.appliedAt = max(now, 0)
+	defer s.notifyApplied()
+	defer s.sweepDedup(now)
+
+	res := s.applyDeduplicated(&c, log, now)
+	s.recordChange(log, c.Op, res)
+	s.notifyLog(log, &c, res)
+	return res
+}
+
+// applyDeduplicated 执行一条命令，重复的请求直接返回原结果，调用方需持有写锁
+func (s *Store) applyDeduplicated(c *command, log *raft.Log, now int64) *applyResult {
+	if res, ok := s.lookupSession(c); ok {
+		return res
+	}
+	if res, ok := s.lookupIdempotency(c, now); ok {
+		return res
+	}
+	res := s.applyCommand(c, log)
+	s.recordSession(c, res, now)
+	s.recordIdempotency(c, res, now)
+	return res
+}
+
+// applyCommand 执行一条命令，调用方需持有写锁
+func (s *Store) applyCommand(c *command, log *raft.Log) *applyResult {
+	if err := s.requireNamespace(c); err != nil {
+		return &applyResult{err: err}
+	}
+	if err := s.checkAlarm(c); err != nil {
+		return &applyResult{err: err}
+	}
+	if err := s.checkSlots(c); err != nil {
+		return &applyResult{err: err}
+	}
+	switch c.Op {
+	case opSet:
+		return s.applyPut(c, log)
+	case opDelete:
+		return &applyResult{kv: s.remove(c.Key, log.Index)}
+	case opCompareSwap:
+		cur, _ := s.current(c.Key)
+		if !(Condition{PrevValue: c.PrevValue, PrevRevision: c.PrevRevision}).match(cur) {
+			return &applyResult{kv: cur, err: ErrPreconditionFailed}
+		}
+		return s.applyPut(c, log)
+	case opSetIfAbsent:
+		if cur, ok := s.current(c.Key); ok {
+			return &applyResult{kv: cur, err: ErrKeyExists}
+		}
+		return s.applyPut(c, log)
+	case opCompareDel:
+		cur, _ := s.current(c.Key)
+		if !(Condition{PrevValue: c.PrevValue}).match(cur) {
+			return &applyResult{kv: cur, err: ErrPreconditionFailed}
+		}
+		return &applyResult{kv: s.remove(c.Key, log.Index)}
+	case opTxn:
+		if c.Txn == nil {
+			return &applyResult{err: fmt.Errorf("txn command without body")}
+		}
+		res, err := s.applyTxn(c.Txn, log.Index)
+		return &applyResult{txn: res, err: err}
+	case opIncr:
+		return s.applyIncr(c, log.Index, expireAt(log, c.TTL))
+	case opCompact:
+		return &applyResult{err: s.compact(c.Revision)}
+	case opExpire:
+		return &applyResult{expired: s.applyExpire(c.Expired, log.Index, logTime(log))}
+	case opLeaseGrant:
+		return &applyResult{lease: s.applyGrant(int64(log.Index), c.TTL, logTime(log))}
+	case opLeaseKeepAlive:
+		l, err := s.applyKeepAlive(c.Lease, logTime(log))
+		return &applyResult{lease: l, err: err}
+	case opLeaseRevoke:
+		l, err := s.applyRevoke(c.Lease, log.Index, logTime(log), c.LeaseExpired)
+		return &applyResult{lease: l, err: err}
+	case opNamespaceCreate:
+		return s.applyNamespaceCreate(c, log.Index)
+	case opNamespaceQuota:
+		return s.applyNamespaceQuota(c)
+	case opNamespaceDelete:
+		return s.applyNamespaceDelete(c, log.Index)
+	case opAlarmActivate:
+		return s.applyAlarmActivate(c, log)
+	case opAlarmDisarm:
+		return s.applyAlarmDisarm(c)
+	case opRestoreBegin:
+		return s.applyRestoreBegin(c, logTime(log))
+	case opRestoreAbort:
+		return s.applyRestoreAbort()
+	case opSlotFreeze:
+		return s.applySlotFreeze(c)
+	case opSlotUnfreeze:
+		return s.applySlotUnfreeze(c)
+	case opSlotImport:
+		return s.applySlotImport(c, log.Index)
+	case opSlotAssign:
+		return s.applySlotAssign(c, log)
+	case opSlotRelease:
+		return s.applySlotRelease(c, log.Index)
+	case opMigrationUpdate:
+		return s.applyMigrationUpdate(c, log)
+	default:
+		return &applyResult{err: fmt.Errorf("unrecognized command op: %s", c.Op)}
+	}
+}
+
+// applyPut 写入 set、cas、setnx 命令的值，绑定的租约必须存在，调用方需持有写锁
+func (s *Store) applyPut(c *command, log *raft.Log) *applyResult {
+	if c.Lease != 0 {
+		if _, ok := s.leases[c.Lease]; !ok {
+			return &applyResult{err: ErrLeaseNotFound}
+		}
+	}
+	if err := s.checkQuota(pendingWrite{key: c.Key, value: c.Value}); err != nil {
+		return &applyResult{err: err}
+	}
+	return &applyResult{kv: s.put(c.Key, c.Value, log.Index, expireAt(log, c.TTL), c.Lease)}
 }
 
 // Snapshot 创建快照
 func (f *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	// 返回当前状态快照
-	return nil, nil
+	s := f.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &fsmSnapshot{state: s.snapshotState()}, nil
+}
+
+// snapshotState 复制当前的状态机状态，调用方需持有读锁
+func (s *Store) snapshotState() *fsmState {
+	state := s.snapshotMeta()
+	state.Keys = make([]keyIndex, 0, s.data.Len())
+	s.data.Ascend("", func(ki *keyIndex) bool {
+		state.Keys = append(state.Keys, keyIndex{Key: ki.Key, Revs: slices.Clone(ki.Revs)})
+		return true
+	})
+	return state
+}
+
+// snapshotMeta 复制键以外的状态机状态，调用方需持有读锁
+func (s *Store) snapshotMeta() *fsmState {
+	state := &fsmState{
+		Revision:        s.revision,
+		Term:            s.term,
+		CompactRevision: s.compactRevision,
+		Leases:          make([]Lease, 0, len(s.leases)),
+		Sessions:        make(map[string]clientSession, len(s.sessions)),
+		SessionSweep:    s.sessionSweep,
+		Idempotency:     make(map[string]idempotencyEntry, len(s.idempotency)),
+		Namespaces:      make([]Namespace, 0, len(s.namespaces)),
+	}
+	if s.alarm != nil {
+		alarm := *s.alarm
+		state.Alarm = &alarm
+	}
+	state.RestoreUntil = s.restoreUntil
+	if len(s.slotOwners) > 0 {
+		state.SlotOwners = maps.Clone(s.slotOwners)
+	}
+	if len(s.movedSlots) > 0 {
+		state.MovedSlots = maps.Clone(s.movedSlots)
+	}
+	for slot := range s.frozenSlots {
+		state.FrozenSlots = append(state.FrozenSlots, slot)
+	}
+	slices.Sort(state.FrozenSlots)
+	for _, m := range s.migrations {
+		state.Migrations = append(state.Migrations, *m)
+	}
+	slices.SortFunc(state.Migrations, func(a, b Migration) int { return cmp.Compare(a.ID, b.ID) })
+	for _, ns := range s.namespaces {
+		state.Namespaces = append(state.Namespaces, *ns)
+	}
+	slices.SortFunc(state.Namespaces, func(a, b Namespace) int { return cmp.Compare(a.Name, b.Name) })
+	for id, sess := range s.sessions {
+		state.Sessions[id] = *sess
+	}
+	for key, e := range s.idempotency {
+		state.Idempotency[key] = *e
+	}
+	for _, l := range s.leases {
+		state.Leases = append(state.Leases, Lease{ID: l.id, TTL: l.ttl, ExpireAt: l.expireAt})
+	}
+	return state
 }
 
 // Restore 从快照恢复状态
 func (f *FSM) Restore(rc io.ReadCloser) error {
-	// 从快照恢复状态
+	defer rc.Close()
+
+	var state fsmState
+	if err := json.NewDecoder(rc).Decode(&state); err != nil {
+		return err
+	}
+
+	s := f.store
+	if state.Rebase {
+		if err := s.rebaseState(&state); err != nil {
+			return err
+		}
+	}
+	s.restoreState(&state)
 	return nil
 }
+
+// restoreState 用 state 替换状态机的全部状态
+func (s *Store) restoreState(state *fsmState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = newSkiplist()
+	for i := range state.Keys {
+		s.data.Set(&state.Keys[i])
+	}
+	s.revision = state.Revision
+	s.term = state.Term
+	s.compactRevision = state.CompactRevision
+	s.sessions = make(map[string]*clientSession, len(state.Sessions))
+	for id, sess := range state.Sessions {
+		sess := sess
+		s.sessions[id] = &sess
+	}
+	s.sessionSweep = state.SessionSweep
+	s.idempotency = make(map[string]*idempotencyEntry, len(state.Idempotency))
+	for key, e := range state.Idempotency {
+		e := e
+		s.idempotency[key] = &e
+	}
+	s.namespaces = make(map[string]*Namespace, len(state.Namespaces))
+	for _, ns := range state.Namespaces {
+		ns := ns
+		ns.Usage = NamespaceUsage{} // 用量由下面的键重新统计
+		s.namespaces[ns.Name] = &ns
+	}
+	s.alarm = state.Alarm
+	s.restoreUntil = state.RestoreUntil
+	s.slotOwners = make(map[int]int, len(state.SlotOwners))
+	for slot, g := range state.SlotOwners {
+		s.slotOwners[slot] = g
+		if s.slotHandler != nil {
+			s.slotHandler(slot, g)
+		}
+	}
+	s.movedSlots = make(map[int]int, len(state.MovedSlots))
+	maps.Copy(s.movedSlots, state.MovedSlots)
+	s.frozenSlots = make(map[int]struct{}, len(state.FrozenSlots))
+	for _, slot := range state.FrozenSlots {
+		s.frozenSlots[slot] = struct{}{}
+	}
+	s.migrations = make(map[int64]*Migration, len(state.Migrations))
+	for _, m := range state.Migrations {
+		m := m
+		s.migrations[m.ID] = &m
+	}
+	s.size = 0
+	s.ttls = make(map[string]int64)
+	s.leases = make(map[int64]*lease, len(state.Leases))
+	for _, l := range state.Leases {
+		s.leases[l.ID] = &lease{id: l.ID, ttl: l.TTL, expireAt: l.ExpireAt, keys: make(map[string]struct{})}
+	}
+	s.data.Ascend("", func(ki *keyIndex) bool {
+		for i := range ki.Revs {
+			s.size += kvSize(&ki.Revs[i])
+		}
+		kv := ki.latest()
+		if kv == nil {
+			return true
+		}
+		if kv.ExpireAt != 0 {
+			s.ttls[kv.Key] = kv.ExpireAt
+		}
+		s.attachLease(kv.Key, nil, kv.Lease)
+		s.account(kv.Key, nil, kv)
+		return true
+	})
+	s.resetStateDB()
+	s.resetWatchers()
+	s.recordRestore()
+	s.notifyApplied()
+}
+
+// match 判断键的当前状态是否满足条件，cur 为 nil 表示键不存在
+func (c Condition) match(cur *KeyValue) bool {
+	if cur == nil {
+		return false
+	}
+	if c.PrevValue != nil && cur.Value != *c.PrevValue {
+		return false
+	}
+	if c.PrevRevision != 0 && cur.ModRevision != c.PrevRevision {
+		return false
+	}
+	return true
+}
+
+// fsmState 是快照中保存的状态机状态，包含保留的历史版本
+type fsmState struct {
+	Revision        uint64     `json:"revision"`
+	Term            uint64     `json:"term"` // 最后应用的日志的任期
+	CompactRevision uint64     `json:"compactRevision"`
+	Keys            []keyIndex `json:"keys"`   // 按键有序
+	Leases          []Lease    `json:"leases"` // 绑定的键由 Keys 中的 Lease 字段恢复
+
+	Sessions     map[string]clientSession `json:"sessions,omitempty"` // 客户端去重表
+	SessionSweep int64                    `json:"sessionSweep"`       // 上次清理会话的日志时间
+
+	Idempotency map[string]idempotencyEntry `json:"idempotency,omitempty"` // 幂等键及其结果
+
+	Namespaces []Namespace `json:"namespaces,omitempty"` // 按名称有序
+
+	Alarm *Alarm `json:"alarm,omitempty"` // 当前的存储空间告警
+
+	RestoreUntil int64 `json:"restoreUntil,omitempty"` // 正在进行的备份恢复的标记的过期时间
+	Rebase       bool  `json:"rebase,omitempty"`       // 由备份恢复安装，修订号和任期取快照的索引和任期
+
+	SlotOwners  map[int]int `json:"slotOwners,omitempty"`  // 迁移后的槽归属，只在 0 号组中
+	FrozenSlots []int       `json:"frozenSlots,omitempty"` // 正在迁出的槽
+	MovedSlots  map[int]int `json:"movedSlots,omitempty"`  // 已经迁出的槽及其所属的组
+	Migrations  []Migration `json:"migrations,omitempty"`  // 槽迁移的记录，按 ID 有序，只在 0 号组中
+}
+
+type fsmSnapshot struct {
+	state *fsmState
+}
+
+// Persist 将快照写入 sink
+func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := func() error {
+		b, err := json.Marshal(f.state)
+		if err != nil {
+			return err
+		}
+		if _, err := sink.Write(b); err != nil {
+			return err
+		}
+		return sink.Close()
+	}()
+
+	if err != nil {
+		sink.Cancel()
+	}
+	return err
+}
+
+// Release 释放快照资源
+func (f *fsmSnapshot) Release() {}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// testEpoch 是测试日志的起始时间，第 i 条日志的追加时间为 testEpoch 之后 i 秒
+var testEpoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// applyCommand 以给定的日志索引直接驱动状态机
+func applyCommand(t *testing.T, f *FSM, index uint64, c *command) *applyResult {
+	t.Helper()
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("marshal command: %v", err)
+	}
+	l := &raft.Log{Index: index, Data: b, AppendedAt: testEpoch.Add(time.Duration(index) * time.Second)}
+	res, ok := f.Apply(l).(*applyResult)
+	if !ok {
+		t.Fatalf("unexpected apply result type")
+	}
+	return res
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestFSM_CompareAndSwap(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "a", Value: "1"})
+
+	res := applyCommand(t, f, 2, &command{Op: opCompareSwap, Key: "a", Value: "2", PrevValue: strPtr("0")})
+	if !errors.Is(res.err, ErrPreconditionFailed) {
+		t.Fatalf("cas with wrong value: got %v, want %v", res.err, ErrPreconditionFailed)
+	}
+	if res.kv == nil || res.kv.Value != "1" {
+		t.Fatalf("cas conflict should report current value, got %+v", res.kv)
+	}
+
+	res = applyCommand(t, f, 3, &command{Op: opCompareSwap, Key: "a", Value: "2", PrevValue: strPtr("1")})
+	if res.err != nil || res.kv.Value != "2" || res.kv.ModRevision != 3 {
+		t.Fatalf("cas with matching value: got %+v, %v", res.kv, res.err)
+	}
+
+	res = applyCommand(t, f, 4, &command{Op: opCompareSwap, Key: "a", Value: "3", PrevRevision: 1})
+	if !errors.Is(res.err, ErrPreconditionFailed) {
+		t.Fatalf("cas with stale revision: got %v", res.err)
+	}
+	res = applyCommand(t, f, 5, &command{Op: opCompareSwap, Key: "a", Value: "3", PrevRevision: 3})
+	if res.err != nil || res.kv.Value != "3" {
+		t.Fatalf("cas with matching revision: got %+v, %v", res.kv, res.err)
+	}
+
+	res = applyCommand(t, f, 6, &command{Op: opCompareSwap, Key: "missing", Value: "x", PrevValue: strPtr("")})
+	if !errors.Is(res.err, ErrPreconditionFailed) {
+		t.Fatalf("cas on missing key: got %v", res.err)
+	}
+}
+
+func TestFSM_SetIfAbsentAndCompareAndDelete(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	if res := applyCommand(t, f, 1, &command{Op: opSetIfAbsent, Key: "k", Value: "v"}); res.err != nil {
+		t.Fatalf("setnx on missing key: %v", res.err)
+	}
+	if res := applyCommand(t, f, 2, &command{Op: opSetIfAbsent, Key: "k", Value: "w"}); !errors.Is(res.err, ErrKeyExists) {
+		t.Fatalf("setnx on existing key: got %v", res.err)
+	}
+	if v, _ := s.Get("k", Stale); v != "v" {
+		t.Fatalf("setnx overwrote value: %q", v)
+	}
+
+	if res := applyCommand(t, f, 3, &command{Op: opCompareDel, Key: "k", PrevValue: strPtr("w")}); !errors.Is(res.err, ErrPreconditionFailed) {
+		t.Fatalf("cad with wrong value: got %v", res.err)
+	}
+	if res := applyCommand(t, f, 4, &command{Op: opCompareDel, Key: "k", PrevValue: strPtr("v")}); res.err != nil {
+		t.Fatalf("cad with matching value: %v", res.err)
+	}
+	if _, err := s.Get("k", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("key should be deleted, got %v", err)
+	}
+}
+
+func TestFSM_Txn(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "a", Value: "1"})
+
+	txn := &Txn{
+		Compare: []Compare{
+			{Key: "a", Target: CompareValue, Result: "=", Value: "1"},
+			{Key: "b", Target: CompareRevision, Result: "=", Revision: 0},
+		},
+		Success: []Op{
+			{Type: OpPut, Key: "b", Value: "2"},
+			{Type: OpDelete, Key: "a"},
+			{Type: OpGet, Key: "b"},
+		},
+		Failure: []Op{
+			{Type: OpGet, Key: "a"},
+		},
+	}
+	res := applyCommand(t, f, 2, &command{Op: opTxn, Txn: txn})
+	if res.err != nil || !res.txn.Succeeded {
+		t.Fatalf("txn should succeed: %+v, %v", res.txn, res.err)
+	}
+	if len(res.txn.Results) != 3 || res.txn.Results[2].KV == nil || res.txn.Results[2].KV.ModRevision != 2 {
+		t.Fatalf("unexpected txn results: %+v", res.txn.Results)
+	}
+	if _, err := s.Get("a", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("a should be deleted by txn, got %v", err)
+	}
+
+	// 比较不再成立，执行 failure 分支且不修改数据
+	res = applyCommand(t, f, 3, &command{Op: opTxn, Txn: txn})
+	if res.txn.Succeeded || len(res.txn.Results) != 1 || res.txn.Results[0].KV != nil {
+		t.Fatalf("txn should take failure branch: %+v", res.txn)
+	}
+	if v, _ := s.Get("b", Stale); v != "2" {
+		t.Fatalf("failure branch modified data: b=%q", v)
+	}
+}
+
+func TestTxn_Validate(t *testing.T) {
+	bad := []*Txn{
+		{Compare: []Compare{{Key: "a", Target: "lease", Result: "="}}},
+		{Compare: []Compare{{Key: "a", Target: CompareValue, Result: ">="}}},
+		{Success: []Op{{Type: "incr", Key: "a"}}},
+		{Failure: []Op{{Type: OpPut}}},
+	}
+	for i, txn := range bad {
+		if err := txn.Validate(); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
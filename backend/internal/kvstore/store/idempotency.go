@@ -0,0 +1,63 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultIdempotencyWindow 幂等键默认保留的时间
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// ErrIdempotencyKeyReused 幂等键已被一个内容不同的请求使用
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+// WithIdempotencyKey 为写操作附加幂等键，fingerprint 是请求内容的摘要
+// 窗口期内以相同的键和摘要重试时返回第一次应用的结果，摘要不同时返回 ErrIdempotencyKeyReused
+func WithIdempotencyKey(key, fingerprint string) WriteOption {
+	return func(c *command) {
+		c.IdempotencyKey = key
+		c.Fingerprint = fingerprint
+	}
+}
+
+// idempotencyEntry 记录一个幂等键对应的请求和结果
+type idempotencyEntry struct {
+	Fingerprint string        `json:"fingerprint"`
+	ExpireAt    int64         `json:"expireAt"` // 日志时间（Unix 毫秒）
+	Result      sessionResult `json:"result"`
+}
+
+// SetIdempotencyWindow 设置本节点作为 Leader 时提议的幂等键保留时间
+// 保留时间随日志条目复制，各副本按同一值过期
+func (s *Store) SetIdempotencyWindow(window time.Duration) {
+	if window > 0 {
+		s.idempotencyWindow = window
+	}
+}
+
+// lookupIdempotency 返回重复请求的原结果，调用方需持有写锁
+func (s *Store) lookupIdempotency(c *command, now int64) (*applyResult, bool) {
+	if c.IdempotencyKey == "" {
+		return nil, false
+	}
+	e, ok := s.idempotency[c.IdempotencyKey]
+	if !ok || e.ExpireAt <= now {
+		return nil, false
+	}
+	if e.Fingerprint != c.Fingerprint {
+		return &applyResult{err: ErrIdempotencyKeyReused}, true
+	}
+	return e.Result.applyResult(), true
+}
+
+// recordIdempotency 保存幂等键对应的结果，调用方需持有写锁
+func (s *Store) recordIdempotency(c *command, res *applyResult, now int64) {
+	if c.IdempotencyKey == "" {
+		return
+	}
+	s.idempotency[c.IdempotencyKey] = &idempotencyEntry{
+		Fingerprint: c.Fingerprint,
+		ExpireAt:    now + c.IdempotencyTTL.Milliseconds(),
+		Result:      newSessionResult(res),
+	}
+}
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotency_ReplayAndConflict(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	put := func(index uint64, value, fingerprint string) *applyResult {
+		return applyCommand(t, f, index, &command{
+			Op:             opSet,
+			Key:            "k",
+			Value:          value,
+			IdempotencyKey: "req-1",
+			Fingerprint:    fingerprint,
+			IdempotencyTTL: time.Minute,
+		})
+	}
+
+	first := put(1, "v1", "sha-a")
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v2"})
+
+	replay := put(3, "v1", "sha-a")
+	if replay.err != nil || replay.kv.ModRevision != first.kv.ModRevision {
+		t.Fatalf("replay: %+v, %v", replay.kv, replay.err)
+	}
+	if v, _ := s.Get("k", Stale); v != "v2" {
+		t.Fatalf("replay should not write, got %q", v)
+	}
+
+	if res := put(4, "v3", "sha-b"); !errors.Is(res.err, ErrIdempotencyKeyReused) {
+		t.Fatalf("different body: got %v, want %v", res.err, ErrIdempotencyKeyReused)
+	}
+
+	// 窗口过后同一个键被视为新请求：第 1 条日志在 testEpoch+1s，窗口 1 分钟
+	if res := put(61, "v4", "sha-b"); res.err != nil || res.kv.Value != "v4" {
+		t.Fatalf("after window: %+v, %v", res.kv, res.err)
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrLeaseNotFound 租约不存在或已过期
+var ErrLeaseNotFound = errors.New("lease not found")
+
+// Lease 是一个可续期的租约，租约过期或被撤销时删除所有绑定的键
+type Lease struct {
+	ID       int64         `json:"id"` // 授予该租约的 Raft 日志索引
+	TTL      time.Duration `json:"ttl"`
+	ExpireAt int64         `json:"expireAt"` // 过期时间（Unix 毫秒），由最近一次授予或续期的日志时间决定
+	Keys     []string      `json:"keys,omitempty"`
+}
+
+// lease 是状态机内部的租约状态
+type lease struct {
+	id       int64
+	ttl      time.Duration
+	expireAt int64
+	keys     map[string]struct{}
+}
+
+func (l *lease) toLease() *Lease {
+	out := &Lease{ID: l.id, TTL: l.ttl, ExpireAt: l.expireAt, Keys: make([]string, 0, len(l.keys))}
+	for k := range l.keys {
+		out.Keys = append(out.Keys, k)
+	}
+	sort.Strings(out.Keys)
+	return out
+}
+
+// attachLease 将键绑定到租约，同时解除与旧租约的绑定，调用方需持有写锁
+func (s *Store) attachLease(key string, prev *KeyValue, id int64) {
+	if prev != nil && prev.Lease != 0 && prev.Lease != id {
+		if l, ok := s.leases[prev.Lease]; ok {
+			delete(l.keys, key)
+		}
+	}
+	if id != 0 {
+		if l, ok := s.leases[id]; ok {
+			l.keys[key] = struct{}{}
+		}
+	}
+}
+
+// applyGrant 授予租约，调用方需持有写锁
+func (s *Store) applyGrant(id int64, ttl time.Duration, now int64) *Lease {
+	l := &lease{
+		id:       id,
+		ttl:      ttl,
+		expireAt: now + ttl.Milliseconds(),
+		keys:     make(map[string]struct{}),
+	}
+	s.leases[id] = l
+	return l.toLease()
+}
+
+// applyKeepAlive 按日志时间续期租约，调用方需持有写锁
+func (s *Store) applyKeepAlive(id int64, now int64) (*Lease, error) {
+	l, ok := s.leases[id]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+	l.expireAt = now + l.ttl.Milliseconds()
+	return l.toLease(), nil
+}
+
+// applyRevoke 撤销租约并删除绑定的所有键，调用方需持有写锁
+// expired 为 true 时表示 Leader 提议的过期，按日志时间尚未过期（期间被续期）则忽略
+func (s *Store) applyRevoke(id int64, index uint64, now int64, expired bool) (*Lease, error) {
+	l, ok := s.leases[id]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+	if expired && l.expireAt > now {
+		return l.toLease(), nil
+	}
+
+	out := l.toLease()
+	for _, key := range out.Keys {
+		s.deleteKey(key, index, expired)
+	}
+	delete(s.leases, id)
+	return out, nil
+}
+
+// dueLeases 返回按本地时钟已经过期的租约，按 ID 排序
+func (s *Store) dueLeases(now int64) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []int64
+	for id, l := range s.leases {
+		if l.expireAt <= now {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// GrantLease 授予一个新租约
+func (s *Store) GrantLease(ttl time.Duration, wopts ...WriteOption) (*Lease, error) {
+	if ttl <= 0 {
+		return nil, errors.New("lease ttl must be positive")
+	}
+	res, err := s.apply(&command{Op: opLeaseGrant, TTL: ttl}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.lease, nil
+}
+
+// KeepAlive 续期租约
+func (s *Store) KeepAlive(id int64) (*Lease, error) {
+	res, err := s.apply(&command{Op: opLeaseKeepAlive, Lease: id})
+	if err != nil {
+		return nil, err
+	}
+	return res.lease, nil
+}
+
+// RevokeLease 撤销租约，绑定的键在同一条日志中全部删除
+func (s *Store) RevokeLease(id int64, wopts ...WriteOption) (*Lease, error) {
+	res, err := s.apply(&command{Op: opLeaseRevoke, Lease: id}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.lease, nil
+}
+
+// GetLease 返回租约的当前状态
+func (s *Store) GetLease(id int64) (*Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.leases[id]
+	if !ok {
+		return nil, ErrLeaseNotFound
+	}
+	return l.toLease(), nil
+}
+
+// Leases 返回所有租约，按 ID 排序
+func (s *Store) Leases() []Lease {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Lease, 0, len(s.leases))
+	for _, l := range s.leases {
+		out = append(out, *l.toLease())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
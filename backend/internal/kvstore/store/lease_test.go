@@ -0,0 +1,132 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLease_RevokeDeletesKeysInOneEntry(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	res := applyCommand(t, f, 1, &command{Op: opLeaseGrant, TTL: 10 * time.Second})
+	id := res.lease.ID
+	if id != 1 {
+		t.Fatalf("lease id: got %d, want 1", id)
+	}
+
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "a", Value: "1", Lease: id})
+	applyCommand(t, f, 3, &command{Op: opSet, Key: "b", Value: "2", Lease: id})
+	applyCommand(t, f, 4, &command{Op: opSet, Key: "c", Value: "3"})
+	if res := applyCommand(t, f, 5, &command{Op: opSet, Key: "d", Value: "4", Lease: 99}); !errors.Is(res.err, ErrLeaseNotFound) {
+		t.Fatalf("put with unknown lease: got %v, want %v", res.err, ErrLeaseNotFound)
+	}
+
+	l, err := s.GetLease(id)
+	if err != nil || len(l.Keys) != 2 || l.Keys[0] != "a" || l.Keys[1] != "b" {
+		t.Fatalf("lease keys: got %+v, %v", l, err)
+	}
+
+	// 重新写入且不带租约的键应解除绑定
+	applyCommand(t, f, 6, &command{Op: opSet, Key: "b", Value: "3"})
+
+	applyCommand(t, f, 7, &command{Op: opLeaseRevoke, Lease: id})
+	if _, err := s.Get("a", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("leased key should be deleted, got %v", err)
+	}
+	if v, err := s.Get("b", Stale); err != nil || v != "3" {
+		t.Fatalf("detached key: got %q, %v", v, err)
+	}
+	if kv, err := s.GetAt("a", 7, Stale); err == nil {
+		t.Fatalf("key still visible at revoke revision: %+v", kv)
+	}
+	if _, err := s.GetLease(id); !errors.Is(err, ErrLeaseNotFound) {
+		t.Fatalf("revoked lease: got %v, want %v", err, ErrLeaseNotFound)
+	}
+}
+
+func TestLease_KeepAliveDefersExpiry(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	// 授予于 testEpoch+1s，TTL 5s
+	applyCommand(t, f, 1, &command{Op: opLeaseGrant, TTL: 5 * time.Second})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v", Lease: 1})
+
+	due := s.dueLeases(testEpoch.Add(6 * time.Second).UnixMilli())
+	if len(due) != 1 || due[0] != 1 {
+		t.Fatalf("due leases: %v", due)
+	}
+
+	// 提议过期之后租约被续期，过期撤销应被忽略
+	applyCommand(t, f, 4, &command{Op: opLeaseKeepAlive, Lease: 1})
+	applyCommand(t, f, 6, &command{Op: opLeaseRevoke, Lease: 1, LeaseExpired: true})
+	if _, err := s.Get("k", Stale); err != nil {
+		t.Fatalf("renewed lease should keep key: %v", err)
+	}
+
+	w, _ := s.Watch(WatchOptions{Key: "k"})
+	defer w.Cancel()
+
+	applyCommand(t, f, 9, &command{Op: opLeaseRevoke, Lease: 1, LeaseExpired: true})
+	if _, err := s.Get("k", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expired lease should delete key, got %v", err)
+	}
+	if ev := <-w.Events(); ev.Type != EventDelete || !ev.Expired {
+		t.Fatalf("expected expiry delete event, got %+v", ev)
+	}
+}
+
+func TestLease_TxnRejectsUnknownLease(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	res := applyCommand(t, f, 1, &command{Op: opTxn, Txn: &Txn{Success: []Op{
+		{Type: OpPut, Key: "a", Value: "1"},
+		{Type: OpPut, Key: "b", Value: "2", Lease: 42},
+	}}})
+	if !errors.Is(res.err, ErrLeaseNotFound) {
+		t.Fatalf("txn with unknown lease: got %v, want %v", res.err, ErrLeaseNotFound)
+	}
+	if _, err := s.Get("a", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("failed txn should not write, got %v", err)
+	}
+}
+
+func TestLease_SnapshotRestore(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opLeaseGrant, TTL: 5 * time.Second})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v", Lease: 1})
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	restored := NewStore(t.TempDir(), "", true)
+	rf := newFSM(restored)
+	if err := rf.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	l, err := restored.GetLease(1)
+	if err != nil {
+		t.Fatalf("restored lease: %v", err)
+	}
+	if l.TTL != 5*time.Second || len(l.Keys) != 1 || l.Keys[0] != "k" {
+		t.Fatalf("restored lease: %+v", l)
+	}
+
+	applyCommand(t, rf, 3, &command{Op: opLeaseRevoke, Lease: 1})
+	if _, err := restored.Get("k", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("revoke after restore should delete key, got %v", err)
+	}
+}
@@ -0,0 +1,524 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// 日志文件中的记录类型
+const (
+	recordEntry       byte = 1 // 一条 Raft 日志
+	recordDeleteRange byte = 2 // 删除 [min, max] 范围内的日志
+)
+
+const (
+	// recordHeaderSize 每条记录的头部：4 字节长度和 4 字节 CRC32-C
+	recordHeaderSize = 8
+	// logRewriteThreshold 已删除的日志条目超过该数量且多于保留的条目时重写日志文件
+	logRewriteThreshold = 16384
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// fileLogStore 是追加写入的 Raft 日志存储
+// 每次写入都在 fsync 之后才返回；打开时重放文件，末尾不完整或校验失败的记录被截断。
+// 内存中只保存每条日志在文件中的位置，读取时从文件读出记录再解码；最近的日志由 raft.LogCache 缓存
+// 配置了密钥时每条记录的内容单独加密，校验和针对密文计算，解密失败不会被当作损坏的记录截断
+type fileLogStore struct {
+	mu    sync.RWMutex
+	path  string
+	f     *os.File
+	keys  *Keyring          // 加密记录的密钥，nil 表示不加密
+	size  int64             // 文件中有效内容的长度，新的记录追加在这里
+	pos   map[uint64]logPos // 现有日志的记录在文件中的位置
+	first uint64            // 第一条日志的索引，没有日志时为 0
+	last  uint64            // 最后一条日志的索引，没有日志时为 0
+	dead  int               // 文件中已被删除的日志条目数
+}
+
+// logPos 是一条日志记录（包含头部）在文件中的偏移和长度
+type logPos struct {
+	off  int64
+	size int64
+}
+
+// openFileLogStore 打开或创建 path 处的日志文件
+func openFileLogStore(path string, keys *Keyring) (*fileLogStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	ls := &fileLogStore{path: path, f: f, keys: keys, pos: make(map[uint64]logPos)}
+	if err := ls.replay(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("replay %s: %w", path, err)
+	}
+	return ls, nil
+}
+
+// replay 重放日志文件，记录每条日志的位置，并截断末尾损坏的记录
+func (ls *fileLogStore) replay() error {
+	r := bufio.NewReader(ls.f)
+	var good int64
+	var buf []byte // 只需要记录的索引，读取时复用同一块内存
+	for {
+		payload, n, err := readRecordInto(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 崩溃时未写完的记录，丢弃该记录及其之后的内容
+			if err := ls.f.Truncate(good); err != nil {
+				return err
+			}
+			break
+		}
+		buf = payload[:0]
+		if payload, err = ls.keys.open(payload); err != nil {
+			return fmt.Errorf("record at offset %d: %w", good, err)
+		}
+		if err := ls.replayRecord(payload, logPos{off: good, size: n}); err != nil {
+			return err
+		}
+		good += n
+	}
+	ls.size = good
+	_, err := ls.f.Seek(good, io.SeekStart)
+	return err
+}
+
+func (ls *fileLogStore) replayRecord(payload []byte, pos logPos) error {
+	switch payload[0] {
+	case recordEntry:
+		if len(payload) < 9 {
+			return fmt.Errorf("invalid log record")
+		}
+		ls.add(binary.BigEndian.Uint64(payload[1:]), pos)
+		return nil
+	case recordDeleteRange:
+		if len(payload) != 17 {
+			return fmt.Errorf("invalid delete record")
+		}
+		ls.remove(binary.BigEndian.Uint64(payload[1:]), binary.BigEndian.Uint64(payload[9:]))
+		return nil
+	default:
+		return fmt.Errorf("unknown record type %d", payload[0])
+	}
+}
+
+// add 记录一条日志的位置，调用方需持有写锁
+func (ls *fileLogStore) add(index uint64, pos logPos) {
+	if _, ok := ls.pos[index]; ok {
+		ls.dead++
+	}
+	ls.pos[index] = pos
+	if ls.first == 0 || index < ls.first {
+		ls.first = index
+	}
+	if index > ls.last {
+		ls.last = index
+	}
+}
+
+// remove 删除 [lo, hi] 范围内的日志，与 raft.InmemStore 的 DeleteRange 相同地调整首尾索引，调用方需持有写锁
+func (ls *fileLogStore) remove(lo, hi uint64) {
+	if ls.last == 0 {
+		return
+	}
+	for i := max(lo, ls.first); i <= min(hi, ls.last); i++ {
+		if _, ok := ls.pos[i]; ok {
+			delete(ls.pos, i)
+			ls.dead++
+		}
+	}
+	if lo <= ls.first {
+		ls.first = hi + 1
+	}
+	if hi >= ls.last {
+		ls.last = lo - 1
+	}
+	if ls.first > ls.last {
+		ls.first, ls.last = 0, 0
+	}
+}
+
+// FirstIndex 实现 raft.LogStore
+func (ls *fileLogStore) FirstIndex() (uint64, error) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	return ls.first, nil
+}
+
+// LastIndex 实现 raft.LogStore
+func (ls *fileLogStore) LastIndex() (uint64, error) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	return ls.last, nil
+}
+
+// GetLog 实现 raft.LogStore，从文件中读出记录并解码
+func (ls *fileLogStore) GetLog(index uint64, log *raft.Log) error {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	pos, ok := ls.pos[index]
+	if !ok {
+		return raft.ErrLogNotFound
+	}
+	payload, err := ls.readAt(pos)
+	if err != nil {
+		return fmt.Errorf("log %d: %w", index, err)
+	}
+	if payload, err = ls.keys.open(payload); err != nil {
+		return fmt.Errorf("log %d: %w", index, err)
+	}
+	if len(payload) == 0 || payload[0] != recordEntry {
+		return fmt.Errorf("log %d: invalid log record", index)
+	}
+	l, err := decodeLog(payload[1:])
+	if err != nil {
+		return fmt.Errorf("log %d: %w", index, err)
+	}
+	*log = *l
+	return nil
+}
+
+// readAt 读取 pos 处的记录并校验，返回其内容，调用方需持有锁
+func (ls *fileLogStore) readAt(pos logPos) ([]byte, error) {
+	buf := make([]byte, pos.size)
+	if _, err := ls.f.ReadAt(buf, pos.off); err != nil {
+		return nil, err
+	}
+	payload, _, err := readRecord(bytes.NewReader(buf))
+	return payload, err
+}
+
+// StoreLog 实现 raft.LogStore
+func (ls *fileLogStore) StoreLog(log *raft.Log) error {
+	return ls.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs 实现 raft.LogStore，所有日志在一次写入和 fsync 中落盘
+func (ls *fileLogStore) StoreLogs(logs []*raft.Log) error {
+	var buf []byte
+	sizes := make([]int64, len(logs))
+	for i, log := range logs {
+		payload, err := ls.keys.seal(encodeLog(log))
+		if err != nil {
+			return err
+		}
+		n := len(buf)
+		buf = appendRecord(buf, payload)
+		sizes[i] = int64(len(buf) - n)
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	off := ls.size
+	if err := ls.write(buf); err != nil {
+		return err
+	}
+	for i, log := range logs {
+		ls.add(log.Index, logPos{off: off, size: sizes[i]})
+		off += sizes[i]
+	}
+	return nil
+}
+
+// DeleteRange 实现 raft.LogStore
+func (ls *fileLogStore) DeleteRange(lo, hi uint64) error {
+	payload := make([]byte, 17)
+	payload[0] = recordDeleteRange
+	binary.BigEndian.PutUint64(payload[1:], lo)
+	binary.BigEndian.PutUint64(payload[9:], hi)
+	sealed, err := ls.keys.seal(payload)
+	if err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if err := ls.write(appendRecord(nil, sealed)); err != nil {
+		return err
+	}
+	ls.remove(lo, hi)
+	if ls.dead >= logRewriteThreshold && ls.dead > len(ls.pos) {
+		return ls.rewrite()
+	}
+	return nil
+}
+
+// rewrite 只保留现有的日志重写文件，记录原样复制，写入临时文件后原子地替换，调用方需持有写锁
+func (ls *fileLogStore) rewrite() error {
+	var buf []byte
+	pos := make(map[uint64]logPos, len(ls.pos))
+	for i := ls.first; i <= ls.last && ls.last != 0; i++ {
+		p, ok := ls.pos[i]
+		if !ok {
+			continue
+		}
+		record := make([]byte, p.size)
+		if _, err := ls.f.ReadAt(record, p.off); err != nil {
+			return err
+		}
+		pos[i] = logPos{off: int64(len(buf)), size: p.size}
+		buf = append(buf, record...)
+	}
+	if err := writeFileAtomic(ls.path, buf); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(ls.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	ls.f.Close()
+	ls.f = f
+	ls.pos = pos
+	ls.size = int64(len(buf))
+	ls.dead = 0
+	return nil
+}
+
+// write 追加写入并 fsync，调用方需持有写锁
+// 写入失败时截掉已写入的部分，之后的记录不会跟在不完整的记录后面
+func (ls *fileLogStore) write(buf []byte) error {
+	if _, err := ls.f.Write(buf); err != nil {
+		ls.discardTail()
+		return err
+	}
+	if err := ls.f.Sync(); err != nil {
+		ls.discardTail()
+		return err
+	}
+	ls.size += int64(len(buf))
+	return nil
+}
+
+// discardTail 将文件截断到最后一条完整的记录，调用方需持有写锁
+func (ls *fileLogStore) discardTail() {
+	if err := ls.f.Truncate(ls.size); err == nil {
+		ls.f.Seek(ls.size, io.SeekStart)
+	}
+}
+
+// Close 关闭日志文件
+func (ls *fileLogStore) Close() error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.f.Close()
+}
+
+// appendRecord 将 payload 加上长度和校验和追加到 buf
+func appendRecord(buf, payload []byte) []byte {
+	var hdr [recordHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(hdr[4:], crc32.Checksum(payload, crcTable))
+	buf = append(buf, hdr[:]...)
+	return append(buf, payload...)
+}
+
+// readRecord 读取一条记录，返回其内容和占用的字节数
+// 文件在记录边界结束时返回 io.EOF，记录不完整或校验失败时返回其他错误
+func readRecord(r io.Reader) ([]byte, int64, error) {
+	return readRecordInto(r, nil)
+}
+
+// readRecordInto 与 readRecord 相同，buf 容量足够时内容读入 buf，返回的内容在下次使用 buf 前有效
+func readRecordInto(r io.Reader, buf []byte) ([]byte, int64, error) {
+	var hdr [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, errTornRecord
+		}
+		return nil, 0, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:])
+	if size == 0 || size > maxRecordSize {
+		return nil, 0, errTornRecord
+	}
+	payload := buf[:0]
+	if uint32(cap(buf)) < size {
+		payload = make([]byte, size)
+	}
+	payload = payload[:size]
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, errTornRecord
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(hdr[4:]) {
+		return nil, 0, errTornRecord
+	}
+	return payload, int64(recordHeaderSize) + int64(size), nil
+}
+
+// maxRecordSize 单条记录的上限，超过时视为损坏
+const maxRecordSize = 256 << 20
+
+var errTornRecord = errors.New("torn or corrupted record")
+
+// encodeLog 编码一条日志：index、term、type、appendedAt、data、extensions
+func encodeLog(log *raft.Log) []byte {
+	b := make([]byte, 0, 1+8+8+1+8+4+len(log.Data)+4+len(log.Extensions))
+	b = append(b, recordEntry)
+	b = binary.BigEndian.AppendUint64(b, log.Index)
+	b = binary.BigEndian.AppendUint64(b, log.Term)
+	b = append(b, byte(log.Type))
+	var appended int64
+	if !log.AppendedAt.IsZero() {
+		appended = log.AppendedAt.UnixNano()
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(appended))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(log.Data)))
+	b = append(b, log.Data...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(log.Extensions)))
+	return append(b, log.Extensions...)
+}
+
+func decodeLog(b []byte) (*raft.Log, error) {
+	if len(b) < 8+8+1+8+4 {
+		return nil, fmt.Errorf("invalid log record")
+	}
+	log := &raft.Log{
+		Index: binary.BigEndian.Uint64(b[0:]),
+		Term:  binary.BigEndian.Uint64(b[8:]),
+		Type:  raft.LogType(b[16]),
+	}
+	if appended := int64(binary.BigEndian.Uint64(b[17:])); appended != 0 {
+		log.AppendedAt = time.Unix(0, appended)
+	}
+	b = b[25:]
+	data, b, ok := readBytes(b)
+	if !ok {
+		return nil, fmt.Errorf("invalid log record")
+	}
+	ext, _, ok := readBytes(b)
+	if !ok {
+		return nil, fmt.Errorf("invalid log record")
+	}
+	log.Data, log.Extensions = data, ext
+	return log, nil
+}
+
+// readBytes 读取 4 字节长度前缀的字节串
+func readBytes(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if uint32(len(b)) < n {
+		return nil, nil, false
+	}
+	if n == 0 {
+		return nil, b, true
+	}
+	return b[:n:n], b[n:], true
+}
+
+// fileStableStore 是 Raft 的稳定存储（任期、投票），每次修改都原子地重写整个文件
+type fileStableStore struct {
+	mu   sync.Mutex
+	path string
+	data map[string][]byte
+}
+
+// openFileStableStore 打开或创建 path 处的稳定存储
+func openFileStableStore(path string) (*fileStableStore, error) {
+	ss := &fileStableStore{path: path, data: make(map[string][]byte)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ss, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &ss.data); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return ss, nil
+}
+
+// Set 实现 raft.StableStore
+func (ss *fileStableStore) Set(key, val []byte) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.data[string(key)] = append([]byte(nil), val...)
+	b, err := json.Marshal(ss.data)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ss.path, b)
+}
+
+// Get 实现 raft.StableStore，键不存在时返回与 raft.InmemStore 相同的 "not found" 错误
+func (ss *fileStableStore) Get(key []byte) ([]byte, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	val, ok := ss.data[string(key)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return val, nil
+}
+
+// SetUint64 实现 raft.StableStore
+func (ss *fileStableStore) SetUint64(key []byte, val uint64) error {
+	return ss.Set(key, binary.BigEndian.AppendUint64(nil, val))
+}
+
+// GetUint64 实现 raft.StableStore，键不存在时返回 0
+func (ss *fileStableStore) GetUint64(key []byte) (uint64, error) {
+	val, err := ss.Get(key)
+	if err != nil {
+		return 0, nil
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("invalid uint64 value for %q", key)
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// writeFileAtomic 先写入同目录的临时文件并 fsync，再重命名覆盖 path，最后 fsync 目录
+// 崩溃时 path 要么是旧内容要么是新内容
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
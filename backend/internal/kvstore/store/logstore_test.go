@@ -0,0 +1,144 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func testLogs(from, to uint64) []*raft.Log {
+	var logs []*raft.Log
+	for i := from; i <= to; i++ {
+		logs = append(logs, &raft.Log{
+			Index:      i,
+			Term:       1,
+			Type:       raft.LogCommand,
+			Data:       []byte{byte(i)},
+			AppendedAt: testEpoch,
+		})
+	}
+	return logs
+}
+
+func TestFileLogStore_ReopenTruncatesTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.log")
+	ls, err := openFileLogStore(path, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := ls.StoreLogs(testLogs(1, 10)); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if err := ls.DeleteRange(1, 3); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	ls.Close()
+
+	// 模拟写入一半时崩溃
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(appendRecord(nil, encodeLog(testLogs(11, 11)[0]))[:12])
+	f.Close()
+
+	ls, err = openFileLogStore(path, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	first, _ := ls.FirstIndex()
+	last, _ := ls.LastIndex()
+	if first != 4 || last != 10 {
+		t.Fatalf("range after reopen: [%d, %d], want [4, 10]", first, last)
+	}
+	var log raft.Log
+	if err := ls.GetLog(7, &log); err != nil || !bytes.Equal(log.Data, []byte{7}) || !log.AppendedAt.Equal(testEpoch) {
+		t.Fatalf("log 7: %+v, %v", log, err)
+	}
+
+	// 截断后可以继续追加
+	if err := ls.StoreLogs(testLogs(11, 12)); err != nil {
+		t.Fatalf("store after truncate: %v", err)
+	}
+	ls.Close()
+	ls, err = openFileLogStore(path, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer ls.Close()
+	if last, _ := ls.LastIndex(); last != 12 {
+		t.Fatalf("last index: %d, want 12", last)
+	}
+}
+
+func TestFileLogStore_RewriteDropsDeletedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.log")
+	ls, err := openFileLogStore(path, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	n := uint64(logRewriteThreshold + 100)
+	if err := ls.StoreLogs(testLogs(1, n)); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	before, _ := os.Stat(path)
+	if err := ls.DeleteRange(1, n-10); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size()/100 {
+		t.Fatalf("log file should be rewritten: %d -> %d bytes", before.Size(), after.Size())
+	}
+	if err := ls.StoreLogs(testLogs(n+1, n+1)); err != nil {
+		t.Fatalf("store after rewrite: %v", err)
+	}
+	ls.Close()
+
+	ls, err = openFileLogStore(path, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer ls.Close()
+	first, _ := ls.FirstIndex()
+	last, _ := ls.LastIndex()
+	if first != n-9 || last != n+1 {
+		t.Fatalf("range after rewrite: [%d, %d], want [%d, %d]", first, last, n-9, n+1)
+	}
+	// 日志从文件中读取，重写后的位置仍然正确
+	for i := first; i <= last; i++ {
+		var log raft.Log
+		if err := ls.GetLog(i, &log); err != nil || log.Index != i || !bytes.Equal(log.Data, []byte{byte(i)}) {
+			t.Fatalf("log %d after rewrite: %+v, %v", i, log, err)
+		}
+	}
+	if err := ls.GetLog(first-1, &raft.Log{}); err != raft.ErrLogNotFound {
+		t.Fatalf("deleted log: %v, want %v", err, raft.ErrLogNotFound)
+	}
+}
+
+func TestFileStableStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stable.json")
+	ss, err := openFileStableStore(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if v, err := ss.GetUint64([]byte("CurrentTerm")); err != nil || v != 0 {
+		t.Fatalf("missing uint64: %d, %v", v, err)
+	}
+	if _, err := ss.Get([]byte("LastVoteCand")); err == nil || err.Error() != "not found" {
+		t.Fatalf("missing key: %v", err)
+	}
+	ss.SetUint64([]byte("CurrentTerm"), 7)
+	ss.Set([]byte("LastVoteCand"), []byte("node0"))
+
+	ss, err = openFileStableStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if v, _ := ss.GetUint64([]byte("CurrentTerm")); v != 7 {
+		t.Fatalf("term after reopen: %d", v)
+	}
+	if v, _ := ss.Get([]byte("LastVoteCand")); string(v) != "node0" {
+		t.Fatalf("vote after reopen: %q", v)
+	}
+}
@@ -0,0 +1,685 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"gotoraft/pkg/logger"
+	"hash/crc32"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// maxMigrations 是保留的迁移记录数，更早的已结束的迁移被丢弃
+const maxMigrations = 100
+
+// migrationRecoveryInterval 是 0 号组的 Leader 检查中断的迁移的间隔
+const migrationRecoveryInterval = time.Second
+
+// 槽迁移的错误
+var (
+	ErrSlotFrozen       = errors.New("slot is being migrated")
+	ErrSlotMoved        = errors.New("slot has moved to another group")
+	ErrInvalidMigration = errors.New("invalid migration")
+	ErrMigrationBusy    = errors.New("slot already has a running migration")
+)
+
+// 迁移的阶段
+const (
+	MigrationPending   = "pending"   // 等待前面的迁移完成
+	MigrationFreezing  = "freezing"  // 源组停止该槽的写入
+	MigrationCopying   = "copying"   // 将冻结时的数据复制到目标组
+	MigrationHandoff   = "handoff"   // 0 号组记录新的归属，各节点开始将请求路由到目标组
+	MigrationReleasing = "releasing" // 源组删除该槽的数据，之后的写入被告知槽已迁走
+	MigrationAborting  = "aborting"  // 回滚尚未交接的迁移：恢复源组的写入，删除目标组中复制的数据
+	MigrationDone      = "done"
+	MigrationFailed    = "failed"
+)
+
+// migrationTransitions 是迁移记录允许的状态变化
+// 交接之后只能继续释放，回滚开始之后只能结束为失败，失去 Leader 的节点不会覆盖新 Leader 的回滚；
+// handoff 到 releasing 只能由 slot_assign 完成，与归属的变化在同一条日志中
+var migrationTransitions = map[string][]string{
+	MigrationPending:   {MigrationFreezing, MigrationAborting, MigrationFailed},
+	MigrationFreezing:  {MigrationCopying, MigrationAborting},
+	MigrationCopying:   {MigrationCopying, MigrationHandoff, MigrationAborting},
+	MigrationHandoff:   {MigrationAborting},
+	MigrationReleasing: {MigrationDone},
+	MigrationAborting:  {MigrationAborting, MigrationFailed},
+}
+
+// Migration 是一次槽迁移及其进度
+type Migration struct {
+	ID        int64     `json:"id"`
+	Slot      int       `json:"slot"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	State     string    `json:"state"`
+	Keys      int       `json:"keys"`   // 冻结时该槽的键数
+	Copied    int       `json:"copied"` // 已复制到目标组的键数
+	Error     string    `json:"error,omitempty"`
+	StartedAt time.Time `json:"startedAt"` // 取自日志时间
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ended 判断迁移是否已经结束
+func (m *Migration) ended() bool {
+	return m.State == MigrationDone || m.State == MigrationFailed
+}
+
+// slotOf 返回键在 n 个槽中所在的槽
+// 键中含有非空的 {tag} 时只对 tag 计算哈希，使相关的键落在同一个组，可以放在同一个事务中
+func slotOf(key string, n int) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc32.ChecksumIEEE([]byte(key)) % uint32(n))
+}
+
+// commandKeys 返回写命令涉及的键
+func commandKeys(c *command) []string {
+	switch c.Op {
+	case opSet, opDelete, opCompareSwap, opSetIfAbsent, opCompareDel, opIncr:
+		return []string{c.Key}
+	case opTxn:
+		if c.Txn != nil {
+			return c.Txn.Keys()
+		}
+	}
+	return nil
+}
+
+// checkSlots 拒绝正在迁移或已经迁走的槽中的写入，命名空间中的键固定在 0 号组，不参与迁移
+// 过期删除不受限制，目标组中复制的键带有相同的过期时间，调用方需持有读锁
+func (s *Store) checkSlots(c *command) error {
+	if len(s.frozenSlots) == 0 && len(s.movedSlots) == 0 {
+		return nil
+	}
+	for _, key := range commandKeys(c) {
+		if s.namespaceOf(key) != nil {
+			continue
+		}
+		slot := slotOf(key, s.slotCount)
+		if g, ok := s.movedSlots[slot]; ok {
+			return fmt.Errorf("%w: slot %d is owned by group %d", ErrSlotMoved, slot, g)
+		}
+		if _, ok := s.frozenSlots[slot]; ok {
+			return fmt.Errorf("%w: slot %d", ErrSlotFrozen, slot)
+		}
+	}
+	return nil
+}
+
+// slotKeys 返回槽中所有键的当前状态，调用方需持有读锁
+func (s *Store) slotKeys(slot int) []KeyValue {
+	var kvs []KeyValue
+	s.data.Ascend("", func(ki *keyIndex) bool {
+		kv := ki.latest()
+		if kv != nil && slotOf(kv.Key, s.slotCount) == slot && s.namespaceOf(kv.Key) == nil {
+			kvs = append(kvs, *kv)
+		}
+		return true
+	})
+	return kvs
+}
+
+// leasedKey 返回槽中一个绑定了租约的键，没有时返回空字符串
+// 租约只在 0 号组中维护，迁到其他组的键无法随租约过期，因此这样的槽不能迁移
+func (s *Store) leasedKey(slot int) (string, int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return leasedKeyIn(s.slotKeys(slot))
+}
+
+// leasedKeyIn 返回 kvs 中第一个绑定了租约的键
+func leasedKeyIn(kvs []KeyValue) (string, int64) {
+	for _, kv := range kvs {
+		if kv.Lease != 0 {
+			return kv.Key, kv.Lease
+		}
+	}
+	return "", 0
+}
+
+// errSlotLeased 是槽中有绑定租约的键时迁移的错误
+func errSlotLeased(slot int, key string, lease int64) error {
+	return fmt.Errorf("%w: slot %d holds key %q bound to lease %d, revoke the lease or move the key first", ErrInvalidMigration, slot, key, lease)
+}
+
+// applySlotFreeze 停止槽中的写入，调用方需持有写锁
+func (s *Store) applySlotFreeze(c *command) *applyResult {
+	for _, slot := range c.Slots {
+		s.frozenSlots[slot] = struct{}{}
+	}
+	return &applyResult{}
+}
+
+// applySlotUnfreeze 恢复槽中的写入，用于迁移失败时回滚，调用方需持有写锁
+func (s *Store) applySlotUnfreeze(c *command) *applyResult {
+	for _, slot := range c.Slots {
+		delete(s.frozenSlots, slot)
+	}
+	return &applyResult{}
+}
+
+// applySlotImport 在目标组中写入从源组复制的键，保留值和过期时间，调用方需持有写锁
+// 租约只在 0 号组中维护，含有绑定租约的键的槽不会被迁移，见 leasedKey
+func (s *Store) applySlotImport(c *command, index uint64) *applyResult {
+	for _, slot := range c.Slots {
+		delete(s.movedSlots, slot)
+	}
+	s.applyingMigration = true
+	defer func() { s.applyingMigration = false }()
+	for _, kv := range c.Migrated {
+		s.put(kv.Key, kv.Value, index, kv.ExpireAt, 0)
+	}
+	return &applyResult{}
+}
+
+// applySlotAssign 在 0 号组中记录槽的新归属，调用方需持有写锁
+// 带有迁移记录时该迁移必须处于 handoff，同时将其推进到 releasing，已经回滚的迁移不会再交接
+func (s *Store) applySlotAssign(c *command, log *raft.Log) *applyResult {
+	res := &applyResult{}
+	if c.Migration != nil {
+		m, ok := s.migrations[c.Migration.ID]
+		if !ok || m.State != MigrationHandoff {
+			return &applyResult{err: fmt.Errorf("%w: migration %d is not handing off", ErrInvalidMigration, c.Migration.ID)}
+		}
+		m.State, m.UpdatedAt = MigrationReleasing, time.UnixMilli(logTime(log))
+		out := *m
+		res.migration = &out
+	}
+	for _, slot := range c.Slots {
+		s.slotOwners[slot] = c.Group
+		if s.slotHandler != nil {
+			s.slotHandler(slot, c.Group)
+		}
+	}
+	return res
+}
+
+// applySlotRelease 删除槽中的键并记录其新归属，之后的写入返回 ErrSlotMoved，调用方需持有写锁
+// 监听槽中单个键的 watcher 被关闭，需要到新的组重新建立
+func (s *Store) applySlotRelease(c *command, index uint64) *applyResult {
+	s.applyingMigration = true
+	defer func() { s.applyingMigration = false }()
+	for _, slot := range c.Slots {
+		for _, kv := range s.slotKeys(slot) {
+			s.deleteKey(kv.Key, index, false)
+		}
+		s.closeSlotWatchers(slot)
+		delete(s.frozenSlots, slot)
+		s.movedSlots[slot] = c.Group
+	}
+	return &applyResult{}
+}
+
+// applyMigrationUpdate 在 0 号组中创建或更新迁移记录，调用方需持有写锁
+// ID 为 0 时创建新的迁移，ID 取日志索引，同一个槽只能有一个未结束的迁移；状态按 migrationTransitions 变化
+func (s *Store) applyMigrationUpdate(c *command, log *raft.Log) *applyResult {
+	u := c.Migration
+	if u == nil {
+		return &applyResult{err: fmt.Errorf("%w: migration_update without migration", ErrInvalidMigration)}
+	}
+	now := time.UnixMilli(logTime(log))
+	if u.ID == 0 {
+		for _, m := range s.migrations {
+			if m.Slot == u.Slot && !m.ended() {
+				return &applyResult{err: fmt.Errorf("%w: %d", ErrMigrationBusy, u.Slot)}
+			}
+		}
+		m := &Migration{ID: int64(log.Index), Slot: u.Slot, From: u.From, To: u.To, State: MigrationPending, StartedAt: now, UpdatedAt: now}
+		s.migrations[m.ID] = m
+		s.trimMigrations()
+		out := *m
+		return &applyResult{migration: &out}
+	}
+
+	m, ok := s.migrations[u.ID]
+	if !ok {
+		return &applyResult{err: fmt.Errorf("%w: migration %d not found", ErrInvalidMigration, u.ID)}
+	}
+	if !slices.Contains(migrationTransitions[m.State], u.State) {
+		return &applyResult{err: fmt.Errorf("%w: migration %d cannot go from %s to %s", ErrInvalidMigration, m.ID, m.State, u.State)}
+	}
+	m.State, m.Keys, m.Copied, m.Error, m.UpdatedAt = u.State, u.Keys, u.Copied, u.Error, now
+	out := *m
+	return &applyResult{migration: &out}
+}
+
+// trimMigrations 丢弃最早的已结束的迁移，使记录数不超过 maxMigrations，调用方需持有写锁
+func (s *Store) trimMigrations() {
+	if len(s.migrations) <= maxMigrations {
+		return
+	}
+	ids := make([]int64, 0, len(s.migrations))
+	for id := range s.migrations {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		if len(s.migrations) <= maxMigrations {
+			return
+		}
+		if s.migrations[id].ended() {
+			delete(s.migrations, id)
+		}
+	}
+}
+
+// migrationRecords 返回记录的迁移，按 ID 排列
+func (s *Store) migrationRecords() []Migration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Migration, 0, len(s.migrations))
+	for _, m := range s.migrations {
+		out = append(out, *m)
+	}
+	slices.SortFunc(out, func(a, b Migration) int { return cmp.Compare(a.ID, b.ID) })
+	return out
+}
+
+// SetMigrationHandler 设置迁移进度的回调，在执行迁移的 goroutine 中调用
+func (sh *Shards) SetMigrationHandler(fn func(Migration)) {
+	sh.migMu.Lock()
+	defer sh.migMu.Unlock()
+	sh.migrationHandler = fn
+}
+
+// assignSlot 更新槽的路由，由 0 号组应用 slot_assign 时调用
+func (sh *Shards) assignSlot(slot, group int) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if slot < 0 || slot >= len(sh.slots) || group < 0 || group >= len(sh.groups) {
+		logger.Warnf("ignoring assignment of slot %d to group %d", slot, group)
+		return
+	}
+	sh.slots[slot] = group
+}
+
+// Migrations 返回 0 号组记录的迁移，按 ID 排列
+func (sh *Shards) Migrations() []Migration {
+	return sh.groups[0].migrationRecords()
+}
+
+// GetMigration 返回指定 ID 的迁移
+func (sh *Shards) GetMigration(id int64) (*Migration, bool) {
+	g := sh.groups[0]
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	m, ok := g.migrations[id]
+	if !ok {
+		return nil, false
+	}
+	out := *m
+	return &out, true
+}
+
+// Migrate 在后台将槽迁移到目标组，多个迁移依次执行
+// 本节点需要是源组、目标组和 0 号组的 Leader，槽中有绑定租约的键时返回 ErrInvalidMigration
+// 迁移记录保存在 0 号组中，执行迁移的节点崩溃或失去 Leader 后由 0 号组新的 Leader 继续释放或回滚
+func (sh *Shards) Migrate(slot, to int) (*Migration, error) {
+	if slot < 0 || slot >= len(sh.slots) {
+		return nil, fmt.Errorf("%w: slot %d out of range [0, %d)", ErrInvalidMigration, slot, len(sh.slots))
+	}
+	if to < 0 || to >= len(sh.groups) {
+		return nil, fmt.Errorf("%w: group %d out of range [0, %d)", ErrInvalidMigration, to, len(sh.groups))
+	}
+	from := sh.owner(slot)
+	if from == to {
+		return nil, fmt.Errorf("%w: slot %d already belongs to group %d", ErrInvalidMigration, slot, to)
+	}
+	for _, g := range []int{0, from, to} {
+		if !sh.groups[g].IsLeader() {
+			return nil, fmt.Errorf("%w of raft group %d", ErrNotLeader, g)
+		}
+	}
+	if key, lease := sh.groups[from].leasedKey(slot); key != "" {
+		return nil, errSlotLeased(slot, key, lease)
+	}
+
+	// 创建记录和标记为本节点执行之间，恢复循环不会把它当作中断的迁移
+	sh.startMu.Lock()
+	m, err := sh.record(&Migration{Slot: slot, From: from, To: to})
+	if err == nil {
+		sh.migMu.Lock()
+		sh.running[m.ID] = struct{}{}
+		sh.migMu.Unlock()
+	}
+	sh.startMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	go sh.runMigration(m)
+	return m, nil
+}
+
+// AbortMigration 中止尚未交接的迁移：恢复源组中该槽的写入，删除目标组中复制的数据
+// 本节点需要是 0 号组的 Leader；迁移已经交接或已经结束时返回 ErrInvalidMigration
+// 迁移由本节点执行时，执行迁移的 goroutine 在下一步发现中止并回滚，否则在这里回滚
+func (sh *Shards) AbortMigration(id int64) (*Migration, error) {
+	m, ok := sh.GetMigration(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: migration %d not found", ErrInvalidMigration, id)
+	}
+	switch m.State {
+	case MigrationDone, MigrationFailed:
+		return nil, fmt.Errorf("%w: migration %d has already ended", ErrInvalidMigration, id)
+	case MigrationReleasing:
+		return nil, fmt.Errorf("%w: migration %d has already handed slot %d off to group %d", ErrInvalidMigration, id, m.Slot, m.To)
+	}
+	if m.State != MigrationAborting {
+		m.State, m.Error = MigrationAborting, "aborted by request"
+		out, err := sh.record(m)
+		if err != nil {
+			return nil, err
+		}
+		m = out
+	}
+	if sh.isRunning(m.ID) {
+		return m, nil
+	}
+	if err := sh.rollback(m); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// Rebalance 将槽从拥有较多槽的组迁移到较少的组，使各组的槽数相差不超过 1，返回计划的迁移
+// 含有绑定租约的键的槽不会被移出，此时各组的槽数可能无法完全均衡
+func (sh *Shards) Rebalance() ([]Migration, error) {
+	sh.mu.RLock()
+	owned := make([][]int, len(sh.groups))
+	for slot, g := range sh.slots {
+		owned[g] = append(owned[g], slot)
+	}
+	sh.mu.RUnlock()
+
+	// 槽数从多到少排列，前 len(sh.slots)%len(sh.groups) 个组多分一个槽
+	order := make([]int, len(owned))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return len(owned[order[i]]) > len(owned[order[j]]) })
+	want := make([]int, len(owned))
+	for rank, g := range order {
+		want[g] = len(sh.slots) / len(sh.groups)
+		if rank < len(sh.slots)%len(sh.groups) {
+			want[g]++
+		}
+	}
+
+	var moves [][2]int // 槽和目标组
+	var spare []int
+	for g := range owned {
+		for n := len(owned[g]) - 1; n >= 0 && len(owned[g]) > want[g]; n-- {
+			slot := owned[g][n]
+			if key, _ := sh.groups[g].leasedKey(slot); key != "" {
+				continue
+			}
+			spare = append(spare, slot)
+			owned[g] = append(owned[g][:n], owned[g][n+1:]...)
+		}
+	}
+	for g := range owned {
+		for n := len(owned[g]); n < want[g] && len(spare) > 0; n++ {
+			moves = append(moves, [2]int{spare[0], g})
+			spare = spare[1:]
+		}
+	}
+
+	var planned []Migration
+	for _, mv := range moves {
+		m, err := sh.Migrate(mv[0], mv[1])
+		if err != nil {
+			return planned, err
+		}
+		planned = append(planned, *m)
+	}
+	return planned, nil
+}
+
+// owner 返回槽当前所属的组
+func (sh *Shards) owner(slot int) int {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return sh.slots[slot]
+}
+
+// isRunning 判断迁移是否由本节点执行
+func (sh *Shards) isRunning(id int64) bool {
+	sh.migMu.Lock()
+	defer sh.migMu.Unlock()
+	_, ok := sh.running[id]
+	return ok
+}
+
+// record 通过 0 号组提议迁移记录的变化，返回应用后的记录并通知回调
+func (sh *Shards) record(m *Migration) (*Migration, error) {
+	res, err := sh.groups[0].apply(&command{Op: opMigrationUpdate, Migration: m})
+	if err != nil {
+		return nil, err
+	}
+	sh.notifyMigration(res.migration)
+	return res.migration, nil
+}
+
+// notifyMigration 通知迁移进度的回调
+func (sh *Shards) notifyMigration(m *Migration) {
+	sh.migMu.Lock()
+	fn := sh.migrationHandler
+	sh.migMu.Unlock()
+	if fn != nil && m != nil {
+		fn(*m)
+	}
+}
+
+// runMigration 依次执行迁移的各个阶段，失败时回滚尚未交接的迁移
+// 每个阶段先记录到 0 号组，记录失败说明本节点失去了 0 号组的 Leader 或迁移已被中止，
+// 前者由新的 Leader 恢复，后者由本节点回滚
+func (sh *Shards) runMigration(m *Migration) {
+	defer func(id int64) {
+		sh.migMu.Lock()
+		delete(sh.running, id)
+		sh.migMu.Unlock()
+	}(m.ID)
+	sh.migrating.Lock()
+	defer sh.migrating.Unlock()
+
+	from, to := sh.groups[m.From], sh.groups[m.To]
+	slots := []int{m.Slot}
+	// step 记录迁移进入下一个状态
+	step := func(update func(m *Migration)) bool {
+		next := *m
+		update(&next)
+		out, err := sh.record(&next)
+		if err != nil {
+			sh.interrupted(m, err)
+			return false
+		}
+		*m = *out
+		return true
+	}
+	fail := func(err error) {
+		logger.Errorf("migration %d of slot %d from group %d to %d failed: %v", m.ID, m.Slot, m.From, m.To, err)
+		if m.State == MigrationPending {
+			// 尚未冻结，不需要回滚
+			step(func(m *Migration) { m.State, m.Error = MigrationFailed, err.Error() })
+			return
+		}
+		sh.abort(m, err)
+	}
+
+	// 等待期间其他迁移可能已经改变了槽的归属
+	if owner := sh.owner(m.Slot); owner != m.From {
+		fail(fmt.Errorf("%w: slot %d now belongs to group %d", ErrInvalidMigration, m.Slot, owner))
+		return
+	}
+
+	if !step(func(m *Migration) { m.State = MigrationFreezing }) {
+		return
+	}
+	if _, err := from.apply(&command{Op: opSlotFreeze, Slots: slots}); err != nil {
+		fail(err)
+		return
+	}
+
+	// 冻结已经应用，此时读取到的就是该槽最终的数据
+	from.mu.RLock()
+	kvs := from.slotKeys(m.Slot)
+	from.mu.RUnlock()
+	// 冻结之前可能有新的键绑定了租约
+	if key, lease := leasedKeyIn(kvs); key != "" {
+		fail(errSlotLeased(m.Slot, key, lease))
+		return
+	}
+	if !step(func(m *Migration) { m.State, m.Keys = MigrationCopying, len(kvs) }) {
+		return
+	}
+	batch := max(to.maxBatchSize, 1)
+	for start := 0; start == 0 || start < len(kvs); start += batch {
+		end := min(start+batch, len(kvs))
+		if _, err := to.apply(&command{Op: opSlotImport, Slots: slots, Migrated: kvs[start:end]}); err != nil {
+			fail(err)
+			return
+		}
+		if !step(func(m *Migration) { m.Copied = end }) {
+			return
+		}
+	}
+
+	if !step(func(m *Migration) { m.State = MigrationHandoff }) {
+		return
+	}
+	res, err := sh.groups[0].apply(&command{Op: opSlotAssign, Slots: slots, Group: m.To, Migration: &Migration{ID: m.ID}})
+	if err != nil {
+		sh.interrupted(m, err)
+		return
+	}
+	*m = *res.migration
+	sh.notifyMigration(m)
+
+	sh.release(m)
+}
+
+// interrupted 处理记录迁移失败的情况：迁移已被中止时由本节点回滚，否则留给 0 号组的 Leader 恢复
+func (sh *Shards) interrupted(m *Migration, err error) {
+	if cur, ok := sh.GetMigration(m.ID); ok && cur.State == MigrationAborting {
+		logger.Warnf("migration %d of slot %d was aborted: %s", m.ID, m.Slot, cur.Error)
+		*m = *cur
+		sh.rollback(m)
+		return
+	}
+	logger.Warnf("migration %d of slot %d interrupted, the leader of raft group 0 will recover it: %v", m.ID, m.Slot, err)
+}
+
+// abort 记录迁移开始回滚，然后回滚
+func (sh *Shards) abort(m *Migration, cause error) {
+	next := *m
+	next.State, next.Error = MigrationAborting, cause.Error()
+	out, err := sh.record(&next)
+	if err != nil {
+		sh.interrupted(m, err)
+		return
+	}
+	*m = *out
+	sh.rollback(m)
+}
+
+// rollback 恢复源组中该槽的写入并删除目标组中复制的数据，两者都成功后将迁移记录为失败
+// 任何一步失败时返回错误，迁移保持在 aborting，由 0 号组的 Leader 重试
+func (sh *Shards) rollback(m *Migration) error {
+	slots := []int{m.Slot}
+	var errs []error
+	if _, err := sh.groups[m.From].apply(&command{Op: opSlotUnfreeze, Slots: slots}); err != nil {
+		errs = append(errs, fmt.Errorf("unfreeze slot %d in raft group %d: %w", m.Slot, m.From, err))
+	}
+	if _, err := sh.groups[m.To].apply(&command{Op: opSlotRelease, Slots: slots, Group: m.From}); err != nil {
+		errs = append(errs, fmt.Errorf("release slot %d in raft group %d: %w", m.Slot, m.To, err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		logger.Errorf("rollback of migration %d of slot %d failed, will retry: %v", m.ID, m.Slot, err)
+		return err
+	}
+	next := *m
+	next.State = MigrationFailed
+	out, err := sh.record(&next)
+	if err != nil {
+		return fmt.Errorf("record rollback of migration %d: %w", m.ID, err)
+	}
+	*m = *out
+	return nil
+}
+
+// release 删除源组中已经交接的槽的数据，然后将迁移记录为完成
+// 归属已经交接，源组中残留的数据不再可见，写入仍被冻结；失败时迁移保持在 releasing，由 0 号组的 Leader 重试
+func (sh *Shards) release(m *Migration) error {
+	if _, err := sh.groups[m.From].apply(&command{Op: opSlotRelease, Slots: []int{m.Slot}, Group: m.To}); err != nil {
+		logger.Errorf("release of migration %d of slot %d failed, will retry: %v", m.ID, m.Slot, err)
+		return err
+	}
+	next := *m
+	next.State = MigrationDone
+	out, err := sh.record(&next)
+	if err != nil {
+		return fmt.Errorf("record release of migration %d: %w", m.ID, err)
+	}
+	*m = *out
+	return nil
+}
+
+// runMigrationRecovery 在 0 号组的 Leader 上定期恢复中断的迁移，直到 Shards 关闭
+func (sh *Shards) runMigrationRecovery() {
+	defer sh.wg.Done()
+	ticker := time.NewTicker(migrationRecoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sh.shutdownCh:
+			return
+		case <-ticker.C:
+			if !sh.groups[0].IsLeader() {
+				continue
+			}
+			sh.startMu.Lock()
+			var interrupted []Migration
+			for _, m := range sh.Migrations() {
+				if !m.ended() && !sh.isRunning(m.ID) {
+					interrupted = append(interrupted, m)
+				}
+			}
+			sh.startMu.Unlock()
+			for i := range interrupted {
+				sh.recoverMigration(&interrupted[i])
+			}
+		}
+	}
+}
+
+// recoverMigration 恢复不由本节点执行的未结束的迁移：已经交接的继续释放，其余的回滚
+// 交接由 slot_assign 与迁移记录在同一条日志中完成，处于 handoff 的迁移一定尚未交接
+func (sh *Shards) recoverMigration(m *Migration) {
+	switch m.State {
+	case MigrationReleasing:
+		logger.Infof("resuming release of migration %d of slot %d", m.ID, m.Slot)
+		sh.release(m)
+	case MigrationPending:
+		m.State, m.Error = MigrationFailed, "interrupted before the slot was frozen"
+		if _, err := sh.record(m); err != nil {
+			logger.Errorf("failed to record interrupted migration %d: %v", m.ID, err)
+		}
+	case MigrationAborting:
+		sh.rollback(m)
+	default:
+		logger.Infof("rolling back interrupted migration %d of slot %d in state %s", m.ID, m.Slot, m.State)
+		sh.abort(m, fmt.Errorf("interrupted in state %s", m.State))
+	}
+}
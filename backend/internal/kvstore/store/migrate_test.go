@@ -0,0 +1,387 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openShards 启动单节点的多个 Raft 组并等待它们都成为 Leader
+func openShards(t *testing.T, groups, slots int) *Shards {
+	t.Helper()
+	sh, err := NewShards(NewStore(t.TempDir(), "127.0.0.1:0", true), ShardConfig{Groups: groups, Slots: slots})
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	if err := sh.Open(true, "node0"); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { sh.Shutdown() })
+	deadline := time.Now().Add(5 * time.Second)
+	for _, g := range sh.Groups() {
+		for !g.IsLeader() {
+			if time.Now().After(deadline) {
+				t.Fatalf("groups did not elect leaders")
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	return sh
+}
+
+// waitMigration 等待迁移结束并返回最终状态
+func waitMigration(t *testing.T, sh *Shards, id int64) *Migration {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		m, _ := sh.GetMigration(id)
+		if m.State == MigrationDone || m.State == MigrationFailed {
+			return m
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("migration %d stuck in %s", id, m.State)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestShards_MigrateSlot(t *testing.T) {
+	sh := openShards(t, 2, 8)
+	var mu sync.Mutex
+	var states []string
+	sh.SetMigrationHandler(func(m Migration) {
+		mu.Lock()
+		states = append(states, m.State)
+		mu.Unlock()
+	})
+
+	slot := sh.SlotOf("{s}")
+	from := sh.GroupOf("{s}")
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("{s}:%d", i)
+		if _, err := sh.Group(from).Put(key, fmt.Sprint(i), PutOptions{TTL: time.Hour}); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	m, err := sh.Migrate(slot, 1-from)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if _, err := sh.Migrate(slot, 1-from); !errors.Is(err, ErrMigrationBusy) && !errors.Is(err, ErrInvalidMigration) {
+		t.Fatalf("second migration of the slot: %v", err)
+	}
+	m = waitMigration(t, sh, m.ID)
+	if m.State != MigrationDone || m.Keys != 5 || m.Copied != 5 {
+		t.Fatalf("migration: %+v", m)
+	}
+
+	to := sh.Group(1 - from)
+	if sh.GroupOf("{s}:0") != 1-from {
+		t.Fatalf("routing not updated")
+	}
+	kv, err := to.GetAt("{s}:3", 0, Linearizable)
+	if err != nil || kv.Value != "3" || kv.ExpireAt == 0 {
+		t.Fatalf("migrated key: %+v, %v", kv, err)
+	}
+	if _, err := sh.Group(from).GetAt("{s}:3", 0, Linearizable); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("source still has the key: %v", err)
+	}
+	if _, err := sh.Group(from).Put("{s}:9", "x", PutOptions{}); !errors.Is(err, ErrSlotMoved) {
+		t.Fatalf("write to the old group: got %v, want %v", err, ErrSlotMoved)
+	}
+	if _, err := to.Put("{s}:9", "x", PutOptions{}); err != nil {
+		t.Fatalf("write to the new group: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{MigrationPending, MigrationFreezing, MigrationCopying, MigrationCopying, MigrationHandoff, MigrationReleasing, MigrationDone}
+	if fmt.Sprint(states) != fmt.Sprint(want) {
+		t.Fatalf("migration events: %v, want %v", states, want)
+	}
+}
+
+func TestShards_RebalanceEvensOutGroups(t *testing.T) {
+	sh := openShards(t, 3, 9)
+	// 先把 2 号组的槽都迁到 0 号组
+	for _, r := range sh.SlotRanges(2) {
+		for slot := r.Start; slot <= r.End; slot++ {
+			m, err := sh.Migrate(slot, 0)
+			if err != nil {
+				t.Fatalf("migrate slot %d: %v", slot, err)
+			}
+			if m = waitMigration(t, sh, m.ID); m.State != MigrationDone {
+				t.Fatalf("migration: %+v", m)
+			}
+		}
+	}
+	if len(sh.SlotRanges(2)) != 0 {
+		t.Fatalf("group 2 still owns %v", sh.SlotRanges(2))
+	}
+
+	planned, err := sh.Rebalance()
+	if err != nil || len(planned) != 3 {
+		t.Fatalf("rebalance: %d migrations, %v", len(planned), err)
+	}
+	for _, m := range planned {
+		if m := waitMigration(t, sh, m.ID); m.State != MigrationDone || m.To != 2 {
+			t.Fatalf("rebalance migration: %+v", m)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		n := 0
+		for _, r := range sh.SlotRanges(i) {
+			n += r.End - r.Start + 1
+		}
+		if n != 3 {
+			t.Fatalf("group %d owns %d slots after rebalance", i, n)
+		}
+	}
+}
+
+func TestSlots_SurviveSnapshot(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	s.slotCount = 4
+	f := newFSM(s)
+	slot := slotOf("k", 4)
+	applyCommand(t, f, 1, &command{Op: opSlotAssign, Slots: []int{slot}, Group: 2})
+	applyCommand(t, f, 2, &command{Op: opSlotRelease, Slots: []int{slot}, Group: 2})
+	applyCommand(t, f, 3, &command{Op: opSlotFreeze, Slots: []int{(slot + 1) % 4}})
+
+	snap, _ := f.Snapshot()
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	restored := NewStore(t.TempDir(), "", true)
+	restored.slotCount = 4
+	owners := make(map[int]int)
+	restored.slotHandler = func(slot, group int) { owners[slot] = group }
+	rf := newFSM(restored)
+	if err := rf.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	if owners[slot] != 2 {
+		t.Fatalf("slot owners after restore: %v", owners)
+	}
+	if res := applyCommand(t, rf, 4, &command{Op: opSet, Key: "k", Value: "v"}); !errors.Is(res.err, ErrSlotMoved) {
+		t.Fatalf("write to moved slot: got %v, want %v", res.err, ErrSlotMoved)
+	}
+	if len(restored.frozenSlots) != 1 {
+		t.Fatalf("frozen slots after restore: %v", restored.frozenSlots)
+	}
+}
+
+func TestShards_MigrateRefusesLeasedKeys(t *testing.T) {
+	sh := openShards(t, 2, 8)
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("{l%d}", i); sh.GroupOf(k) == 0 {
+			key = k
+		}
+	}
+	lease, err := sh.Group(0).GrantLease(time.Minute)
+	if err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	if _, err := sh.Group(0).Put(key, "v", PutOptions{Lease: lease.ID}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	slot := sh.SlotOf(key)
+	if _, err := sh.Migrate(slot, 1); !errors.Is(err, ErrInvalidMigration) {
+		t.Fatalf("migrate a slot with a leased key: got %v, want %v", err, ErrInvalidMigration)
+	}
+	planned, err := sh.Rebalance()
+	if err != nil {
+		t.Fatalf("rebalance: %v", err)
+	}
+	for _, m := range planned {
+		if m.Slot == slot {
+			t.Fatalf("rebalance planned to move slot %d with a leased key", slot)
+		}
+		waitMigration(t, sh, m.ID)
+	}
+
+	// 撤销租约后键被删除，槽可以迁移
+	if _, err := sh.Group(0).RevokeLease(lease.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	m, err := sh.Migrate(slot, 1)
+	if err != nil {
+		t.Fatalf("migrate after revoke: %v", err)
+	}
+	if m = waitMigration(t, sh, m.ID); m.State != MigrationDone {
+		t.Fatalf("migration: %+v", m)
+	}
+}
+
+func TestShards_ScanSkipsKeysOfOtherGroups(t *testing.T) {
+	sh, err := NewShards(NewStore(t.TempDir(), "127.0.0.1:0", true), ShardConfig{Groups: 2, Slots: 8})
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("k%d", i); sh.GroupOf(k) == 0 {
+			key = k
+		}
+	}
+	src, dst := newFSM(sh.Group(0)), newFSM(sh.Group(1))
+	applyCommand(t, src, 1, &command{Op: opSet, Key: key, Value: "v"})
+	// 复制到目标组之后、交接之前，键同时存在于两个组
+	slot := sh.SlotOf(key)
+	applyCommand(t, dst, 5, &command{Op: opSlotImport, Slots: []int{slot}, Migrated: []KeyValue{{Key: key, Value: "v"}}})
+
+	res, err := sh.Scan(ScanOptions{}, Stale)
+	if err != nil || len(res.KVs) != 1 {
+		t.Fatalf("scan before handoff: %+v, %v", res, err)
+	}
+	applyCommand(t, src, 2, &command{Op: opSlotAssign, Slots: []int{slot}, Group: 1})
+	res, err = sh.Scan(ScanOptions{}, Stale)
+	if err != nil || len(res.KVs) != 1 || res.KVs[0].ModRevision != 5 {
+		t.Fatalf("scan after handoff: %+v, %v", res, err)
+	}
+}
+
+func TestMigration_RecordIsReplicated(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	s.slotCount = 4
+	f := newFSM(s)
+
+	res := applyCommand(t, f, 1, &command{Op: opMigrationUpdate, Migration: &Migration{Slot: 2, From: 0, To: 1}})
+	if res.err != nil || res.migration.ID != 1 || res.migration.State != MigrationPending {
+		t.Fatalf("create: %+v, %v", res.migration, res.err)
+	}
+	if res := applyCommand(t, f, 2, &command{Op: opMigrationUpdate, Migration: &Migration{Slot: 2, From: 0, To: 1}}); !errors.Is(res.err, ErrMigrationBusy) {
+		t.Fatalf("second migration of the slot: %v", res.err)
+	}
+	applyCommand(t, f, 3, &command{Op: opMigrationUpdate, Migration: &Migration{ID: 1, State: MigrationFreezing}})
+	applyCommand(t, f, 4, &command{Op: opMigrationUpdate, Migration: &Migration{ID: 1, State: MigrationCopying, Keys: 3}})
+
+	// 交接只能由 slot_assign 完成，回滚开始之后不能回到之前的状态
+	if res := applyCommand(t, f, 5, &command{Op: opMigrationUpdate, Migration: &Migration{ID: 1, State: MigrationReleasing}}); !errors.Is(res.err, ErrInvalidMigration) {
+		t.Fatalf("releasing without assign: %v", res.err)
+	}
+	applyCommand(t, f, 6, &command{Op: opMigrationUpdate, Migration: &Migration{ID: 1, State: MigrationAborting, Keys: 3, Error: "boom"}})
+	if res := applyCommand(t, f, 7, &command{Op: opMigrationUpdate, Migration: &Migration{ID: 1, State: MigrationCopying, Keys: 3, Copied: 3}}); !errors.Is(res.err, ErrInvalidMigration) {
+		t.Fatalf("stale update after abort: %v", res.err)
+	}
+	if res := applyCommand(t, f, 8, &command{Op: opSlotAssign, Slots: []int{2}, Group: 1, Migration: &Migration{ID: 1}}); !errors.Is(res.err, ErrInvalidMigration) {
+		t.Fatalf("assign of aborted migration: %v", res.err)
+	}
+	if _, ok := s.slotOwners[2]; ok {
+		t.Fatalf("aborted migration changed the owner of slot 2")
+	}
+
+	snap, _ := f.Snapshot()
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	restored := NewStore(t.TempDir(), "", true)
+	rf := newFSM(restored)
+	if err := rf.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if ms := restored.migrationRecords(); len(ms) != 1 || ms[0].State != MigrationAborting || ms[0].Error != "boom" || ms[0].Keys != 3 {
+		t.Fatalf("migrations after restore: %+v", ms)
+	}
+}
+
+// interruptMigration 冻结槽并记录一个处于 state 的迁移，模拟执行迁移的节点在此时崩溃
+// 调用方持有 startMu，恢复循环在它释放之后才会看到该迁移
+func interruptMigration(t *testing.T, sh *Shards, slot, from, to int, state string) *Migration {
+	t.Helper()
+	m, err := sh.record(&Migration{Slot: slot, From: from, To: to})
+	if err != nil {
+		t.Fatalf("create migration: %v", err)
+	}
+	if _, err := sh.Group(from).apply(&command{Op: opSlotFreeze, Slots: []int{slot}}); err != nil {
+		t.Fatalf("freeze: %v", err)
+	}
+	for _, next := range []string{MigrationFreezing, MigrationCopying, MigrationHandoff} {
+		m.State = next
+		if m, err = sh.record(m); err != nil {
+			t.Fatalf("record %s: %v", next, err)
+		}
+		if next == state {
+			break
+		}
+	}
+	return m
+}
+
+func TestShards_RecoverInterruptedMigration(t *testing.T) {
+	sh := openShards(t, 2, 8)
+	slot := sh.SlotOf("{s}")
+	from := sh.GroupOf("{s}")
+	if _, err := sh.Group(from).Put("{s}:1", "v", PutOptions{}); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	// 尚未交接的迁移被回滚，槽恢复写入
+	sh.startMu.Lock()
+	m := interruptMigration(t, sh, slot, from, 1-from, MigrationCopying)
+	sh.startMu.Unlock()
+	if _, err := sh.Group(from).Put("{s}:2", "v", PutOptions{}); !errors.Is(err, ErrSlotFrozen) {
+		t.Fatalf("write during migration: %v", err)
+	}
+	if m = waitMigration(t, sh, m.ID); m.State != MigrationFailed || m.Error == "" {
+		t.Fatalf("recovered migration: %+v", m)
+	}
+	if _, err := sh.Group(from).Put("{s}:2", "v", PutOptions{}); err != nil {
+		t.Fatalf("write after rollback: %v", err)
+	}
+
+	// 已经交接的迁移继续释放
+	sh.startMu.Lock()
+	m = interruptMigration(t, sh, slot, from, 1-from, MigrationHandoff)
+	to := sh.Group(1 - from)
+	kvs := []KeyValue{{Key: "{s}:1", Value: "v"}, {Key: "{s}:2", Value: "v"}}
+	if _, err := to.apply(&command{Op: opSlotImport, Slots: []int{slot}, Migrated: kvs}); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if _, err := sh.Group(0).apply(&command{Op: opSlotAssign, Slots: []int{slot}, Group: 1 - from, Migration: &Migration{ID: m.ID}}); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	sh.startMu.Unlock()
+	if m = waitMigration(t, sh, m.ID); m.State != MigrationDone {
+		t.Fatalf("resumed migration: %+v", m)
+	}
+	if _, err := sh.Group(from).Put("{s}:3", "v", PutOptions{}); !errors.Is(err, ErrSlotMoved) {
+		t.Fatalf("write to the old group: got %v, want %v", err, ErrSlotMoved)
+	}
+	if kv, err := to.GetAt("{s}:2", 0, Linearizable); err != nil || kv.Value != "v" {
+		t.Fatalf("migrated key: %+v, %v", kv, err)
+	}
+}
+
+func TestShards_AbortMigration(t *testing.T) {
+	sh := openShards(t, 2, 8)
+	slot := sh.SlotOf("{s}")
+	from := sh.GroupOf("{s}")
+
+	// 持有 startMu，恢复循环不会先回滚
+	sh.startMu.Lock()
+	m := interruptMigration(t, sh, slot, from, 1-from, MigrationCopying)
+	m, err := sh.AbortMigration(m.ID)
+	sh.startMu.Unlock()
+	if err != nil || m.State != MigrationFailed {
+		t.Fatalf("abort: %+v, %v", m, err)
+	}
+	if _, err := sh.Group(from).Put("{s}:1", "v", PutOptions{}); err != nil {
+		t.Fatalf("write after abort: %v", err)
+	}
+	if _, err := sh.AbortMigration(m.ID); !errors.Is(err, ErrInvalidMigration) {
+		t.Fatalf("abort of an ended migration: %v", err)
+	}
+	if _, err := sh.AbortMigration(12345); !errors.Is(err, ErrInvalidMigration) {
+		t.Fatalf("abort of an unknown migration: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"errors"
+	"sort"
+)
+
+// 多版本相关的错误
+var (
+	ErrCompacted      = errors.New("requested revision has been compacted")
+	ErrFutureRevision = errors.New("requested revision is newer than the current revision")
+)
+
+// keyIndex 保存一个键按修订号升序排列的历史版本
+// 删除以 Version 为 0 的墓碑版本记录，压缩后历史可能为空，此时键会从索引中移除
+type keyIndex struct {
+	Key  string     `json:"key"`
+	Revs []KeyValue `json:"revs"`
+}
+
+// tombstone 判断版本是否为删除标记
+func (kv *KeyValue) tombstone() bool {
+	return kv.Version == 0
+}
+
+// latest 返回键当前的值，不存在或已删除时返回 nil
+func (ki *keyIndex) latest() *KeyValue {
+	if len(ki.Revs) == 0 {
+		return nil
+	}
+	kv := ki.Revs[len(ki.Revs)-1]
+	if kv.tombstone() {
+		return nil
+	}
+	return &kv
+}
+
+// at 返回键在修订号 rev 时的值，当时不存在或已删除时返回 nil
+func (ki *keyIndex) at(rev uint64) *KeyValue {
+	i := sort.Search(len(ki.Revs), func(i int) bool { return ki.Revs[i].ModRevision > rev })
+	if i == 0 {
+		return nil
+	}
+	kv := ki.Revs[i-1]
+	if kv.tombstone() {
+		return nil
+	}
+	return &kv
+}
+
+// current 返回键当前的值，调用方需持有读锁
+func (s *Store) current(key string) (*KeyValue, bool) {
+	ki, ok := s.data.Get(key)
+	if !ok {
+		return nil, false
+	}
+	kv := ki.latest()
+	return kv, kv != nil
+}
+
+// put 在修订号 index 写入新版本并返回，expireAt 为 0 表示不过期，lease 为 0 表示不绑定租约
+// 调用方需持有写锁，并保证租约存在
+func (s *Store) put(key, value string, index uint64, expireAt, lease int64) *KeyValue {
+	ki, ok := s.data.Get(key)
+	if !ok {
+		ki = &keyIndex{Key: key}
+		s.data.Set(ki)
+	}
+
+	kv := KeyValue{
+		Key:            key,
+		Value:          value,
+		CreateRevision: index,
+		ModRevision:    index,
+		Version:        1,
+		ModTerm:        s.term,
+		ModTime:        s.appliedAt,
+		ExpireAt:       expireAt,
+		Lease:          lease,
+	}
+	prev := ki.latest()
+	if prev != nil {
+		kv.CreateRevision = prev.CreateRevision
+		kv.Version = prev.Version + 1
+	}
+	ki.Revs = append(ki.Revs, kv)
+	s.markDirty(key)
+	s.size += kvSize(&kv)
+	s.trackTTL(key, expireAt)
+	s.attachLease(key, prev, lease)
+	s.account(key, prev, &kv)
+	s.notify(Event{Type: EventPut, KV: kv, PrevKV: prev})
+	return &kv
+}
+
+// remove 在修订号 index 删除键并返回被删除的值，键不存在时不产生新版本，调用方需持有写锁
+func (s *Store) remove(key string, index uint64) *KeyValue {
+	return s.deleteKey(key, index, false)
+}
+
+// deleteKey 写入删除标记，expired 表示删除由过期引起，调用方需持有写锁
+func (s *Store) deleteKey(key string, index uint64, expired bool) *KeyValue {
+	ki, ok := s.data.Get(key)
+	if !ok {
+		return nil
+	}
+	prev := ki.latest()
+	if prev == nil {
+		return nil
+	}
+	tomb := KeyValue{Key: key, ModRevision: index, ModTerm: s.term, ModTime: s.appliedAt}
+	ki.Revs = append(ki.Revs, tomb)
+	s.markDirty(key)
+	s.size += kvSize(&tomb)
+	s.trackTTL(key, 0)
+	s.attachLease(key, prev, 0)
+	s.account(key, prev, nil)
+	s.notify(Event{Type: EventDelete, KV: tomb, PrevKV: prev, Expired: expired})
+	return prev
+}
+
+// checkRevision 检查修订号能否读取，0 表示当前修订号，调用方需持有读锁
+func (s *Store) checkRevision(rev uint64) (uint64, error) {
+	if rev == 0 {
+		return s.revision, nil
+	}
+	if rev < s.compactRevision {
+		return 0, ErrCompacted
+	}
+	if rev > s.revision {
+		return 0, ErrFutureRevision
+	}
+	return rev, nil
+}
+
+// compact 丢弃修订号 rev 之前不再可见的历史版本，调用方需持有写锁
+func (s *Store) compact(rev uint64) error {
+	if rev <= s.compactRevision {
+		return ErrCompacted
+	}
+	if rev > s.revision {
+		return ErrFutureRevision
+	}
+
+	var empty []string
+	s.data.Ascend("", func(ki *keyIndex) bool {
+		// 保留 rev 时可见的版本，即 ModRevision <= rev 的最后一个
+		i := sort.Search(len(ki.Revs), func(i int) bool { return ki.Revs[i].ModRevision > rev })
+		if i > 0 {
+			keep := i - 1
+			if ki.Revs[keep].tombstone() {
+				keep = i
+			}
+			for j := range ki.Revs[:keep] {
+				s.size -= kvSize(&ki.Revs[j])
+			}
+			if keep > 0 {
+				ki.Revs = ki.Revs[keep:]
+				s.markDirty(ki.Key)
+			}
+		}
+		if len(ki.Revs) == 0 {
+			empty = append(empty, ki.Key)
+		}
+		return true
+	})
+	for _, key := range empty {
+		s.data.Delete(key)
+	}
+	s.compactRevision = rev
+	return nil
+}
+
+// GetAt 读取键在指定修订号时的值，rev 为 0 表示当前值
+func (s *Store) GetAt(key string, rev uint64, lvl ConsistencyLevel) (*KeyValue, error) {
+	if err := s.readBarrier(lvl); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rev, err := s.checkRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	ki, ok := s.data.Get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	kv := ki.at(rev)
+	if kv == nil {
+		return nil, ErrKeyNotFound
+	}
+	return kv, nil
+}
+
+// History 返回键保留的所有历史版本，删除以 Version 为 0 的版本表示
+func (s *Store) History(key string, lvl ConsistencyLevel) ([]KeyValue, error) {
+	if err := s.readBarrier(lvl); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ki, ok := s.data.Get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return append([]KeyValue(nil), ki.Revs...), nil
+}
+
+// Revisions 返回当前修订号和已压缩的修订号
+func (s *Store) Revisions() (revision, compactRevision uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revision, s.compactRevision
+}
+
+// Compact 通过 Raft 压缩修订号 rev 之前的历史
+func (s *Store) Compact(rev uint64) error {
+	_, err := s.apply(&command{Op: opCompact, Revision: rev})
+	return err
+}
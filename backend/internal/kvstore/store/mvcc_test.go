@@ -0,0 +1,127 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestMVCC_HistoricalReads(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v1"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v2"})
+	applyCommand(t, f, 3, &command{Op: opDelete, Key: "k"})
+	applyCommand(t, f, 4, &command{Op: opSet, Key: "k", Value: "v3"})
+
+	cases := []struct {
+		rev     uint64
+		value   string
+		create  uint64
+		version int64
+		err     error
+	}{
+		{rev: 1, value: "v1", create: 1, version: 1},
+		{rev: 2, value: "v2", create: 1, version: 2},
+		{rev: 3, err: ErrKeyNotFound},
+		{rev: 4, value: "v3", create: 4, version: 1},
+		{rev: 0, value: "v3", create: 4, version: 1},
+		{rev: 5, err: ErrFutureRevision},
+	}
+	for _, c := range cases {
+		kv, err := s.GetAt("k", c.rev, Stale)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("rev %d: got err %v, want %v", c.rev, err, c.err)
+			}
+			continue
+		}
+		if err != nil || kv.Value != c.value || kv.CreateRevision != c.create || kv.Version != c.version {
+			t.Errorf("rev %d: got %+v, %v", c.rev, kv, err)
+		}
+	}
+
+	hist, err := s.History("k", Stale)
+	if err != nil || len(hist) != 4 || !hist[2].tombstone() {
+		t.Fatalf("history: %+v, %v", hist, err)
+	}
+
+	res, err := s.Scan(ScanOptions{Revision: 3}, Stale)
+	if err != nil || len(res.KVs) != 0 || res.Revision != 3 {
+		t.Fatalf("scan at deleted revision: %+v, %v", res, err)
+	}
+}
+
+func TestMVCC_Compact(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "a", Value: "a1"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "b", Value: "b1"})
+	applyCommand(t, f, 3, &command{Op: opSet, Key: "a", Value: "a2"})
+	applyCommand(t, f, 4, &command{Op: opDelete, Key: "b"})
+	applyCommand(t, f, 5, &command{Op: opSet, Key: "a", Value: "a3"})
+
+	if res := applyCommand(t, f, 6, &command{Op: opCompact, Revision: 4}); res.err != nil {
+		t.Fatalf("compact: %v", res.err)
+	}
+
+	if _, err := s.GetAt("a", 2, Stale); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("read before compact revision: got %v", err)
+	}
+	if kv, err := s.GetAt("a", 4, Stale); err != nil || kv.Value != "a2" {
+		t.Fatalf("read at compact revision: %+v, %v", kv, err)
+	}
+	if hist, _ := s.History("a", Stale); len(hist) != 2 {
+		t.Fatalf("a should keep 2 versions, got %+v", hist)
+	}
+	if _, err := s.History("b", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("deleted key should be dropped by compaction, got %v", err)
+	}
+	if res := applyCommand(t, f, 7, &command{Op: opCompact, Revision: 3}); !errors.Is(res.err, ErrCompacted) {
+		t.Fatalf("compacting an older revision: got %v", res.err)
+	}
+}
+
+func TestFSM_SnapshotRestoreKeepsHistory(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v1"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v2"})
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+
+	restored := NewStore(t.TempDir(), "", true)
+	if err := newFSM(restored).Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if kv, err := restored.GetAt("k", 1, Stale); err != nil || kv.Value != "v1" {
+		t.Fatalf("restored history: %+v, %v", kv, err)
+	}
+	if rev, _ := restored.Revisions(); rev != 2 {
+		t.Fatalf("restored revision: got %d, want 2", rev)
+	}
+}
+
+// memorySink 是写入内存的 raft.SnapshotSink
+type memorySink struct {
+	buf bytes.Buffer
+}
+
+func (m *memorySink) Write(p []byte) (int, error) { return m.buf.Write(p) }
+func (m *memorySink) Close() error                { return nil }
+func (m *memorySink) ID() string                  { return "memory" }
+func (m *memorySink) Cancel() error               { return nil }
+
+var _ raft.SnapshotSink = (*memorySink)(nil)
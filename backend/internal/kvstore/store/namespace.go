@@ -0,0 +1,308 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 命名空间的错误
+var (
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+	ErrInvalidNamespace  = errors.New("invalid namespace name")
+	ErrQuotaExceeded     = errors.New("namespace quota exceeded")
+)
+
+// NamespaceSeparator 分隔命名空间和键，命名空间 ns 中的键 k 在存储中为 "ns/k"
+const NamespaceSeparator = "/"
+
+var namespaceName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Quota 命名空间的配额，0 表示不限
+type Quota struct {
+	MaxKeys      int64 `json:"maxKeys,omitempty"`      // 键的数量
+	MaxBytes     int64 `json:"maxBytes,omitempty"`     // 所有键和当前值的总字节数
+	MaxValueSize int64 `json:"maxValueSize,omitempty"` // 单个值的字节数
+}
+
+// NamespaceUsage 命名空间当前的用量，只统计各键的最新版本
+type NamespaceUsage struct {
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Namespace 是一个带配额的键前缀
+type Namespace struct {
+	Name           string         `json:"name"`
+	Quota          Quota          `json:"quota"`
+	Usage          NamespaceUsage `json:"usage"`
+	CreateRevision uint64         `json:"createRevision"`
+}
+
+// ValidateNamespace 检查命名空间名称：1 到 64 个字母、数字、下划线或连字符
+func ValidateNamespace(name string) error {
+	if !namespaceName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidNamespace, name)
+	}
+	return nil
+}
+
+// NamespaceKey 返回命名空间 ns 中的键 key 在存储中的键，ns 为空时原样返回
+func NamespaceKey(ns, key string) string {
+	if ns == "" {
+		return key
+	}
+	return ns + NamespaceSeparator + key
+}
+
+// WithNamespace 要求写操作所在的命名空间存在，命名空间不存在时返回 ErrNamespaceNotFound
+// 操作中的键需要已经带有命名空间前缀，见 NamespaceKey
+func WithNamespace(ns string) WriteOption {
+	return func(c *command) {
+		c.Namespace = ns
+	}
+}
+
+// CreateNamespace 创建命名空间，前缀下已有的键计入用量
+func (s *Store) CreateNamespace(name string, q Quota, wopts ...WriteOption) (*Namespace, error) {
+	if err := ValidateNamespace(name); err != nil {
+		return nil, err
+	}
+	res, err := s.apply(&command{Op: opNamespaceCreate, Namespace: name, Quota: &q}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.namespace, res.err
+}
+
+// SetNamespaceQuota 修改命名空间的配额，已超出新配额的用量不受影响，但不能再增长
+func (s *Store) SetNamespaceQuota(name string, q Quota, wopts ...WriteOption) (*Namespace, error) {
+	res, err := s.apply(&command{Op: opNamespaceQuota, Namespace: name, Quota: &q}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.namespace, res.err
+}
+
+// DeleteNamespace 删除命名空间及其中所有的键，返回删除前的用量
+func (s *Store) DeleteNamespace(name string, wopts ...WriteOption) (*Namespace, error) {
+	res, err := s.apply(&command{Op: opNamespaceDelete, Namespace: name}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.namespace, res.err
+}
+
+// GetNamespace 返回命名空间及其用量
+func (s *Store) GetNamespace(name string) (*Namespace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return nil, ErrNamespaceNotFound
+	}
+	out := *ns
+	return &out, nil
+}
+
+// Namespaces 返回所有命名空间，按名称排序
+func (s *Store) Namespaces() []Namespace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Namespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		out = append(out, *ns)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// applyNamespaceCreate 创建命名空间并统计前缀下已有的键，调用方需持有写锁
+func (s *Store) applyNamespaceCreate(c *command, index uint64) *applyResult {
+	if _, ok := s.namespaces[c.Namespace]; ok {
+		return &applyResult{err: ErrNamespaceExists}
+	}
+	ns := &Namespace{Name: c.Namespace, CreateRevision: index}
+	if c.Quota != nil {
+		ns.Quota = *c.Quota
+	}
+	s.namespaces[ns.Name] = ns
+	s.data.Ascend(ns.Name+NamespaceSeparator, func(ki *keyIndex) bool {
+		if !strings.HasPrefix(ki.Key, ns.Name+NamespaceSeparator) {
+			return false
+		}
+		if kv := ki.latest(); kv != nil {
+			s.account(kv.Key, nil, kv)
+		}
+		return true
+	})
+	out := *ns
+	return &applyResult{namespace: &out}
+}
+
+// applyNamespaceQuota 修改命名空间的配额，调用方需持有写锁
+func (s *Store) applyNamespaceQuota(c *command) *applyResult {
+	ns, ok := s.namespaces[c.Namespace]
+	if !ok {
+		return &applyResult{err: ErrNamespaceNotFound}
+	}
+	if c.Quota != nil {
+		ns.Quota = *c.Quota
+	}
+	out := *ns
+	return &applyResult{namespace: &out}
+}
+
+// applyNamespaceDelete 删除命名空间及其中所有的键，调用方需持有写锁
+func (s *Store) applyNamespaceDelete(c *command, index uint64) *applyResult {
+	ns, ok := s.namespaces[c.Namespace]
+	if !ok {
+		return &applyResult{err: ErrNamespaceNotFound}
+	}
+	out := *ns
+	prefix := ns.Name + NamespaceSeparator
+	var keys []string
+	s.data.Ascend(prefix, func(ki *keyIndex) bool {
+		if !strings.HasPrefix(ki.Key, prefix) {
+			return false
+		}
+		keys = append(keys, ki.Key)
+		return true
+	})
+	for _, key := range keys {
+		s.remove(key, index)
+	}
+	delete(s.namespaces, ns.Name)
+	return &applyResult{namespace: &out}
+}
+
+// namespaceOf 返回键所属的命名空间，不属于任何命名空间时返回 nil，调用方需持有读锁
+func (s *Store) namespaceOf(key string) *Namespace {
+	if len(s.namespaces) == 0 {
+		return nil
+	}
+	i := strings.Index(key, NamespaceSeparator)
+	if i <= 0 {
+		return nil
+	}
+	return s.namespaces[key[:i]]
+}
+
+// inNamespace 返回存储中的键是否属于某个命名空间
+func (s *Store) inNamespace(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.namespaceOf(key) != nil
+}
+
+// account 在键从 prev 变为 cur 时更新所属命名空间的用量，nil 表示键不存在，调用方需持有写锁
+func (s *Store) account(key string, prev, cur *KeyValue) {
+	ns := s.namespaceOf(key)
+	if ns == nil {
+		return
+	}
+	if prev != nil {
+		ns.Usage.Keys--
+		ns.Usage.Bytes -= kvSize(prev)
+	}
+	if cur != nil {
+		ns.Usage.Keys++
+		ns.Usage.Bytes += kvSize(cur)
+	}
+}
+
+func kvSize(kv *KeyValue) int64 {
+	return int64(len(kv.Key) + len(kv.Value))
+}
+
+// pendingWrite 是即将应用的一个写入，用于在写入之前检查配额
+type pendingWrite struct {
+	key    string
+	value  string
+	delete bool
+}
+
+// checkQuota 检查一组写入应用后各命名空间是否超出配额，调用方需持有读锁
+// 只拒绝使用量增加的写入，因此修改配额后已超出的命名空间仍可以删除和缩小
+func (s *Store) checkQuota(writes ...pendingWrite) error {
+	if len(s.namespaces) == 0 {
+		return nil
+	}
+	type delta struct {
+		ns          *Namespace
+		keys, bytes int64
+	}
+	var deltas []*delta             // 按首次出现的顺序，保证各副本返回相同的错误
+	sizes := make(map[string]int64) // 同一组写入中已写过的键的大小，-1 表示已删除
+	for _, w := range writes {
+		ns := s.namespaceOf(w.key)
+		if ns == nil {
+			continue
+		}
+		if !w.delete && ns.Quota.MaxValueSize > 0 && int64(len(w.value)) > ns.Quota.MaxValueSize {
+			return fmt.Errorf("%w: %s: value of %q is %d bytes, limit %d",
+				ErrQuotaExceeded, ns.Name, w.key, len(w.value), ns.Quota.MaxValueSize)
+		}
+
+		prev, seen := sizes[w.key]
+		if !seen {
+			prev = -1
+			if kv, ok := s.current(w.key); ok {
+				prev = kvSize(kv)
+			}
+		}
+		next := int64(-1)
+		if !w.delete {
+			next = int64(len(w.key) + len(w.value))
+		}
+		sizes[w.key] = next
+
+		var d *delta
+		for _, x := range deltas {
+			if x.ns == ns {
+				d = x
+			}
+		}
+		if d == nil {
+			d = &delta{ns: ns}
+			deltas = append(deltas, d)
+		}
+		if prev >= 0 {
+			d.keys--
+			d.bytes -= prev
+		}
+		if next >= 0 {
+			d.keys++
+			d.bytes += next
+		}
+	}
+
+	for _, d := range deltas {
+		ns := d.ns
+		if d.keys > 0 && ns.Quota.MaxKeys > 0 && ns.Usage.Keys+d.keys > ns.Quota.MaxKeys {
+			return fmt.Errorf("%w: %s: %d keys, limit %d", ErrQuotaExceeded, ns.Name, ns.Usage.Keys+d.keys, ns.Quota.MaxKeys)
+		}
+		if d.bytes > 0 && ns.Quota.MaxBytes > 0 && ns.Usage.Bytes+d.bytes > ns.Quota.MaxBytes {
+			return fmt.Errorf("%w: %s: %d bytes, limit %d", ErrQuotaExceeded, ns.Name, ns.Usage.Bytes+d.bytes, ns.Quota.MaxBytes)
+		}
+	}
+	return nil
+}
+
+// requireNamespace 检查写操作指定的命名空间存在，调用方需持有读锁
+func (s *Store) requireNamespace(c *command) error {
+	if c.Namespace == "" {
+		return nil
+	}
+	switch c.Op {
+	case opNamespaceCreate, opNamespaceQuota, opNamespaceDelete:
+		return nil
+	}
+	if _, ok := s.namespaces[c.Namespace]; !ok {
+		return fmt.Errorf("%w: %s", ErrNamespaceNotFound, c.Namespace)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNamespace_QuotaEnforcedInApply(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "team/a", Value: "1"})
+	res := applyCommand(t, f, 2, &command{Op: opNamespaceCreate, Namespace: "team", Quota: &Quota{MaxKeys: 2, MaxValueSize: 4}})
+	if res.err != nil || res.namespace.Usage.Keys != 1 {
+		t.Fatalf("create: %+v, %v", res.namespace, res.err)
+	}
+
+	if res := applyCommand(t, f, 3, &command{Op: opSet, Key: "team/b", Value: "2"}); res.err != nil {
+		t.Fatalf("set within quota: %v", res.err)
+	}
+	if res := applyCommand(t, f, 4, &command{Op: opSet, Key: "team/c", Value: "3"}); !errors.Is(res.err, ErrQuotaExceeded) {
+		t.Fatalf("key count: got %v, want %v", res.err, ErrQuotaExceeded)
+	}
+	// 覆盖已有的键不增加键数
+	if res := applyCommand(t, f, 5, &command{Op: opSet, Key: "team/b", Value: "22"}); res.err != nil {
+		t.Fatalf("overwrite: %v", res.err)
+	}
+	if res := applyCommand(t, f, 6, &command{Op: opSet, Key: "team/b", Value: "too long"}); !errors.Is(res.err, ErrQuotaExceeded) {
+		t.Fatalf("value size: got %v, want %v", res.err, ErrQuotaExceeded)
+	}
+	// 同一事务中先删除再写入不超出配额
+	res = applyCommand(t, f, 7, &command{Op: opTxn, Txn: &Txn{Success: []Op{
+		{Type: OpDelete, Key: "team/a"},
+		{Type: OpPut, Key: "team/c", Value: "3"},
+	}}})
+	if res.err != nil {
+		t.Fatalf("txn: %v", res.err)
+	}
+	res = applyCommand(t, f, 8, &command{Op: opTxn, Txn: &Txn{Success: []Op{
+		{Type: OpPut, Key: "other", Value: "x"},
+		{Type: OpPut, Key: "team/d", Value: "4"},
+	}}})
+	if !errors.Is(res.err, ErrQuotaExceeded) {
+		t.Fatalf("txn over quota: got %v, want %v", res.err, ErrQuotaExceeded)
+	}
+	if _, err := s.Get("other", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("rejected txn should not write, got %v", err)
+	}
+	if res := applyCommand(t, f, 9, &command{Op: opIncr, Key: "team/n", Delta: 1}); !errors.Is(res.err, ErrQuotaExceeded) {
+		t.Fatalf("incr over quota: got %v, want %v", res.err, ErrQuotaExceeded)
+	}
+
+	ns, _ := s.GetNamespace("team")
+	if ns.Usage.Keys != 2 || ns.Usage.Bytes != int64(len("team/b22team/c3")) {
+		t.Fatalf("usage: %+v", ns.Usage)
+	}
+}
+
+func TestNamespace_RequireAndDelete(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	res := applyCommand(t, f, 1, &command{Op: opSet, Key: "x/k", Value: "v", Namespace: "x"})
+	if !errors.Is(res.err, ErrNamespaceNotFound) {
+		t.Fatalf("write to missing namespace: got %v, want %v", res.err, ErrNamespaceNotFound)
+	}
+	applyCommand(t, f, 2, &command{Op: opNamespaceCreate, Namespace: "x"})
+	if res := applyCommand(t, f, 3, &command{Op: opNamespaceCreate, Namespace: "x"}); !errors.Is(res.err, ErrNamespaceExists) {
+		t.Fatalf("duplicate create: got %v, want %v", res.err, ErrNamespaceExists)
+	}
+	applyCommand(t, f, 4, &command{Op: opSet, Key: "x/k1", Value: "v", Namespace: "x"})
+	applyCommand(t, f, 5, &command{Op: opSet, Key: "x/k2", Value: "v", Namespace: "x"})
+	applyCommand(t, f, 6, &command{Op: opSet, Key: "xy", Value: "v"})
+
+	res = applyCommand(t, f, 7, &command{Op: opNamespaceDelete, Namespace: "x"})
+	if res.err != nil || res.namespace.Usage.Keys != 2 {
+		t.Fatalf("delete: %+v, %v", res.namespace, res.err)
+	}
+	if _, err := s.Get("x/k1", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("keys in a deleted namespace should be removed, got %v", err)
+	}
+	if _, err := s.Get("xy", Stale); err != nil {
+		t.Fatalf("keys outside the namespace should stay: %v", err)
+	}
+	if _, err := s.GetNamespace("x"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Fatalf("namespace should be gone, got %v", err)
+	}
+}
+
+func TestNamespace_UsageSurvivesSnapshot(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opNamespaceCreate, Namespace: "n", Quota: &Quota{MaxKeys: 1}})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "n/a", Value: "v"})
+
+	snap, _ := f.Snapshot()
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	restored := NewStore(t.TempDir(), "", true)
+	rf := newFSM(restored)
+	if err := rf.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	ns, err := restored.GetNamespace("n")
+	if err != nil || ns.Usage.Keys != 1 || ns.Quota.MaxKeys != 1 {
+		t.Fatalf("namespace after restore: %+v, %v", ns, err)
+	}
+	if res := applyCommand(t, rf, 3, &command{Op: opSet, Key: "n/b", Value: "v"}); !errors.Is(res.err, ErrQuotaExceeded) {
+		t.Fatalf("quota after restore: got %v, want %v", res.err, ErrQuotaExceeded)
+	}
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"fmt"
+	"gotoraft/pkg/logger"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// 持久化模式下 RaftDir 中的文件
+const (
+	logFileName    = "raft.log"    // Raft 日志
+	stableFileName = "stable.json" // 任期和投票
+	stateFileName  = "state.db"    // 状态机在磁盘上的副本，格式见 statedb.go
+)
+
+const (
+	// stateFlushInterval 将应用的变化写入状态文件的间隔
+	stateFlushInterval = time.Second
+	// logCacheSize 在内存中缓存的最近的日志条数，更早的日志从日志文件读取
+	logCacheSize = 512
+)
+
+// 持久化模式的工作方式：
+//   - Raft 日志和稳定存储写入 RaftDir，每次写入 fsync 后才返回，相当于状态机的预写日志；
+//     内存中只保留每条日志在文件中的位置和最近日志的缓存
+//   - 状态机在内存中提供读写，定期将变化的键增量写入状态文件，关闭时写入最后的变化
+//   - 重启时加载状态文件，Raft 只重放其索引之后的日志；Raft 快照比状态文件更新时改为加载快照，
+//     下一次刷新时用快照的内容重写状态文件
+//   - 配置了密钥文件时日志、状态文件的记录和快照加密保存，见 encrypt.go
+
+// openPersistent 打开持久化的日志存储、稳定存储和状态文件，并加载本地状态
+func (s *Store) openPersistent(snapshots raft.SnapshotStore) (raft.LogStore, raft.StableStore, error) {
+	if err := os.MkdirAll(s.raftDir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	logs, err := openFileLogStore(filepath.Join(s.raftDir, logFileName), s.keys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("log store: %w", err)
+	}
+	stable, err := openFileStableStore(filepath.Join(s.raftDir, stableFileName))
+	if err != nil {
+		logs.Close()
+		return nil, nil, fmt.Errorf("stable store: %w", err)
+	}
+	db, state, err := openStateDB(filepath.Join(s.raftDir, stateFileName), s.keys)
+	if err != nil {
+		logs.Close()
+		return nil, nil, fmt.Errorf("state file: %w", err)
+	}
+	s.stateDB = db
+	s.dirtyKeys = make(map[string]struct{})
+	if err := s.loadLocalState(state, snapshots); err != nil {
+		logs.Close()
+		db.Close()
+		return nil, nil, fmt.Errorf("load local state: %w", err)
+	}
+	cache, err := raft.NewLogCache(logCacheSize, logs)
+	if err != nil {
+		logs.Close()
+		db.Close()
+		return nil, nil, err
+	}
+	s.logStore = logs
+	return cache, stable, nil
+}
+
+// loadLocalState 加载状态文件中的状态和 Raft 快照中较新的一个，state 为 nil 表示状态文件为空
+// 加载状态文件时记录其索引，Raft 重放的日志中不晚于该索引的会被跳过
+func (s *Store) loadLocalState(state *fsmState, snapshots raft.SnapshotStore) error {
+	metas, err := snapshots.List()
+	if err != nil {
+		return err
+	}
+
+	if len(metas) > 0 && (state == nil || metas[0].Index > state.Revision) {
+		_, rc, err := snapshots.Open(metas[0].ID)
+		if err != nil {
+			return err
+		}
+		return newFSM(s).Restore(rc)
+	}
+	if state == nil {
+		return nil
+	}
+	s.restoreState(state)
+	s.stateReset = false // 状态与文件一致，不需要重写
+	s.localIndex = state.Revision
+	return nil
+}
+
+// markDirty 记录变化的键，下次刷新时写入状态文件，调用方需持有写锁
+func (s *Store) markDirty(key string) {
+	if s.dirtyKeys != nil && !s.stateReset {
+		s.dirtyKeys[key] = struct{}{}
+	}
+}
+
+// resetStateDB 在状态被整体替换后调用，下次刷新时重写状态文件，调用方需持有写锁
+func (s *Store) resetStateDB() {
+	if s.dirtyKeys != nil {
+		s.stateReset = true
+		clear(s.dirtyKeys)
+	}
+}
+
+// flushState 将上次刷新之后的变化写入状态文件，状态没有变化时跳过
+// 状态被整体替换过或文件中被覆盖的记录过多时，改为用完整的状态重写文件
+func (s *Store) flushState() error {
+	s.mu.Lock()
+	if s.revision == s.stateDB.index {
+		s.mu.Unlock()
+		return nil
+	}
+	b := &stateBatch{index: s.revision, meta: s.snapshotMeta()}
+	rewrite := s.stateReset || s.stateDB.needsRewrite(s.data.Len())
+	if rewrite {
+		s.data.Ascend("", func(ki *keyIndex) bool {
+			b.keys = append(b.keys, keyIndex{Key: ki.Key, Revs: slices.Clone(ki.Revs)})
+			return true
+		})
+	} else {
+		for key := range s.dirtyKeys {
+			if ki, ok := s.data.Get(key); ok {
+				b.keys = append(b.keys, keyIndex{Key: key, Revs: slices.Clone(ki.Revs)})
+			} else {
+				b.deleted = append(b.deleted, key)
+			}
+		}
+	}
+	clear(s.dirtyKeys)
+	s.stateReset = false
+	s.mu.Unlock()
+
+	var err error
+	if rewrite {
+		err = s.stateDB.rewrite(b)
+	} else {
+		err = s.stateDB.append(b)
+	}
+	if err != nil {
+		// 变化的键已经取出，下次刷新时重写整个文件
+		s.mu.Lock()
+		s.resetStateDB()
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// runStateFlush 在后台定期刷新状态文件
+func (s *Store) runStateFlush() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(stateFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.shutdownCh:
+			return
+		case <-ticker.C:
+			if err := s.flushState(); err != nil {
+				logger.Error("Failed to write state file:", err)
+			}
+		}
+	}
+}
+
+// closePersistent 写入最后的变化并关闭状态文件和日志文件，在 Raft 关闭之后调用
+func (s *Store) closePersistent() error {
+	if s.logStore == nil {
+		return nil
+	}
+	err := s.flushState()
+	if cerr := s.stateDB.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := s.logStore.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// skipReplayed 判断日志是否已包含在启动时加载的状态文件中
+func (s *Store) skipReplayed(log *raft.Log) bool {
+	return log.Index <= s.localIndex
+}
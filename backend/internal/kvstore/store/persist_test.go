@@ -0,0 +1,262 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// openPersistentNode 在 dir 中打开持久化模式的单节点，等待其成为 Leader 并应用完已提交的日志
+func openPersistentNode(t *testing.T, dir string) *Store {
+	t.Helper()
+	s := NewStore(dir, "127.0.0.1:0", false)
+	if err := s.Open(true, "node0"); err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.raft.State() != raft.Leader {
+		if time.Now().After(deadline) {
+			t.Fatalf("store did not become leader")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := s.raft.Barrier(5 * time.Second).Error(); err != nil {
+		t.Fatalf("barrier: %v", err)
+	}
+	return s
+}
+
+func TestStore_PersistentRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := openPersistentNode(t, dir)
+	for i := 0; i < 10; i++ {
+		if _, err := s.Put(fmt.Sprintf("k%d", i), fmt.Sprint(i), PutOptions{}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := s.Shutdown(); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	// 正常关闭时写入最后的变化，重启后从状态文件恢复
+	s = openPersistentNode(t, dir)
+	if s.localIndex == 0 {
+		t.Fatalf("restart should load the state file")
+	}
+	if v, err := s.Get("k9", Linearizable); err != nil || v != "9" {
+		t.Fatalf("k9 after restart: %q, %v", v, err)
+	}
+	if _, err := s.Put("k9", "changed", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := s.Delete("k0"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// 模拟崩溃：不写最后的变化，重启后重放状态文件之后的日志
+	close(s.shutdownCh)
+	s.wg.Wait()
+	s.raft.Shutdown().Error()
+	s.logStore.Close()
+	s.stateDB.Close()
+
+	s = openPersistentNode(t, dir)
+	defer s.Shutdown()
+	if v, err := s.Get("k9", Linearizable); err != nil || v != "changed" {
+		t.Fatalf("k9 after crash: %q, %v", v, err)
+	}
+	if _, err := s.Get("k0", Linearizable); err != ErrKeyNotFound {
+		t.Fatalf("k0 after crash: %v, want %v", err, ErrKeyNotFound)
+	}
+	if v, err := s.Get("k5", Linearizable); err != nil || v != "5" {
+		t.Fatalf("k5 after crash: %q, %v", v, err)
+	}
+}
+
+func TestStore_StateFileIsIncremental(t *testing.T) {
+	dir := t.TempDir()
+	s := openPersistentNode(t, dir)
+	defer s.Shutdown()
+	for i := 0; i < 200; i++ {
+		if _, err := s.Put(fmt.Sprintf("k%03d", i), strings.Repeat("v", 100), PutOptions{}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := s.flushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	before := s.stateDB.size
+
+	// 只有变化的键被追加到文件中
+	if _, err := s.Put("k007", "changed", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if _, err := s.Delete("k008"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := s.flushState(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if grown := s.stateDB.size - before; grown <= 0 || grown > before/10 {
+		t.Fatalf("state file grew by %d bytes after changing two keys, full state is %d bytes", grown, before)
+	}
+
+	db, state, err := openStateDB(filepath.Join(dir, stateFileName), nil)
+	if err != nil {
+		t.Fatalf("open state file: %v", err)
+	}
+	defer db.Close()
+	s.mu.RLock()
+	want := s.snapshotState()
+	s.mu.RUnlock()
+	// 空的集合编码后与 nil 相同，按编码比较
+	got, _ := json.Marshal(state)
+	if w, _ := json.Marshal(want); string(got) != string(w) {
+		t.Fatalf("state file does not match the state machine:\n%s\n%s", got, w)
+	}
+}
+
+// 基准测试的数据规模：日志条数、不同键的数量、最后一次刷新状态文件和快照之后的日志条数
+const (
+	restartEntries = 20000
+	restartKeys    = 2000
+	restartTail    = 200
+)
+
+// restartFlushEvery 准备数据时刷新状态文件的间隔（日志条数）
+const restartFlushEvery = 500
+
+// prepareRestartDir 写入一份日志文件、一个 Raft 快照和一个状态文件，快照和状态文件都落后 restartTail 条日志
+// 返回快照之后的日志，即内存存储的节点重启后从 Leader 收到的日志
+func prepareRestartDir(b *testing.B) (string, []*raft.Log) {
+	b.Helper()
+	dir := b.TempDir()
+	ls, err := openFileLogStore(filepath.Join(dir, logFileName), nil)
+	if err != nil {
+		b.Fatalf("open log: %v", err)
+	}
+	defer ls.Close()
+	snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+	if err != nil {
+		b.Fatalf("open snapshots: %v", err)
+	}
+
+	s := NewStore(dir, "", false)
+	if s.stateDB, _, err = openStateDB(filepath.Join(dir, stateFileName), nil); err != nil {
+		b.Fatalf("open state file: %v", err)
+	}
+	defer s.stateDB.Close()
+	s.dirtyKeys = make(map[string]struct{})
+	f := newFSM(s)
+	logs := make([]*raft.Log, 0, restartEntries)
+	for i := uint64(1); i <= restartEntries; i++ {
+		c := &command{Op: opSet, Key: fmt.Sprintf("key-%05d", i%restartKeys), Value: fmt.Sprintf("value-%d", i)}
+		if i%restartKeys == 0 {
+			// 定期压缩历史，与实际部署一致
+			c = &command{Op: opCompact, Revision: i - 1}
+		}
+		data, _ := json.Marshal(c)
+		l := &raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: data, AppendedAt: testEpoch}
+		logs = append(logs, l)
+		f.Apply(l)
+		if i%restartFlushEvery == 0 && i <= restartEntries-restartTail {
+			if err := s.flushState(); err != nil {
+				b.Fatalf("flush: %v", err)
+			}
+		}
+		if i == restartEntries-restartTail {
+			if err := s.flushState(); err != nil {
+				b.Fatalf("flush: %v", err)
+			}
+			snap, _ := f.Snapshot()
+			sink, err := snapshots.Create(raft.SnapshotVersionMax, i, 1, raft.Configuration{}, 1, nil)
+			if err != nil {
+				b.Fatalf("create snapshot: %v", err)
+			}
+			if err := snap.Persist(sink); err != nil {
+				b.Fatalf("persist snapshot: %v", err)
+			}
+		}
+	}
+	if err := ls.StoreLogs(logs); err != nil {
+		b.Fatalf("store logs: %v", err)
+	}
+	return dir, logs[restartEntries-restartTail:]
+}
+
+// replayLogs 从 from 开始将 logs 中的日志依次应用到状态机
+func replayLogs(b *testing.B, s *Store, logs raft.LogStore, from uint64) {
+	f := newFSM(s)
+	last, _ := logs.LastIndex()
+	for i := from; i <= last; i++ {
+		var l raft.Log
+		if err := logs.GetLog(i, &l); err != nil {
+			b.Fatalf("get log: %v", err)
+		}
+		f.Apply(&l)
+	}
+}
+
+// BenchmarkRestart 比较重启时恢复状态机的耗时：
+// inmem 的日志只在内存中，重启后加载最新的 Raft 快照（内存存储的节点也把快照写入 RaftDir），
+// 再应用从 Leader 收到的之后的日志；persistent 打开日志文件，加载状态文件后只应用之后的日志
+func BenchmarkRestart(b *testing.B) {
+	dir, tail := prepareRestartDir(b)
+
+	b.Run("inmem", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := NewStore(dir, "", true)
+			snapshots, err := raft.NewFileSnapshotStore(dir, 1, io.Discard)
+			if err != nil {
+				b.Fatalf("open snapshots: %v", err)
+			}
+			metas, err := snapshots.List()
+			if err != nil || len(metas) == 0 {
+				b.Fatalf("list snapshots: %v", err)
+			}
+			_, rc, err := snapshots.Open(metas[0].ID)
+			if err != nil {
+				b.Fatalf("open snapshot: %v", err)
+			}
+			if err := newFSM(s).Restore(rc); err != nil {
+				b.Fatalf("restore: %v", err)
+			}
+			logs := raft.NewInmemStore()
+			logs.StoreLogs(tail)
+			replayLogs(b, s, logs, metas[0].Index+1)
+			if s.revision != restartEntries {
+				b.Fatalf("revision %d, want %d", s.revision, restartEntries)
+			}
+		}
+	})
+
+	b.Run("persistent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s := NewStore(dir, "", false)
+			logs, err := openFileLogStore(filepath.Join(dir, logFileName), nil)
+			if err != nil {
+				b.Fatalf("open log: %v", err)
+			}
+			db, state, err := openStateDB(filepath.Join(dir, stateFileName), nil)
+			if err != nil {
+				b.Fatalf("open state file: %v", err)
+			}
+			s.stateDB = db
+			if err := s.loadLocalState(state, raft.NewInmemSnapshotStore()); err != nil {
+				b.Fatalf("load local state: %v", err)
+			}
+			replayLogs(b, s, logs, s.localIndex+1)
+			if s.revision != restartEntries {
+				b.Fatalf("revision %d, want %d", s.revision, restartEntries)
+			}
+			logs.Close()
+			db.Close()
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"strings"
+)
+
+// ScanOptions 范围扫描的参数
+// Prefix 与 [Start, End) 可以同时使用，结果为二者的交集
+type ScanOptions struct {
+	Prefix string // 键前缀
+	Start  string // 起始键（含）
+	End    string // 结束键（不含），为空表示不限
+	Limit  int    // 最多返回的键数，<= 0 表示不限
+
+	Revision uint64 // 读取该修订号时的数据，0 表示当前
+}
+
+// ScanResult 范围扫描的结果
+type ScanResult struct {
+	KVs      []KeyValue
+	More     bool   // 是否还有更多结果
+	Next     string // 下一页的起始键，More 为 true 时有效
+	Revision uint64 // 本次读取所在的修订号，翻页时传回以获得一致的视图
+}
+
+// Scan 按键升序扫描，遵循与单键读取相同的一致性级别
+func (s *Store) Scan(opts ScanOptions, lvl ConsistencyLevel) (*ScanResult, error) {
+	if err := s.readBarrier(lvl); err != nil {
+		return nil, err
+	}
+
+	start := opts.Start
+	if start < opts.Prefix {
+		start = opts.Prefix
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rev, err := s.checkRevision(opts.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ScanResult{Revision: rev}
+	s.data.Ascend(start, func(ki *keyIndex) bool {
+		if !strings.HasPrefix(ki.Key, opts.Prefix) {
+			return false
+		}
+		if opts.End != "" && ki.Key >= opts.End {
+			return false
+		}
+		kv := ki.at(rev)
+		if kv == nil {
+			return true
+		}
+		if opts.Limit > 0 && len(res.KVs) == opts.Limit {
+			res.More = true
+			res.Next = kv.Key
+			return false
+		}
+		res.KVs = append(res.KVs, *kv)
+		return true
+	})
+	return res, nil
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSkiplist_MatchesSortedMap(t *testing.T) {
+	l := newSkiplist()
+	ref := make(map[string]bool)
+	rnd := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprintf("k%03d", rnd.Intn(500))
+		if rnd.Intn(3) == 0 {
+			_, ok := l.Delete(key)
+			if ok != ref[key] {
+				t.Fatalf("delete %s: got %v, want %v", key, ok, ref[key])
+			}
+			delete(ref, key)
+			continue
+		}
+		l.Set(&keyIndex{Key: key})
+		ref[key] = true
+	}
+
+	want := make([]string, 0, len(ref))
+	for k := range ref {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+
+	var got []string
+	l.Ascend("", func(ki *keyIndex) bool {
+		got = append(got, ki.Key)
+		return true
+	})
+	if l.Len() != len(want) || fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("skiplist out of sync: len %d, want %d", l.Len(), len(want))
+	}
+}
+
+func TestStore_Scan(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	for i, k := range []string{"app/a", "app/b", "app/c", "apple", "b", "sys/x"} {
+		applyCommand(t, f, uint64(i+1), &command{Op: opSet, Key: k, Value: k})
+	}
+
+	keys := func(r *ScanResult) string {
+		var ks []string
+		for _, kv := range r.KVs {
+			ks = append(ks, kv.Key)
+		}
+		return fmt.Sprint(ks)
+	}
+
+	res, err := s.Scan(ScanOptions{Prefix: "app/"}, Stale)
+	if err != nil || keys(res) != "[app/a app/b app/c]" || res.More {
+		t.Fatalf("prefix scan: %s, more=%v, %v", keys(res), res.More, err)
+	}
+
+	res, _ = s.Scan(ScanOptions{Start: "app/b", End: "b"}, Stale)
+	if keys(res) != "[app/b app/c apple]" {
+		t.Fatalf("range scan: %s", keys(res))
+	}
+
+	// 分页：用上一页返回的 Next 作为下一页的起点
+	opts := ScanOptions{Limit: 4}
+	res, _ = s.Scan(opts, Stale)
+	if keys(res) != "[app/a app/b app/c apple]" || !res.More || res.Next != "b" {
+		t.Fatalf("first page: %s, more=%v, next=%q", keys(res), res.More, res.Next)
+	}
+	opts.Start = res.Next
+	res, _ = s.Scan(opts, Stale)
+	if keys(res) != "[b sys/x]" || res.More {
+		t.Fatalf("second page: %s, more=%v", keys(res), res.More)
+	}
+
+	if _, err := s.Scan(ScanOptions{}, Default); err != ErrNotLeader {
+		t.Fatalf("default scan without raft: got %v, want %v", err, ErrNotLeader)
+	}
+}
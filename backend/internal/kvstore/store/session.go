@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// sessionIdleTimeout 客户端会话在最后一次写入之后保留的时间（按日志时间），
+	// 超过之后同一客户端的重试不再能被识别
+	sessionIdleTimeout = 10 * time.Minute
+	// sessionSweepInterval 清理空闲会话和过期幂等键的间隔（按日志时间）
+	sessionSweepInterval = time.Minute
+)
+
+// ErrStaleSequence 请求的序号早于该客户端最后一次应用的序号，原结果已不再保存
+var ErrStaleSequence = errors.New("sequence number is older than the last applied request of this client")
+
+// WriteOption 写操作的可选参数
+type WriteOption func(*command)
+
+// WithClientSeq 为写操作附加客户端 ID 和序号
+// 同一客户端的序号需要严格递增，以相同序号重试时返回第一次应用的结果而不会再次写入
+func WithClientSeq(clientID string, seq uint64) WriteOption {
+	return func(c *command) {
+		c.ClientID = clientID
+		c.Seq = seq
+	}
+}
+
+// clientSession 记录一个客户端最后一次应用的请求
+type clientSession struct {
+	LastSeq  uint64        `json:"lastSeq"`
+	LastSeen int64         `json:"lastSeen"` // 最后一次写入的日志时间（Unix 毫秒）
+	Result   sessionResult `json:"result"`
+}
+
+// sessionResult 是可以写入快照的 applyResult
+type sessionResult struct {
+	KV    *KeyValue  `json:"kv,omitempty"`
+	Txn   *TxnResult `json:"txn,omitempty"`
+	Lease *Lease     `json:"lease,omitempty"`
+	Alarm *Alarm     `json:"alarm,omitempty"`
+	Err   string     `json:"err,omitempty"`
+	Code  string     `json:"code,omitempty"` // Err 包装的错误在 resultErrors 中的代码
+
+	Namespace *Namespace `json:"namespace,omitempty"`
+}
+
+// resultErrors 是可能出现在 applyResult 中的错误及其代码，用于从快照中还原错误值
+// 代码写入快照，不能修改；按顺序匹配，各副本得到相同的代码
+var resultErrors = []struct {
+	code string
+	err  error
+}{
+	{"key_not_found", ErrKeyNotFound},
+	{"key_exists", ErrKeyExists},
+	{"precondition_failed", ErrPreconditionFailed},
+	{"compacted", ErrCompacted},
+	{"future_revision", ErrFutureRevision},
+	{"lease_not_found", ErrLeaseNotFound},
+	{"not_a_number", ErrNotANumber},
+	{"counter_out_of_range", ErrCounterOutOfRange},
+	{"namespace_not_found", ErrNamespaceNotFound},
+	{"namespace_exists", ErrNamespaceExists},
+	{"invalid_namespace", ErrInvalidNamespace},
+	{"quota_exceeded", ErrQuotaExceeded},
+	{"no_space", ErrNoSpace},
+	{"space_not_freed", ErrSpaceNotFreed},
+	{"slot_frozen", ErrSlotFrozen},
+	{"slot_moved", ErrSlotMoved},
+	{"invalid_migration", ErrInvalidMigration},
+	{"migration_busy", ErrMigrationBusy},
+	{"restore_in_progress", ErrRestoreInProgress},
+	{"invalid_batch", ErrInvalidBatch},
+	{"batch_too_large", ErrBatchTooLarge},
+	{"idempotency_key_reused", ErrIdempotencyKeyReused},
+}
+
+// resultError 是从快照中还原的错误，保留原来的错误信息
+type resultError struct {
+	msg string
+	err error
+}
+
+func (e *resultError) Error() string { return e.msg }
+func (e *resultError) Unwrap() error { return e.err }
+
+func newSessionResult(res *applyResult) sessionResult {
+	out := sessionResult{KV: res.kv, Txn: res.txn, Lease: res.lease, Alarm: res.alarm, Namespace: res.namespace}
+	if res.err != nil {
+		out.Err = res.err.Error()
+		for _, e := range resultErrors {
+			if errors.Is(res.err, e.err) {
+				out.Code = e.code
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (r sessionResult) applyResult() *applyResult {
+	res := &applyResult{kv: r.KV, txn: r.Txn, lease: r.Lease, alarm: r.Alarm, namespace: r.Namespace}
+	if r.Err != "" {
+		res.err = errors.New(r.Err)
+		for _, e := range resultErrors {
+			if e.code == r.Code {
+				res.err = &resultError{msg: r.Err, err: e.err}
+				break
+			}
+		}
+	}
+	return res
+}
+
+// lookupSession 返回重复请求的原结果，不是重复请求时返回 false，调用方需持有写锁
+func (s *Store) lookupSession(c *command) (*applyResult, bool) {
+	if c.ClientID == "" {
+		return nil, false
+	}
+	sess, ok := s.sessions[c.ClientID]
+	if !ok || c.Seq > sess.LastSeq {
+		return nil, false
+	}
+	if c.Seq < sess.LastSeq {
+		return &applyResult{err: ErrStaleSequence}, true
+	}
+	return sess.Result.applyResult(), true
+}
+
+// recordSession 保存客户端最后一次请求的结果，调用方需持有写锁
+func (s *Store) recordSession(c *command, res *applyResult, now int64) {
+	if c.ClientID == "" {
+		return
+	}
+	s.sessions[c.ClientID] = &clientSession{
+		LastSeq:  c.Seq,
+		LastSeen: now,
+		Result:   newSessionResult(res),
+	}
+}
+
+// sweepDedup 按日志时间定期清理空闲的会话和过期的幂等键，调用方需持有写锁
+func (s *Store) sweepDedup(now int64) {
+	if now-s.sessionSweep < sessionSweepInterval.Milliseconds() {
+		return
+	}
+	s.sessionSweep = now
+	for id, sess := range s.sessions {
+		if now-sess.LastSeen >= sessionIdleTimeout.Milliseconds() {
+			delete(s.sessions, id)
+		}
+	}
+	for key, e := range s.idempotency {
+		if e.ExpireAt <= now {
+			delete(s.idempotency, key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSession_RetryReturnsOriginalResult(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	first := applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v1", ClientID: "c1", Seq: 1})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v2"})
+
+	// 重试的请求不再写入，返回第一次应用的结果
+	retry := applyCommand(t, f, 3, &command{Op: opSet, Key: "k", Value: "v1", ClientID: "c1", Seq: 1})
+	if retry.err != nil || retry.kv == nil || retry.kv.ModRevision != first.kv.ModRevision {
+		t.Fatalf("retry result: %+v, want revision %d", retry.kv, first.kv.ModRevision)
+	}
+	if v, _ := s.Get("k", Stale); v != "v2" {
+		t.Fatalf("retry should not overwrite, got %q", v)
+	}
+
+	if res := applyCommand(t, f, 4, &command{Op: opSet, Key: "k", Value: "v3", ClientID: "c1", Seq: 2}); res.err != nil {
+		t.Fatalf("next sequence: %v", res.err)
+	}
+	if res := applyCommand(t, f, 5, &command{Op: opSet, Key: "k", Value: "v1", ClientID: "c1", Seq: 1}); !errors.Is(res.err, ErrStaleSequence) {
+		t.Fatalf("old sequence: got %v, want %v", res.err, ErrStaleSequence)
+	}
+}
+
+func TestSession_CachedErrorSurvivesSnapshot(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v"})
+	res := applyCommand(t, f, 2, &command{Op: opSetIfAbsent, Key: "k", Value: "w", ClientID: "c1", Seq: 7})
+	if !errors.Is(res.err, ErrKeyExists) {
+		t.Fatalf("setnx: got %v, want %v", res.err, ErrKeyExists)
+	}
+
+	snap, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	restored := NewStore(t.TempDir(), "", true)
+	rf := newFSM(restored)
+	if err := rf.Restore(io.NopCloser(&sink.buf)); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	applyCommand(t, rf, 3, &command{Op: opDelete, Key: "k"})
+	retry := applyCommand(t, rf, 4, &command{Op: opSetIfAbsent, Key: "k", Value: "w", ClientID: "c1", Seq: 7})
+	if !errors.Is(retry.err, ErrKeyExists) || retry.kv == nil || retry.kv.Value != "v" {
+		t.Fatalf("retry after restore: %+v, %v", retry.kv, retry.err)
+	}
+	if _, err := restored.Get("k", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("retry should not write, got %v", err)
+	}
+}
+
+func TestSession_IdleSessionsExpire(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v", ClientID: "c1", Seq: 1})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v", ClientID: "c2", Seq: 1})
+
+	// 第 n 条日志的时间为 testEpoch + n 秒
+	idle := uint64(sessionIdleTimeout/time.Second) + 1
+	applyCommand(t, f, idle, &command{Op: opSet, Key: "other", Value: "x"})
+	if _, ok := s.sessions["c1"]; ok {
+		t.Fatalf("idle session c1 should expire")
+	}
+	if _, ok := s.sessions["c2"]; !ok {
+		t.Fatalf("session c2 is not idle long enough to expire")
+	}
+}
+
+func TestSession_CachedWrappedError(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "s", Value: "abc"})
+	applyCommand(t, f, 2, &command{Op: opIncr, Key: "s", Delta: 1, ClientID: "c", Seq: 1})
+	retry := applyCommand(t, f, 3, &command{Op: opIncr, Key: "s", Delta: 1, ClientID: "c", Seq: 1})
+	if !errors.Is(retry.err, ErrNotANumber) {
+		t.Fatalf("cached error should keep its identity, got %v", retry.err)
+	}
+}
+
+func TestSession_ReplaysEverySentinelError(t *testing.T) {
+	sentinels := []error{
+		ErrKeyNotFound, ErrKeyExists, ErrPreconditionFailed, ErrCompacted, ErrFutureRevision,
+		ErrLeaseNotFound, ErrNotANumber, ErrCounterOutOfRange,
+		ErrNamespaceNotFound, ErrNamespaceExists, ErrInvalidNamespace, ErrQuotaExceeded,
+		ErrNoSpace, ErrSpaceNotFreed,
+		ErrSlotFrozen, ErrSlotMoved, ErrInvalidMigration, ErrMigrationBusy,
+		ErrRestoreInProgress, ErrInvalidBatch, ErrBatchTooLarge, ErrIdempotencyKeyReused,
+	}
+	for _, sentinel := range sentinels {
+		for _, err := range []error{sentinel, fmt.Errorf("%w: detail", sentinel)} {
+			b, jerr := json.Marshal(newSessionResult(&applyResult{err: err}))
+			if jerr != nil {
+				t.Fatalf("marshal: %v", jerr)
+			}
+			var r sessionResult
+			if jerr := json.Unmarshal(b, &r); jerr != nil {
+				t.Fatalf("unmarshal: %v", jerr)
+			}
+			got := r.applyResult().err
+			if !errors.Is(got, sentinel) || got.Error() != err.Error() {
+				t.Fatalf("replayed %q as %q, identity kept: %v", err, got, errors.Is(got, sentinel))
+			}
+		}
+	}
+
+	// 代码未知的错误只保留错误信息
+	got := sessionResult{Err: "boom", Code: "unknown"}.applyResult().err
+	if got == nil || got.Error() != "boom" {
+		t.Fatalf("unknown code: %v", got)
+	}
+}
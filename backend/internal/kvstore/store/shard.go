@@ -0,0 +1,350 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"gotoraft/config"
+	"gotoraft/pkg/logger"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultSlots 是默认的哈希槽数
+const DefaultSlots = 1024
+
+// ErrCrossGroup 表示一个请求中的键属于不同的 Raft 组
+var ErrCrossGroup = errors.New("keys belong to different raft groups")
+
+// ShardConfig 多 Raft 组的配置
+type ShardConfig struct {
+	Groups int // 每个进程中的 Raft 组数，<= 1 表示不分片
+	Slots  int // 哈希槽数，<= 0 时使用 DefaultSlots
+
+	// 各节点 ID 及其 HTTP 地址（如 http://10.0.0.2:8080），用于将请求转发到键所在组的 Leader
+	HTTPPeers map[string]string
+}
+
+// Shards 将键空间按哈希槽划分到同一组节点上的多个独立 Raft 组，每个组有自己的日志和状态机
+// 0 号组即原来的单组 Store，另外负责命名空间、租约、锁和备份
+// 其他组的数据目录为 <raft_dir>/group-<i>，Raft 地址和审计地址的端口依次加 i，变更文件在 <cdc_dir>/group-<i>
+// 槽的初始归属按连续区间平均分配，迁移后的归属记录在 0 号组的状态机中
+type Shards struct {
+	groups []*Store
+	peers  map[string]string
+
+	mu    sync.RWMutex
+	slots []int // 每个槽所属的组
+
+	// 槽迁移，迁移记录保存在 0 号组的状态机中
+	migMu            sync.Mutex
+	running          map[int64]struct{} // 本节点正在执行或等待执行的迁移
+	migrationHandler func(Migration)
+	migrating        sync.Mutex // 同一时间只执行一个迁移
+	startMu          sync.Mutex // 创建迁移与恢复循环选择中断的迁移互斥
+
+	shutdownCh chan struct{}
+	wg         sync.WaitGroup
+}
+
+// SlotRange 是一段连续的哈希槽 [Start, End]
+type SlotRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// GroupServer 是组内的一个成员
+type GroupServer struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Suffrage string `json:"suffrage"`
+}
+
+// GroupStatus 是一个 Raft 组在本节点上的状态
+type GroupStatus struct {
+	Group        int           `json:"group"`
+	Slots        []SlotRange   `json:"slots"`
+	State        string        `json:"state"`
+	LeaderID     string        `json:"leaderId"`
+	LeaderAddr   string        `json:"leaderAddr"`
+	Term         uint64        `json:"term"`
+	AppliedIndex uint64        `json:"appliedIndex"`
+	Servers      []GroupServer `json:"servers,omitempty"`
+}
+
+// InitShards 按配置在 base（0 号组）之外创建其余的 Raft 组
+func InitShards(base *Store) *Shards {
+	cfg := config.GetStoreConfig()
+	if cfg == nil {
+		logger.Fatal("store config is nil")
+	}
+	sh, err := NewShards(base, ShardConfig{Groups: cfg.ShardGroups, Slots: cfg.ShardSlots, HTTPPeers: cfg.HTTPPeers})
+	if err != nil {
+		logger.Fatalf("init shards: %v", err)
+	}
+	return sh
+}
+
+// NewShards 以 base 为 0 号组创建多个 Raft 组，其他组沿用 base 的存储模式和写入限制
+// 槽按连续区间平均分配给各组
+func NewShards(base *Store, cfg ShardConfig) (*Shards, error) {
+	groups := max(cfg.Groups, 1)
+	slots := cfg.Slots
+	if slots <= 0 {
+		slots = DefaultSlots
+	}
+	if slots < groups {
+		return nil, fmt.Errorf("%d slots cannot be split into %d groups", slots, groups)
+	}
+
+	sh := &Shards{
+		groups: []*Store{base},
+		slots:  make([]int, slots),
+		peers:  cfg.HTTPPeers,
+
+		running:    make(map[int64]struct{}),
+		shutdownCh: make(chan struct{}),
+	}
+	for i := 1; i < groups; i++ {
+		bind, err := groupBind(base.raftBind, i)
+		if err != nil {
+			return nil, err
+		}
+		g := NewStore(filepath.Join(base.raftDir, "group-"+strconv.Itoa(i)), bind, base.inmem)
+		g.slotCount = slots
+		g.SetIdempotencyWindow(base.idempotencyWindow)
+		g.SetMaxBatchSize(base.maxBatchSize)
+		g.SetQuotaBytes(base.QuotaBytes())
+		g.SetKeyFile(base.keyFile)
+		if err := g.inheritCDCAndAudit(base, i); err != nil {
+			return nil, err
+		}
+		sh.groups = append(sh.groups, g)
+	}
+	for slot := range sh.slots {
+		sh.slots[slot] = slot * groups / slots
+	}
+	base.slotCount = slots
+	base.slotHandler = sh.assignSlot
+	return sh, nil
+}
+
+// groupBind 返回第 i 个组的监听地址：端口加 i，端口为 0 时由系统分配
+func groupBind(bind string, i int) (string, error) {
+	host, port, err := net.SplitHostPort(bind)
+	if err != nil {
+		return "", fmt.Errorf("bind address %q: %s", bind, err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return "", fmt.Errorf("bind address %q: %s", bind, err)
+	}
+	if p == 0 {
+		return bind, nil
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p+i)), nil
+}
+
+// inheritCDCAndAudit 为第 i 个组设置变更捕获和审计
+// 变更文件在 base 的目录下的 group-<i> 子目录中，审计服务的监听地址和其他节点的地址端口加 i
+func (s *Store) inheritCDCAndAudit(base *Store, i int) error {
+	if cfg := base.cdcConfig; cfg.Dir != "" {
+		cfg.Dir = filepath.Join(cfg.Dir, "group-"+strconv.Itoa(i))
+		s.SetCDC(cfg)
+	}
+	audit := AuditConfig{Interval: base.audit.Interval}
+	if base.audit.Bind != "" {
+		bind, err := groupBind(base.audit.Bind, i)
+		if err != nil {
+			return err
+		}
+		audit.Bind = bind
+	}
+	if len(base.audit.Peers) > 0 {
+		audit.Peers = make(map[string]string, len(base.audit.Peers))
+		for id, addr := range base.audit.Peers {
+			peer, err := groupBind(addr, i)
+			if err != nil {
+				return err
+			}
+			audit.Peers[id] = peer
+		}
+	}
+	s.SetAudit(audit)
+	return nil
+}
+
+// Open 启动所有组的 Raft 节点，以及在 0 号组的 Leader 上恢复中断的迁移的循环
+func (sh *Shards) Open(bootstrap bool, localID string) error {
+	for i, g := range sh.groups {
+		if err := g.Open(bootstrap, localID); err != nil {
+			return fmt.Errorf("open raft group %d: %w", i, err)
+		}
+	}
+	sh.wg.Add(1)
+	go sh.runMigrationRecovery()
+	return nil
+}
+
+// Shutdown 关闭所有组的 Raft 节点
+func (sh *Shards) Shutdown() error {
+	close(sh.shutdownCh)
+	sh.wg.Wait()
+	var errs []error
+	for i := len(sh.groups) - 1; i >= 0; i-- {
+		if err := sh.groups[i].Shutdown(); err != nil {
+			errs = append(errs, fmt.Errorf("raft group %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Len 返回组数
+func (sh *Shards) Len() int {
+	return len(sh.groups)
+}
+
+// Group 返回第 i 个组
+func (sh *Shards) Group(i int) *Store {
+	return sh.groups[i]
+}
+
+// Groups 返回所有组，按组号排列
+func (sh *Shards) Groups() []*Store {
+	return sh.groups
+}
+
+// NumSlots 返回哈希槽数
+func (sh *Shards) NumSlots() int {
+	return len(sh.slots)
+}
+
+// SlotOf 返回键所在的哈希槽，见 slotOf
+func (sh *Shards) SlotOf(key string) int {
+	return slotOf(key, len(sh.slots))
+}
+
+// GroupOf 返回键所在的组号
+func (sh *Shards) GroupOf(key string) int {
+	return sh.owner(sh.SlotOf(key))
+}
+
+// GroupOfKeys 返回多个键共同所在的组号，键属于不同的组时返回 ErrCrossGroup
+func (sh *Shards) GroupOfKeys(keys ...string) (int, error) {
+	group := -1
+	for _, key := range keys {
+		g := sh.GroupOf(key)
+		if group >= 0 && g != group {
+			return 0, fmt.Errorf("%w: %q", ErrCrossGroup, key)
+		}
+		group = g
+	}
+	return max(group, 0), nil
+}
+
+// storedGroup 返回存储中的键所在的组，命名空间中的键（见 NamespaceKey）固定在 0 号组
+func (sh *Shards) storedGroup(key string) int {
+	if len(sh.groups) == 1 || sh.groups[0].inNamespace(key) {
+		return 0
+	}
+	return sh.GroupOf(key)
+}
+
+// LeaderHTTP 返回第 i 个组的 Leader 的 HTTP 地址
+// 本节点就是 Leader、Leader 未知或没有配置其地址时返回 false
+func (sh *Shards) LeaderHTTP(i int) (string, bool) {
+	g := sh.groups[i]
+	id, _ := g.Leader()
+	if id == "" || id == g.nodeID {
+		return "", false
+	}
+	addr, ok := sh.peers[id]
+	return addr, ok && addr != ""
+}
+
+// SlotRanges 返回第 i 个组拥有的槽区间
+func (sh *Shards) SlotRanges(i int) []SlotRange {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	var ranges []SlotRange
+	for slot, g := range sh.slots {
+		if g != i {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].End == slot-1 {
+			ranges[n-1].End = slot
+			continue
+		}
+		ranges = append(ranges, SlotRange{Start: slot, End: slot})
+	}
+	return ranges
+}
+
+// Status 返回各组在本节点上的状态
+func (sh *Shards) Status() []GroupStatus {
+	status := make([]GroupStatus, 0, len(sh.groups))
+	for i, g := range sh.groups {
+		st := GroupStatus{Group: i, Slots: sh.SlotRanges(i)}
+		g.mu.RLock()
+		st.Term, st.AppliedIndex = g.term, g.revision
+		g.mu.RUnlock()
+		if g.raft != nil {
+			st.State = g.raft.State().String()
+			st.LeaderID, st.LeaderAddr = g.Leader()
+			if f := g.raft.GetConfiguration(); f.Error() == nil {
+				for _, srv := range f.Configuration().Servers {
+					st.Servers = append(st.Servers, GroupServer{
+						ID:       string(srv.ID),
+						Address:  string(srv.Address),
+						Suffrage: srv.Suffrage.String(),
+					})
+				}
+			}
+		}
+		status = append(status, st)
+	}
+	return status
+}
+
+// Scan 在所有组中按键升序扫描并合并结果，只有一个组时等同于 Store.Scan
+// 各组的修订号相互独立，因此多个组时不支持指定 Revision，返回的 Revision 为 0
+// 槽迁移中同时出现在源组和目标组中的键只取当前归属的组
+func (sh *Shards) Scan(opts ScanOptions, lvl ConsistencyLevel) (*ScanResult, error) {
+	if len(sh.groups) == 1 {
+		return sh.groups[0].Scan(opts, lvl)
+	}
+	if opts.Revision != 0 {
+		return nil, fmt.Errorf("%w: revision is not comparable across groups", ErrCrossGroup)
+	}
+
+	var kvs []KeyValue
+	bound := "" // 有更多结果的组中最小的下一页起始键，之后的键可能还没有读到
+	for i, g := range sh.groups {
+		res, err := g.Scan(opts, lvl)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range res.KVs {
+			if sh.storedGroup(kv.Key) == i {
+				kvs = append(kvs, kv)
+			}
+		}
+		if res.More && (bound == "" || res.Next < bound) {
+			bound = res.Next
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+
+	out := &ScanResult{KVs: kvs}
+	if bound != "" {
+		n := sort.Search(len(kvs), func(i int) bool { return kvs[i].Key >= bound })
+		out.KVs, out.More, out.Next = kvs[:n], true, bound
+	}
+	if opts.Limit > 0 && len(out.KVs) > opts.Limit {
+		out.More, out.Next = true, out.KVs[opts.Limit].Key
+		out.KVs = out.KVs[:opts.Limit]
+	}
+	return out, nil
+}
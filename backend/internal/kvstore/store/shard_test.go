@@ -0,0 +1,262 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShards_SlotsAndHashTags(t *testing.T) {
+	base := NewStore(t.TempDir(), "127.0.0.1:10000", true)
+	base.SetCDC(CDCConfig{Dir: "/var/cdc"})
+	base.SetAudit(AuditConfig{Bind: "127.0.0.1:11000", Peers: map[string]string{"node1": "10.0.0.2:11000"}})
+	sh, err := NewShards(base, ShardConfig{Groups: 3, Slots: 16})
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	if sh.Len() != 3 || sh.Group(0) != base || sh.Group(2).raftBind != "127.0.0.1:10002" {
+		t.Fatalf("groups: %d, group 2 bind %s", sh.Len(), sh.Group(2).raftBind)
+	}
+	// 每个组有自己的变更文件目录和审计地址
+	g2 := sh.Group(2)
+	if g2.cdcConfig.Dir != filepath.Join("/var/cdc", "group-2") || g2.audit.Bind != "127.0.0.1:11002" || g2.audit.Peers["node1"] != "10.0.0.2:11002" {
+		t.Fatalf("group 2 cdc %+v, audit %+v", g2.cdcConfig, g2.audit)
+	}
+
+	covered := 0
+	for i := 0; i < sh.Len(); i++ {
+		for _, r := range sh.SlotRanges(i) {
+			if r.Start != covered {
+				t.Fatalf("group %d range %+v does not continue at slot %d", i, r, covered)
+			}
+			covered = r.End + 1
+		}
+	}
+	if covered != 16 {
+		t.Fatalf("slots covered: %d, want 16", covered)
+	}
+
+	if sh.SlotOf("user:{42}:name") != sh.SlotOf("42") || sh.SlotOf("order:{42}") != sh.SlotOf("42") {
+		t.Fatalf("hash tag not applied")
+	}
+	if _, err := sh.GroupOfKeys("{u1}:a", "{u1}:b", "x{u1}"); err != nil {
+		t.Fatalf("keys with the same tag: %v", err)
+	}
+	var a, b string
+	for i := 0; b == ""; i++ {
+		k := fmt.Sprintf("k%d", i)
+		switch {
+		case a == "":
+			a = k
+		case sh.GroupOf(k) != sh.GroupOf(a):
+			b = k
+		}
+	}
+	if _, err := sh.GroupOfKeys(a, b); !errors.Is(err, ErrCrossGroup) {
+		t.Fatalf("keys in different groups: got %v, want %v", err, ErrCrossGroup)
+	}
+
+	if _, err := NewShards(base, ShardConfig{Groups: 4, Slots: 2}); err == nil {
+		t.Fatalf("more groups than slots should fail")
+	}
+}
+
+func TestShards_ScanMergesGroups(t *testing.T) {
+	sh, err := NewShards(NewStore(t.TempDir(), "127.0.0.1:0", true), ShardConfig{Groups: 3, Slots: 64})
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	fsms := make([]*FSM, sh.Len())
+	indexes := make([]uint64, sh.Len())
+	for i, g := range sh.Groups() {
+		fsms[i] = newFSM(g)
+	}
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		g := sh.GroupOf(key)
+		indexes[g]++
+		applyCommand(t, fsms[g], indexes[g], &command{Op: opSet, Key: key, Value: fmt.Sprint(i)})
+	}
+	for i, n := range indexes {
+		if n == 0 {
+			t.Fatalf("group %d received no keys", i)
+		}
+	}
+
+	var got []string
+	opts := ScanOptions{Prefix: "key", Limit: 7}
+	for page := 0; ; page++ {
+		res, err := sh.Scan(opts, Stale)
+		if err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if len(res.KVs) > opts.Limit {
+			t.Fatalf("page %d has %d keys", page, len(res.KVs))
+		}
+		for _, kv := range res.KVs {
+			got = append(got, kv.Key)
+		}
+		if !res.More {
+			break
+		}
+		opts.Start = res.Next
+	}
+	if len(got) != 30 {
+		t.Fatalf("scanned %d keys, want 30", len(got))
+	}
+	for i, k := range got {
+		if want := fmt.Sprintf("key%02d", i); k != want {
+			t.Fatalf("key %d: got %s, want %s", i, k, want)
+		}
+	}
+
+	if _, err := sh.Scan(ScanOptions{Revision: 1}, Stale); !errors.Is(err, ErrCrossGroup) {
+		t.Fatalf("scan at a revision: got %v, want %v", err, ErrCrossGroup)
+	}
+}
+
+func TestShards_OpenIndependentGroups(t *testing.T) {
+	sh, err := NewShards(NewStore(t.TempDir(), "127.0.0.1:0", true), ShardConfig{Groups: 2, Slots: 8})
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	if err := sh.Open(true, "node0"); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { sh.Shutdown() })
+	deadline := time.Now().Add(5 * time.Second)
+	for !sh.Group(0).IsLeader() || !sh.Group(1).IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatalf("groups did not elect leaders")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if _, err := sh.Group(sh.GroupOf(key)).Put(key, "v", PutOptions{}); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+	status := sh.Status()
+	for i, st := range status {
+		if st.State != "Leader" || st.LeaderID != "node0" || len(st.Servers) != 1 || st.AppliedIndex == 0 {
+			t.Fatalf("group %d status: %+v", i, st)
+		}
+	}
+	if _, err := sh.Group(sh.GroupOf("k1")).Get("k1", Linearizable); err != nil {
+		t.Fatalf("get from owning group: %v", err)
+	}
+	if _, err := sh.Group(1-sh.GroupOf("k1")).Get("k1", Linearizable); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("get from other group: got %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestShards_ExportImportAcrossGroups(t *testing.T) {
+	src := openShards(t, 3, 16)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if _, err := src.Group(src.GroupOf(key)).Put(key, fmt.Sprint(i), PutOptions{}); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	exp, err := src.Export(&buf, ExportOptions{Format: FormatJSONL, Prefix: "key", Level: Linearizable})
+	if err != nil || exp.Count != 20 {
+		t.Fatalf("export: %+v, %v", exp, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, fmt.Sprintf(`"key%02d"`, i)) {
+			t.Fatalf("line %d: %s", i, line)
+		}
+	}
+
+	dst := openShards(t, 3, 16)
+	res, err := dst.Import(bytes.NewReader(buf.Bytes()), ImportOptions{Format: FormatJSONL, BatchSize: 4})
+	if err != nil || res.Records != 20 {
+		t.Fatalf("import: %+v, %v", res, err)
+	}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if v, err := dst.Group(dst.GroupOf(key)).Get(key, Linearizable); err != nil || v != fmt.Sprint(i) {
+			t.Fatalf("%s after import: %q, %v", key, v, err)
+		}
+	}
+	dry, err := dst.Import(bytes.NewReader(buf.Bytes()), ImportOptions{Format: FormatJSONL, DryRun: true})
+	if err != nil || dry.Unchanged != 20 {
+		t.Fatalf("dry run: %+v, %v", dry, err)
+	}
+}
+
+func TestShards_WatchAcrossGroups(t *testing.T) {
+	sh := openShards(t, 2, 8)
+	var keys [2]string
+	for i := 0; keys[0] == "" || keys[1] == ""; i++ {
+		key := fmt.Sprintf("app/%d", i)
+		if g := sh.GroupOf(key); keys[g] == "" {
+			keys[g] = key
+		}
+	}
+
+	w, err := sh.Watch(WatchOptions{Key: "app/", Prefix: true})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer w.Cancel()
+	kw, err := sh.Watch(WatchOptions{Key: keys[0]})
+	if err != nil {
+		t.Fatalf("watch key: %v", err)
+	}
+	if _, err := sh.Watch(WatchOptions{Key: "app/", Prefix: true, StartRevision: 1}); !errors.Is(err, ErrCrossGroup) {
+		t.Fatalf("prefix watch from a revision: got %v, want %v", err, ErrCrossGroup)
+	}
+
+	next := func(w *Watcher) Event {
+		t.Helper()
+		select {
+		case ev, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("watcher closed: %v", w.Err())
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event")
+		}
+		return Event{}
+	}
+	for _, key := range keys {
+		if _, err := sh.Group(sh.GroupOf(key)).Put(key, "v", PutOptions{}); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+		if ev := next(w); ev.KV.Key != key {
+			t.Fatalf("event %+v, want %s", ev, key)
+		}
+	}
+	if ev := next(kw); ev.KV.Key != keys[0] {
+		t.Fatalf("key event %+v", ev)
+	}
+
+	// 迁移复制和释放键不产生事件，单个键的监听需要到新的组重新建立
+	m, err := sh.Migrate(sh.SlotOf(keys[0]), 1)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if m = waitMigration(t, sh, m.ID); m.State != MigrationDone {
+		t.Fatalf("migration: %+v", m)
+	}
+	if _, ok := <-kw.Events(); ok || !errors.Is(kw.Err(), ErrWatchReset) {
+		t.Fatalf("key watch after migration: %v", kw.Err())
+	}
+	if _, err := sh.Group(1).Put(keys[0], "v2", PutOptions{}); err != nil {
+		t.Fatalf("put after migration: %v", err)
+	}
+	if ev := next(w); ev.KV.Key != keys[0] || ev.Type != EventPut || ev.KV.Value != "v2" {
+		t.Fatalf("event after migration %+v", ev)
+	}
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"math/rand"
+)
+
+const (
+	skiplistMaxLevel = 24
+	skiplistP        = 0.25
+)
+
+// skiplist 是按键有序的索引，替代普通 map 以支持范围扫描
+// 非并发安全，由 Store.mu 保护
+type skiplist struct {
+	head   *skipNode
+	level  int
+	length int
+	rnd    *rand.Rand
+}
+
+type skipNode struct {
+	ki   *keyIndex
+	next []*skipNode
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skipNode{next: make([]*skipNode, skiplistMaxLevel)},
+		level: 1,
+		// 层高只影响索引结构，不影响内容，固定种子即可
+		rnd: rand.New(rand.NewSource(1)),
+	}
+}
+
+func (l *skiplist) randomLevel() int {
+	lvl := 1
+	for lvl < skiplistMaxLevel && l.rnd.Float64() < skiplistP {
+		lvl++
+	}
+	return lvl
+}
+
+// findGE 返回第一个键不小于 key 的节点，update 记录每层的前驱
+func (l *skiplist) findGE(key string, update []*skipNode) *skipNode {
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].ki.Key < key {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+// Get 查找键
+func (l *skiplist) Get(key string) (*keyIndex, bool) {
+	n := l.findGE(key, nil)
+	if n != nil && n.ki.Key == key {
+		return n.ki, true
+	}
+	return nil, false
+}
+
+// Set 插入或替换键
+func (l *skiplist) Set(ki *keyIndex) {
+	update := make([]*skipNode, skiplistMaxLevel)
+	n := l.findGE(ki.Key, update)
+	if n != nil && n.ki.Key == ki.Key {
+		n.ki = ki
+		return
+	}
+
+	lvl := l.randomLevel()
+	if lvl > l.level {
+		for i := l.level; i < lvl; i++ {
+			update[i] = l.head
+		}
+		l.level = lvl
+	}
+	n = &skipNode{ki: ki, next: make([]*skipNode, lvl)}
+	for i := 0; i < lvl; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	l.length++
+}
+
+// Delete 删除键并返回旧值
+func (l *skiplist) Delete(key string) (*keyIndex, bool) {
+	update := make([]*skipNode, skiplistMaxLevel)
+	n := l.findGE(key, update)
+	if n == nil || n.ki.Key != key {
+		return nil, false
+	}
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i] != n {
+			break
+		}
+		update[i].next[i] = n.next[i]
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.length--
+	return n.ki, true
+}
+
+// Len 返回键的数量
+func (l *skiplist) Len() int {
+	return l.length
+}
+
+// Ascend 从 start（含）开始按键升序遍历，fn 返回 false 时停止
+func (l *skiplist) Ascend(start string, fn func(ki *keyIndex) bool) {
+	for n := l.findGE(start, nil); n != nil; n = n.next[0] {
+		if !fn(n.ki) {
+			return
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// state.db 中的记录类型，记录格式与日志文件相同（长度、CRC32-C、可选加密的内容）
+const (
+	stateKey    byte = 1 // 一个键保留的全部历史版本，内容为长度前缀的键名和版本列表，见 encodeRevs
+	stateDelete byte = 2 // 键已从索引中移除，内容为键名
+	stateMeta   byte = 3 // 键以外的状态，JSON 编码的 fsmState，Keys 为空
+	stateCommit byte = 4 // 一批更新的结束，内容为 8 字节的日志索引
+)
+
+// stateRewriteThreshold 被覆盖的记录超过该数量且多于有效的记录时重写状态文件
+const stateRewriteThreshold = 4096
+
+// stateDB 是持久化模式下状态机在磁盘上的副本，一个日志结构的键值文件：
+//   - 每次刷新只追加上次刷新之后变化的键、删除的键和一条元数据记录，最后写入提交记录并 fsync
+//   - 打开时按顺序合并到最后一条提交记录，同一个键后写入的记录覆盖之前的，只有最后的记录被解码；
+//     没有提交记录的批次和末尾损坏的记录被截断
+//   - 被覆盖的记录多于有效的记录时，用完整的状态重写文件（写入临时文件后原子地替换），
+//     重写的开销分摊到之前的每次刷新上
+//
+// 内存中只保存记录数量，键的内容只在状态机中保存一份
+type stateDB struct {
+	path    string
+	f       *os.File
+	keys    *Keyring // 加密记录的密钥，nil 表示不加密
+	size    int64    // 文件中已提交内容的长度，新的批次追加在这里
+	index   uint64   // 最后一次提交的日志索引
+	records int      // 文件中已提交的记录数
+}
+
+// stateBatch 是一次刷新写入的内容
+type stateBatch struct {
+	index   uint64     // 刷新时已应用的日志索引
+	keys    []keyIndex // 变化的键
+	deleted []string   // 从索引中移除的键
+	meta    *fsmState  // 键以外的状态
+}
+
+// pendingBatch 是读取中的批次，键的版本列表在整个文件读完后才解码
+type pendingBatch struct {
+	index   uint64
+	keys    map[string][]byte // 键及其编码后的版本列表
+	deleted []string
+	meta    *fsmState
+}
+
+// openStateDB 打开或创建 path 处的状态文件，返回合并后的状态；文件中没有提交的批次时状态为 nil
+func openStateDB(path string, keys *Keyring) (*stateDB, *fsmState, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := &stateDB{path: path, f: f, keys: keys}
+	state, err := db.load()
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	return db, state, nil
+}
+
+// load 合并文件中已提交的批次，并截断之后的内容
+func (db *stateDB) load() (*fsmState, error) {
+	r := bufio.NewReader(db.f)
+	data := make(map[string][]byte)
+	var meta *fsmState
+	var batch pendingBatch
+	var off int64
+	var records int
+	for {
+		payload, n, err := readRecord(r)
+		if err == io.EOF || errors.Is(err, errTornRecord) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if payload, err = db.keys.open(payload); err != nil {
+			return nil, fmt.Errorf("record at offset %d: %w", off, err)
+		}
+		if err := batch.add(payload); err != nil {
+			return nil, fmt.Errorf("record at offset %d: %w", off, err)
+		}
+		off += n
+		records++
+		if payload[0] != stateCommit {
+			continue
+		}
+
+		for key, revs := range batch.keys {
+			data[key] = revs
+		}
+		for _, key := range batch.deleted {
+			delete(data, key)
+		}
+		meta = batch.meta
+		db.index = batch.index
+		db.size = off
+		db.records = records
+		batch = pendingBatch{}
+	}
+	if err := db.f.Truncate(db.size); err != nil {
+		return nil, err
+	}
+	if _, err := db.f.Seek(db.size, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	meta.Keys = make([]keyIndex, 0, len(data))
+	for key, revs := range data {
+		ki, err := decodeRevs(key, revs)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		meta.Keys = append(meta.Keys, ki)
+	}
+	sort.Slice(meta.Keys, func(i, j int) bool { return meta.Keys[i].Key < meta.Keys[j].Key })
+	return meta, nil
+}
+
+// add 将一条记录加入正在读取的批次
+func (b *pendingBatch) add(payload []byte) error {
+	switch payload[0] {
+	case stateKey:
+		key, revs, ok := readBytes(payload[1:])
+		if !ok {
+			return fmt.Errorf("invalid key record")
+		}
+		if b.keys == nil {
+			b.keys = make(map[string][]byte)
+		}
+		b.keys[string(key)] = revs
+	case stateDelete:
+		b.deleted = append(b.deleted, string(payload[1:]))
+	case stateMeta:
+		var meta fsmState
+		if err := json.Unmarshal(payload[1:], &meta); err != nil {
+			return err
+		}
+		b.meta = &meta
+	case stateCommit:
+		if len(payload) != 9 || b.meta == nil {
+			return fmt.Errorf("invalid commit record")
+		}
+		b.index = binary.BigEndian.Uint64(payload[1:])
+	default:
+		return fmt.Errorf("unknown record type %d", payload[0])
+	}
+	return nil
+}
+
+// len 返回批次编码后的记录数
+func (b *stateBatch) len() int {
+	return len(b.keys) + len(b.deleted) + 2
+}
+
+// encode 将批次编码为一组记录，提交记录在最后
+func (db *stateDB) encode(b *stateBatch) ([]byte, error) {
+	var buf []byte
+	appendSealed := func(payload []byte) error {
+		sealed, err := db.keys.seal(payload)
+		if err != nil {
+			return err
+		}
+		buf = appendRecord(buf, sealed)
+		return nil
+	}
+	for i := range b.keys {
+		if err := appendSealed(encodeRevs(&b.keys[i])); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range b.deleted {
+		if err := appendSealed(append([]byte{stateDelete}, key...)); err != nil {
+			return nil, err
+		}
+	}
+	meta, err := json.Marshal(b.meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := appendSealed(append([]byte{stateMeta}, meta...)); err != nil {
+		return nil, err
+	}
+	if err := appendSealed(binary.BigEndian.AppendUint64([]byte{stateCommit}, b.index)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// revFixedSize 每个版本除值以外的定长部分：7 个 8 字节的整数
+const revFixedSize = 7 * 8
+
+// encodeRevs 编码一个键的记录：记录类型、长度前缀的键名、版本数，以及每个版本的
+// 长度前缀的值、createRevision、modRevision、version、modTerm、modTime、expireAt、lease
+// 版本中的键名与记录的键名相同，不重复保存
+func encodeRevs(ki *keyIndex) []byte {
+	size := 1 + 4 + len(ki.Key) + 4
+	for i := range ki.Revs {
+		size += 4 + len(ki.Revs[i].Value) + revFixedSize
+	}
+	b := make([]byte, 0, size)
+	b = append(b, stateKey)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(ki.Key)))
+	b = append(b, ki.Key...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(ki.Revs)))
+	for i := range ki.Revs {
+		kv := &ki.Revs[i]
+		b = binary.BigEndian.AppendUint32(b, uint32(len(kv.Value)))
+		b = append(b, kv.Value...)
+		for _, v := range [...]uint64{kv.CreateRevision, kv.ModRevision, uint64(kv.Version), kv.ModTerm,
+			uint64(kv.ModTime), uint64(kv.ExpireAt), uint64(kv.Lease)} {
+			b = binary.BigEndian.AppendUint64(b, v)
+		}
+	}
+	return b
+}
+
+// decodeRevs 解码 encodeRevs 编码的版本列表，b 为键名之后的部分
+func decodeRevs(key string, b []byte) (keyIndex, error) {
+	ki := keyIndex{Key: key}
+	if len(b) < 4 {
+		return ki, fmt.Errorf("invalid key record")
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if uint64(n)*(4+revFixedSize) > uint64(len(b)) {
+		return ki, fmt.Errorf("invalid key record")
+	}
+	ki.Revs = make([]KeyValue, n)
+	for i := range ki.Revs {
+		value, rest, ok := readBytes(b)
+		if !ok || len(rest) < revFixedSize {
+			return ki, fmt.Errorf("invalid key record")
+		}
+		u := func(j int) uint64 { return binary.BigEndian.Uint64(rest[8*j:]) }
+		ki.Revs[i] = KeyValue{
+			Key:            key,
+			Value:          string(value),
+			CreateRevision: u(0),
+			ModRevision:    u(1),
+			Version:        int64(u(2)),
+			ModTerm:        u(3),
+			ModTime:        int64(u(4)),
+			ExpireAt:       int64(u(5)),
+			Lease:          int64(u(6)),
+		}
+		b = rest[revFixedSize:]
+	}
+	return ki, nil
+}
+
+// append 追加一批更新并 fsync，写入失败时截掉未提交的部分
+func (db *stateDB) append(b *stateBatch) error {
+	buf, err := db.encode(b)
+	if err != nil {
+		return err
+	}
+	if _, err := db.f.Write(buf); err != nil {
+		db.discardTail()
+		return err
+	}
+	if err := db.f.Sync(); err != nil {
+		db.discardTail()
+		return err
+	}
+	db.size += int64(len(buf))
+	db.index = b.index
+	db.records += b.len()
+	return nil
+}
+
+// needsRewrite 判断状态机中有 live 个键时，文件中被覆盖的记录是否已经多到需要重写
+func (db *stateDB) needsRewrite(live int) bool {
+	dead := db.records - live - 2 // 有效的是每个键最后的记录，以及最后的元数据和提交记录
+	return dead >= stateRewriteThreshold && dead > live
+}
+
+// rewrite 用完整的状态 b 重写文件，写入临时文件后原子地替换
+func (db *stateDB) rewrite(b *stateBatch) error {
+	buf, err := db.encode(b)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(db.path, buf); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(db.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+	db.f.Close()
+	db.f = f
+	db.size = int64(len(buf))
+	db.index = b.index
+	db.records = b.len()
+	return nil
+}
+
+// discardTail 将文件截断到最后一次提交
+func (db *stateDB) discardTail() {
+	if err := db.f.Truncate(db.size); err == nil {
+		db.f.Seek(db.size, io.SeekStart)
+	}
+}
+
+// Close 关闭状态文件
+func (db *stateDB) Close() error {
+	return db.f.Close()
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKey 返回只有一个版本的键
+func testKey(key, value string, rev uint64) keyIndex {
+	return keyIndex{Key: key, Revs: []KeyValue{{Key: key, Value: value, CreateRevision: rev, ModRevision: rev, Version: 1}}}
+}
+
+func TestStateDB_ReopenDropsUncommittedBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateFileName)
+	db, state, err := openStateDB(path, nil)
+	if err != nil || state != nil {
+		t.Fatalf("open empty: %v, %v", state, err)
+	}
+	if err := db.append(&stateBatch{index: 2, keys: []keyIndex{testKey("a", "1", 1), testKey("b", "2", 2)}, meta: &fsmState{Revision: 2}}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := db.append(&stateBatch{index: 3, deleted: []string{"a"}, meta: &fsmState{Revision: 3}}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	committed := db.size
+	db.Close()
+
+	// 模拟刷新写入一半时崩溃：完整的键记录之后是不完整的元数据记录
+	batch, _ := db.encode(&stateBatch{index: 4, keys: []keyIndex{testKey("c", "3", 4)}, meta: &fsmState{Revision: 4}})
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(batch[:len(batch)-20])
+	f.Close()
+
+	db, state, err = openStateDB(path, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db.Close()
+	if state == nil || state.Revision != 3 || db.index != 3 {
+		t.Fatalf("state after reopen: %+v, index %d, want revision 3", state, db.index)
+	}
+	if len(state.Keys) != 1 || state.Keys[0].Key != "b" {
+		t.Fatalf("keys after reopen: %+v, want only b", state.Keys)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != committed {
+		t.Fatalf("file size %d, want the uncommitted batch truncated to %d", fi.Size(), committed)
+	}
+}
+
+func TestStateDB_RewriteDropsOverwrittenRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateFileName)
+	db, _, err := openStateDB(path, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	var rev uint64
+	for !db.needsRewrite(1) {
+		rev++
+		if err := db.append(&stateBatch{index: rev, keys: []keyIndex{testKey("k", "v", rev)}, meta: &fsmState{Revision: rev}}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if rev < stateRewriteThreshold/3 {
+		t.Fatalf("rewrite needed after %d updates of one key", rev)
+	}
+
+	before := db.size
+	if err := db.rewrite(&stateBatch{index: rev, keys: []keyIndex{testKey("k", "v", rev)}, meta: &fsmState{Revision: rev}}); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if db.size >= before/100 || db.needsRewrite(1) {
+		t.Fatalf("state file should be rewritten: %d -> %d bytes", before, db.size)
+	}
+	rev++
+	if err := db.append(&stateBatch{index: rev, keys: []keyIndex{testKey("k", "new", rev)}, meta: &fsmState{Revision: rev}}); err != nil {
+		t.Fatalf("append after rewrite: %v", err)
+	}
+
+	db2, state, err := openStateDB(path, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer db2.Close()
+	if state.Revision != rev || len(state.Keys) != 1 || state.Keys[0].Revs[0].Value != "new" {
+		t.Fatalf("state after rewrite: %+v", state)
+	}
+}
@@ -1,12 +1,19 @@
 package store
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"gotoraft/config"
-	"gotoraft/internal/foorpc"
-	"gotoraft/internal/raft"
 	"gotoraft/pkg/logger"
+	"net"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/hashicorp/raft"
 )
 
 const (
@@ -14,10 +21,158 @@ const (
 	raftTimeout         = 10 * time.Second
 )
 
+// 存储层的错误
+var (
+	ErrNotLeader          = errors.New("not leader")
+	ErrKeyNotFound        = errors.New("key not found")
+	ErrKeyExists          = errors.New("key already exists")
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// 日志条目中的操作类型
+const (
+	opSet         = "set"
+	opDelete      = "delete"
+	opCompareSwap = "cas" // 当前值或修订号匹配时才写入
+	opSetIfAbsent = "setnx"
+	opCompareDel  = "cad" // 当前值匹配时才删除
+	opTxn         = "txn" // compare/then/else 事务
+	opCompact     = "compact"
+	opExpire      = "expire" // Leader 提议的过期删除
+	opIncr        = "incr"   // 整数值原子自增
+
+	opLeaseGrant     = "lease_grant"
+	opLeaseKeepAlive = "lease_keepalive"
+	opLeaseRevoke    = "lease_revoke"
+
+	opNamespaceCreate = "ns_create"
+	opNamespaceQuota  = "ns_quota"
+	opNamespaceDelete = "ns_delete"
+
+	opAlarmActivate = "alarm_activate" // Leader 提议的存储空间告警
+	opAlarmDisarm   = "alarm_disarm"
+
+	// 备份恢复，见 RestoreBackup
+	opRestoreBegin = "restore_begin" // 标记恢复开始，TTL 为标记的有效期
+	opRestoreAbort = "restore_abort" // 恢复失败时清除标记
+
+	// 槽迁移，见 Shards.Migrate
+	opSlotFreeze   = "slot_freeze"   // 源组停止槽的写入
+	opSlotUnfreeze = "slot_unfreeze" // 迁移失败时恢复写入
+	opSlotImport   = "slot_import"   // 目标组写入复制的键
+	opSlotAssign   = "slot_assign"   // 0 号组记录槽的新归属
+	opSlotRelease  = "slot_release"  // 源组删除槽中的键
+
+	opMigrationUpdate = "migration_update" // 0 号组创建或更新迁移记录
+)
+
 type command struct {
 	Op    string `json:"op,omitempty"`
 	Key   string `json:"key,omitempty"`
 	Value string `json:"value,omitempty"`
+
+	// 键的存活时间，过期时间由日志时间加上 TTL 得到，用于 set、cas 和 setnx
+	// 对于 lease_grant 则是租约的存活时间
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// 写入时绑定的租约，或租约操作的目标租约
+	Lease int64 `json:"lease,omitempty"`
+	// 为 true 时 lease_revoke 是 Leader 提议的过期撤销
+	LeaseExpired bool `json:"leaseExpired,omitempty"`
+
+	// 条件写入的前置条件
+	PrevValue    *string `json:"prevValue,omitempty"`
+	PrevRevision uint64  `json:"prevRevision,omitempty"`
+
+	// 自增的增量和结果的上下界，仅 Op 为 incr 时使用
+	Delta int64  `json:"delta,omitempty"`
+	Min   *int64 `json:"min,omitempty"`
+	Max   *int64 `json:"max,omitempty"`
+
+	// 多键事务，仅 Op 为 txn 时使用
+	Txn *Txn `json:"txn,omitempty"`
+
+	// 压缩的目标修订号，仅 Op 为 compact 时使用
+	Revision uint64 `json:"revision,omitempty"`
+
+	// 过期删除的目标键，仅 Op 为 expire 时使用
+	Expired []expireTarget `json:"expired,omitempty"`
+
+	// 客户端 ID 和序号，用于识别重试的写请求，见 WithClientSeq
+	ClientID string `json:"clientId,omitempty"`
+	Seq      uint64 `json:"seq,omitempty"`
+
+	// 幂等键、请求摘要以及保留时间，见 WithIdempotencyKey
+	IdempotencyKey string        `json:"idempotencyKey,omitempty"`
+	Fingerprint    string        `json:"fingerprint,omitempty"`
+	IdempotencyTTL time.Duration `json:"idempotencyTtl,omitempty"`
+
+	// 命名空间操作的目标，或写操作要求存在的命名空间，见 WithNamespace
+	Namespace string `json:"namespace,omitempty"`
+	// 命名空间的配额，用于 ns_create 和 ns_quota
+	Quota *Quota `json:"quota,omitempty"`
+
+	// 触发告警时 Leader 观察到的存储大小和配额，仅 Op 为 alarm_activate 时使用
+	Alarm *Alarm `json:"alarm,omitempty"`
+
+	// 槽迁移的目标槽、槽的新归属组以及复制的键
+	Slots    []int      `json:"slots,omitempty"`
+	Group    int        `json:"group,omitempty"`
+	Migrated []KeyValue `json:"migrated,omitempty"`
+	// 迁移记录的变化，用于 migration_update；slot_assign 带上时只推进该迁移
+	Migration *Migration `json:"migration,omitempty"`
+}
+
+// KeyValue 表示一个键在某个修订号的状态
+// 修订号即应用该操作的 Raft 日志索引
+type KeyValue struct {
+	Key            string `json:"key"`
+	Value          string `json:"value"`
+	CreateRevision uint64 `json:"createRevision"`     // 创建该键的修订号
+	ModRevision    uint64 `json:"modRevision"`        // 最后一次修改该键的修订号
+	Version        int64  `json:"version"`            // 自创建以来的修改次数，删除后重新创建从 1 开始
+	ModTerm        uint64 `json:"modTerm,omitempty"`  // 最后一次修改该键的日志的任期
+	ModTime        int64  `json:"modTime,omitempty"`  // 最后一次修改的时间（Unix 毫秒），取自 Leader 追加该日志的时间
+	ExpireAt       int64  `json:"expireAt,omitempty"` // 过期时间（Unix 毫秒），0 表示不过期
+	Lease          int64  `json:"lease,omitempty"`    // 绑定的租约 ID，0 表示没有
+}
+
+// PutOptions 写入键时的可选属性
+type PutOptions struct {
+	TTL   time.Duration // 存活时间，0 表示不过期
+	Lease int64         // 绑定的租约，0 表示不绑定
+}
+
+// Condition 条件写入的前置条件，两个字段都设置时需同时满足
+type Condition struct {
+	PrevValue    *string // 期望的当前值
+	PrevRevision uint64  // 期望的修订号，0 表示不检查
+}
+
+// ConsistencyLevel 读操作的一致性级别
+type ConsistencyLevel int
+
+const (
+	// Stale 直接读取本地状态，任何节点都可以提供，可能读到旧数据
+	Stale ConsistencyLevel = iota
+	// Default 只允许 Leader 提供读取，Leader 刚失去领导权时仍可能读到旧数据
+	Default
+	// Linearizable 读取前向多数派确认自己仍是 Leader
+	Linearizable
+)
+
+// ParseConsistencyLevel 解析一致性级别，空字符串为 Default
+func ParseConsistencyLevel(s string) (ConsistencyLevel, error) {
+	switch s {
+	case "", "default":
+		return Default, nil
+	case "stale":
+		return Stale, nil
+	case "linearizable":
+		return Linearizable, nil
+	default:
+		return Default, fmt.Errorf("unknown consistency level: %q", s)
+	}
 }
 
 // Config 用于存储和管理配置
@@ -30,11 +185,75 @@ type Config struct {
 // Store 是一个简单的键值存储，所有更改通过 Raft 共识进行。
 type Store struct {
 	mu       sync.RWMutex
-	data     map[string]string
+	data     *skiplist // 按键有序的数据索引，每个键保存其历史版本
 	raftDir  string
 	raftBind string
 	inmem    bool       // true 如果存储是内存存储
 	raft     *raft.Raft // HashiCorp Raft 实体
+
+	snapshots raft.SnapshotStore // Raft 快照，备份恢复时从中取得快照的索引
+
+	revision        uint64 // 最后应用的日志索引
+	term            uint64 // 最后应用的日志的任期
+	appliedAt       int64  // 最后应用的日志由 Leader 追加的时间（Unix 毫秒）
+	compactRevision uint64 // 早于该修订号的历史已被压缩
+
+	waiters []*indexWaiter // 等待状态机应用到指定索引的调用方
+
+	watches watchHub         // 键变更的监听者
+	ttls    map[string]int64 // 带 TTL 的键及其过期时间
+	leases  map[int64]*lease // 租约
+
+	sessions     map[string]*clientSession // 客户端最后一次写入的序号和结果
+	sessionSweep int64                     // 上次清理空闲会话的日志时间
+
+	idempotency       map[string]*idempotencyEntry // 窗口期内的幂等键
+	idempotencyWindow time.Duration                // 作为 Leader 时提议的幂等键保留时间
+
+	namespaces map[string]*Namespace // 命名空间及其配额和用量
+
+	size         int64            // 所有保留的历史版本中键和值的总字节数
+	alarm        *Alarm           // 当前的存储空间告警，nil 表示没有
+	alarmHandler func(AlarmEvent) // 告警状态变化的回调
+	logHandler   func(LogEntry)   // 应用日志的回调
+	quotaBytes   atomic.Int64     // 作为 Leader 时触发告警的存储大小，0 表示不限
+
+	maxBatchSize int   // 单个批量写入最多包含的操作数
+	restoreUntil int64 // 正在进行的备份恢复的标记的过期时间（日志时间，Unix 毫秒），0 表示没有
+
+	// 持久化模式（inmem 为 false）
+	logStore   *fileLogStore       // Raft 日志文件
+	stateDB    *stateDB            // 状态机在磁盘上的副本
+	dirtyKeys  map[string]struct{} // 上次刷新状态文件之后变化的键，不是持久化模式时为 nil
+	stateReset bool                // 状态被整体替换过，下次刷新时重写状态文件
+	localIndex uint64              // 启动时加载的状态文件的索引，重放时跳过不晚于它的日志
+
+	// 静态加密
+	keyFile string   // 密钥文件的路径，为空表示不加密
+	keys    *Keyring // 由 Open 从 keyFile 加载
+
+	// 副本一致性审计
+	nodeID        string       // 本节点的 ID，由 Open 设置
+	audit         AuditConfig  // 审计服务的地址和其他节点
+	auditListener net.Listener // 审计服务的监听器
+
+	// 多 Raft 组的哈希槽，见 Shards
+	slotCount   int                   // 槽数，不分片时为 1
+	slotOwners  map[int]int           // 0 号组记录的迁移后的槽归属
+	slotHandler func(slot, group int) // 槽归属变化的回调
+	frozenSlots map[int]struct{}      // 正在迁出、拒绝写入的槽
+	movedSlots  map[int]int           // 已经迁出的槽及其所属的组
+	migrations  map[int64]*Migration  // 0 号组记录的槽迁移
+
+	applyingMigration bool // 正在应用槽迁移的复制或释放，产生的事件不推送给合并的监听
+
+	// 变更数据捕获
+	cdcConfig  CDCConfig  // 变更文件的目录和轮转设置
+	cdc        *changeLog // 变更文件，未启用时为 nil
+	cdcChanges []Event    // 正在应用的日志产生的键变更
+
+	shutdownCh chan struct{}
+	wg         sync.WaitGroup
 }
 
 // GetAppliedIndex 返回当前已应用的日志索引
@@ -46,23 +265,62 @@ func (s *Store) GetAppliedIndex() uint64 {
 	return s.raft.AppliedIndex()
 }
 
+// GetLastLogIndex 返回 Raft 日志中最后一条日志的索引，Raft 未启动时为 0
+func (s *Store) GetLastLogIndex() uint64 {
+	if s.raft == nil {
+		return 0
+	}
+	return s.raft.LastIndex()
+}
+
+// GetCurrentTerm 返回 Raft 节点的当前任期，Raft 未启动时为 0
+func (s *Store) GetCurrentTerm() uint64 {
+	if s.raft == nil {
+		return 0
+	}
+	return s.raft.CurrentTerm()
+}
+
+// GetLastLogTerm 返回最后一条日志的任期，Raft 未启动时为 0
+func (s *Store) GetLastLogTerm() uint64 {
+	return s.raftStat("last_log_term")
+}
+
+// GetCommitIndex 返回本节点已知的提交索引，Raft 未启动时为 0
+func (s *Store) GetCommitIndex() uint64 {
+	return s.raftStat("commit_index")
+}
+
+// raftStat 返回 Raft 统计信息中的数值字段
+func (s *Store) raftStat(name string) uint64 {
+	if s.raft == nil {
+		return 0
+	}
+	n, _ := strconv.ParseUint(s.raft.Stats()[name], 10, 64)
+	return n
+}
+
 // InitStore 初始化kv服务
 func InitStore() *Store {
 	cfg := config.GetStoreConfig()
 	if cfg == nil {
 		logger.Fatal("store config is nil")
 	}
-	return &Store{
-		raftDir:  cfg.RaftDir,
-		raftBind: cfg.RaftBind,
-		inmem:    cfg.Inmem,
-	}
+	s := NewStore(cfg.RaftDir, cfg.RaftBind, cfg.Inmem)
+	s.SetIdempotencyWindow(cfg.IdempotencyWindow)
+	s.SetMaxBatchSize(cfg.MaxBatchSize)
+	s.SetQuotaBytes(cfg.QuotaBytes)
+	s.SetAudit(AuditConfig{Bind: cfg.AuditBind, Peers: cfg.AuditPeers, Interval: cfg.AuditInterval})
+	s.SetCDC(CDCConfig{Dir: cfg.CDCDir, MaxFileSize: cfg.CDCMaxFileSize, MaxFiles: cfg.CDCMaxFiles})
+	s.SetKeyFile(cfg.EncryptionKeyFile)
+	return s
 }
 
 // 在Store中添加配置更新方法
 func (s *Store) ReloadConfig(newConfig *config.StoreConfig) error {
 	// 实现配置热更新逻辑
 	// 例如更新Raft超时时间等
+	return nil
 }
 
 // GetRaft 返回 Raft 节点
@@ -70,24 +328,274 @@ func (s *Store) GetRaft() *raft.Raft {
 	return s.raft
 }
 
+// NodeID 返回本节点的 ID，Open 之前为空字符串
+func (s *Store) NodeID() string {
+	return s.nodeID
+}
+
+// Leader 返回当前 Leader 的节点 ID 和 Raft 地址，未知时为空字符串
+func (s *Store) Leader() (id, addr string) {
+	if s.raft == nil {
+		return "", ""
+	}
+	a, i := s.raft.LeaderWithID()
+	return string(i), string(a)
+}
+
+// IsLeader 返回本节点是否为 Leader
+func (s *Store) IsLeader() bool {
+	return s.raft != nil && s.raft.State() == raft.Leader
+}
+
 // NewStore 创建一个新的 Store 实例
-func NewStore(peers []string, me string, rpcClient *foorpc.Client) *Store {
+func NewStore(raftDir, raftBind string, inmem bool) *Store {
 	return &Store{
-		data: make(map[string]string),
-		raft: raft.NewRaft(peers, me, rpcClient),
+		data:     newSkiplist(),
+		raftDir:  raftDir,
+		raftBind: raftBind,
+		inmem:    inmem,
+		ttls:     make(map[string]int64),
+		leases:   make(map[int64]*lease),
+		sessions: make(map[string]*clientSession),
+
+		namespaces: make(map[string]*Namespace),
+
+		slotCount:   1,
+		slotOwners:  make(map[int]int),
+		frozenSlots: make(map[int]struct{}),
+		movedSlots:  make(map[int]int),
+		migrations:  make(map[int64]*Migration),
+
+		idempotency:       make(map[string]*idempotencyEntry),
+		idempotencyWindow: DefaultIdempotencyWindow,
+		maxBatchSize:      DefaultMaxBatchSize,
+		shutdownCh:        make(chan struct{}),
 	}
 }
 
-func (s *Store) Set(key, value string) {
-	// 使用 Raft 记录日志
-	s.data[key] = value
+// Open 启动 Raft 节点，bootstrap 为 true 时以单节点引导集群
+func (s *Store) Open(bootstrap bool, localID string) error {
+	cfg := raft.DefaultConfig()
+	cfg.LocalID = raft.ServerID(localID)
+	s.nodeID = localID
+	if s.keyFile != "" {
+		keys, err := LoadKeyring(s.keyFile)
+		if err != nil {
+			return fmt.Errorf("encryption key: %w", err)
+		}
+		s.keys = keys
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", s.raftBind)
+	if err != nil {
+		return err
+	}
+	transport, err := raft.NewTCPTransport(s.raftBind, addr, 3, raftTimeout, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	fileSnapshots, err := raft.NewFileSnapshotStore(s.raftDir, retainSnapshotCount, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("file snapshot store: %s", err)
+	}
+	snapshots := &sealedSnapshotStore{SnapshotStore: fileSnapshots, keys: s.keys}
+	s.snapshots = snapshots
+
+	if s.cdcConfig.Dir != "" {
+		// 在重放日志之前打开，已记录的日志不会重复写入
+		if s.cdc, err = openChangeLog(s.cdcConfig); err != nil {
+			return fmt.Errorf("open change log: %s", err)
+		}
+	}
+
+	var logStore raft.LogStore = raft.NewInmemStore()
+	var stableStore raft.StableStore = raft.NewInmemStore()
+	if !s.inmem {
+		logStore, stableStore, err = s.openPersistent(snapshots)
+		if err != nil {
+			transport.Close()
+			return err
+		}
+		// 状态机已从本地的状态文件或快照恢复
+		cfg.NoSnapshotRestoreOnStart = true
+	}
+
+	ra, err := raft.NewRaft(cfg, newFSM(s), logStore, stableStore, snapshots, transport)
+	if err != nil {
+		return fmt.Errorf("new raft: %s", err)
+	}
+	s.raft = ra
+
+	if s.audit.Bind != "" {
+		if err := s.serveAudit(); err != nil {
+			return err
+		}
+	}
+	s.wg.Add(1)
+	go s.runExpiry()
+	s.wg.Add(1)
+	go s.runAlarm()
+	if !s.inmem {
+		s.wg.Add(1)
+		go s.runStateFlush()
+	}
+	if s.audit.Interval > 0 && len(s.audit.Peers) > 0 {
+		s.wg.Add(1)
+		go s.runAudit()
+	}
+
+	if bootstrap {
+		ra.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{
+					ID:      cfg.LocalID,
+					Address: transport.LocalAddr(),
+				},
+			},
+		})
+	}
+	return nil
 }
 
-func (s *Store) Get(key string) string {
-	return s.data[key]
+// Shutdown 关闭 Raft 节点
+func (s *Store) Shutdown() error {
+	if s.raft == nil {
+		return nil
+	}
+	close(s.shutdownCh)
+	s.wg.Wait()
+	if s.auditListener != nil {
+		s.auditListener.Close()
+	}
+	if err := s.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	if s.cdc != nil {
+		if err := s.cdc.close(); err != nil {
+			return err
+		}
+	}
+	return s.closePersistent()
 }
 
-func (s *Store) Delete(key string) error {
-	// 创建 Raft 日志条目
-	return nil
+// apply 将命令提交到 Raft 日志，并返回状态机的执行结果
+func (s *Store) apply(c *command, wopts ...WriteOption) (*applyResult, error) {
+	if s.raft == nil || s.raft.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+	for _, o := range wopts {
+		o(c)
+	}
+	if c.IdempotencyKey != "" {
+		c.IdempotencyTTL = s.idempotencyWindow
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	f := s.raft.Apply(b, raftTimeout)
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+	res, ok := f.Response().(*applyResult)
+	if !ok {
+		return nil, fmt.Errorf("unexpected apply response %T", f.Response())
+	}
+	return res, res.err
+}
+
+// readBarrier 按一致性级别检查本节点能否提供读取
+func (s *Store) readBarrier(lvl ConsistencyLevel) error {
+	switch lvl {
+	case Stale:
+		return nil
+	case Default:
+		if s.raft == nil || s.raft.State() != raft.Leader {
+			return ErrNotLeader
+		}
+		return nil
+	case Linearizable:
+		if s.raft == nil {
+			return ErrNotLeader
+		}
+		if err := s.raft.VerifyLeader().Error(); err != nil {
+			return ErrNotLeader
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown consistency level: %d", lvl)
+	}
+}
+
+// Put 写入键值并返回写入后的状态，可以设置 TTL 或绑定租约，过期由 Leader 提议删除
+// 重试的写入（见 WithClientSeq、WithIdempotencyKey）返回第一次执行的结果
+func (s *Store) Put(key, value string, opts PutOptions, wopts ...WriteOption) (*KeyValue, error) {
+	res, err := s.apply(&command{Op: opSet, Key: key, Value: value, TTL: opts.TTL, Lease: opts.Lease}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.kv, nil
+}
+
+func (s *Store) Get(key string, lvl ConsistencyLevel) (string, error) {
+	if err := s.readBarrier(lvl); err != nil {
+		return "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	kv, ok := s.current(key)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	return kv.Value, nil
+}
+
+// Delete 删除键并返回删除前的状态，键不存在时返回 nil
+// 重试的删除返回第一次执行的结果
+func (s *Store) Delete(key string, wopts ...WriteOption) (*KeyValue, error) {
+	res, err := s.apply(&command{Op: opDelete, Key: key}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.kv, nil
+}
+
+// CompareAndSwap 当前值或修订号满足条件时写入新值
+// 条件不满足时返回 ErrPreconditionFailed，同时返回键的当前状态
+func (s *Store) CompareAndSwap(key, value string, cond Condition, opts PutOptions, wopts ...WriteOption) (*KeyValue, error) {
+	res, err := s.apply(&command{
+		Op:           opCompareSwap,
+		Key:          key,
+		Value:        value,
+		TTL:          opts.TTL,
+		Lease:        opts.Lease,
+		PrevValue:    cond.PrevValue,
+		PrevRevision: cond.PrevRevision,
+	}, wopts...)
+	if res == nil {
+		return nil, err
+	}
+	return res.kv, err
+}
+
+// SetIfAbsent 仅当键不存在时写入，键已存在时返回 ErrKeyExists
+func (s *Store) SetIfAbsent(key, value string, opts PutOptions, wopts ...WriteOption) (*KeyValue, error) {
+	res, err := s.apply(&command{Op: opSetIfAbsent, Key: key, Value: value, TTL: opts.TTL, Lease: opts.Lease}, wopts...)
+	if res == nil {
+		return nil, err
+	}
+	return res.kv, err
+}
+
+// CompareAndDelete 仅当当前值等于 prevValue 时删除键
+func (s *Store) CompareAndDelete(key, prevValue string, wopts ...WriteOption) (*KeyValue, error) {
+	res, err := s.apply(&command{Op: opCompareDel, Key: key, PrevValue: &prevValue}, wopts...)
+	if res == nil {
+		return nil, err
+	}
+	return res.kv, err
 }
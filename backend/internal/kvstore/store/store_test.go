@@ -0,0 +1,83 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// openSingleNode 启动一个单节点集群并等待其成为 Leader
+func openSingleNode(t *testing.T) *Store {
+	t.Helper()
+	s := NewStore(t.TempDir(), "127.0.0.1:0", true)
+	if err := s.Open(true, "node0"); err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { s.Shutdown() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.raft.State() != raft.Leader {
+		if time.Now().After(deadline) {
+			t.Fatalf("store did not become leader")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return s
+}
+
+func TestStore_SetGetDelete(t *testing.T) {
+	s := openSingleNode(t)
+
+	if _, err := s.Put("foo", "bar", PutOptions{}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if v, err := s.Get("foo", Linearizable); err != nil || v != "bar" {
+		t.Fatalf("get: got %q, %v", v, err)
+	}
+	if _, err := s.Delete("foo"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Get("foo", Linearizable); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("get after delete: got %v", err)
+	}
+}
+
+func TestStore_CompareAndSwap(t *testing.T) {
+	s := openSingleNode(t)
+
+	kv, err := s.SetIfAbsent("lock", "a", PutOptions{})
+	if err != nil {
+		t.Fatalf("setnx: %v", err)
+	}
+	if _, err := s.SetIfAbsent("lock", "b", PutOptions{}); !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("second setnx: got %v", err)
+	}
+
+	kv, err = s.CompareAndSwap("lock", "b", Condition{PrevRevision: kv.ModRevision}, PutOptions{})
+	if err != nil || kv.Value != "b" {
+		t.Fatalf("cas: got %+v, %v", kv, err)
+	}
+	if _, err := s.CompareAndDelete("lock", "a"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Fatalf("cad with stale value: got %v", err)
+	}
+}
+
+func TestStore_PutWithTTL(t *testing.T) {
+	s := openSingleNode(t)
+
+	if _, err := s.Put("session", "x", PutOptions{TTL: 200 * time.Millisecond}); err != nil {
+		t.Fatalf("set with ttl: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := s.Get("session", Linearizable); errors.Is(err, ErrKeyNotFound) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("key was not expired by the leader")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
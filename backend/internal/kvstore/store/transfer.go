@@ -0,0 +1,445 @@
+package store
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 导入导出支持的文件格式
+const (
+	FormatJSONL = "jsonl" // 每行一个 {"key":...,"value":...}
+	FormatCSV   = "csv"   // 首行为 key,value 表头
+)
+
+const (
+	// exportPageSize 导出时每次扫描的键数
+	exportPageSize = 500
+	// maxReportedConflicts 试运行结果中最多列出的冲突数，超出的只计数
+	maxReportedConflicts = 100
+)
+
+// 导入导出的错误
+var (
+	ErrInvalidFormat = errors.New("unsupported format")
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// Record 导入导出文件中的一条记录
+type Record struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ParseFormat 解析格式名称，为空时使用 JSONL
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", FormatJSONL, "ndjson", "json":
+		return FormatJSONL, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidFormat, s)
+	}
+}
+
+// RecordWriter 按指定格式写出记录
+type RecordWriter struct {
+	jw  *bufio.Writer
+	cw  *csv.Writer
+	hdr bool
+}
+
+// NewRecordWriter 创建写出 format 格式记录的 RecordWriter
+func NewRecordWriter(w io.Writer, format string) (*RecordWriter, error) {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatCSV {
+		return &RecordWriter{cw: csv.NewWriter(w)}, nil
+	}
+	return &RecordWriter{jw: bufio.NewWriter(w)}, nil
+}
+
+// Write 写出一条记录
+func (rw *RecordWriter) Write(rec Record) error {
+	if rw.cw != nil {
+		if !rw.hdr {
+			rw.hdr = true
+			if err := rw.cw.Write([]string{"key", "value"}); err != nil {
+				return err
+			}
+		}
+		return rw.cw.Write([]string{rec.Key, rec.Value})
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	rw.jw.Write(b)
+	return rw.jw.WriteByte('\n')
+}
+
+// Flush 将缓冲的数据写入底层 Writer
+func (rw *RecordWriter) Flush() error {
+	if rw.cw != nil {
+		if !rw.hdr {
+			// 没有记录时也写出表头，便于识别格式
+			rw.hdr = true
+			rw.cw.Write([]string{"key", "value"})
+		}
+		rw.cw.Flush()
+		return rw.cw.Error()
+	}
+	return rw.jw.Flush()
+}
+
+// RecordReader 按指定格式读取记录
+type RecordReader struct {
+	js   *bufio.Scanner
+	cr   *csv.Reader
+	line int
+}
+
+// NewRecordReader 创建读取 format 格式记录的 RecordReader
+func NewRecordReader(r io.Reader, format string) (*RecordReader, error) {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if format == FormatCSV {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = 2
+		return &RecordReader{cr: cr}, nil
+	}
+	js := bufio.NewScanner(r)
+	js.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &RecordReader{js: js}, nil
+}
+
+// Read 读取下一条记录，没有更多记录时返回 io.EOF
+func (rr *RecordReader) Read() (Record, error) {
+	if rr.cr != nil {
+		return rr.readCSV()
+	}
+	for rr.js.Scan() {
+		rr.line++
+		line := strings.TrimSpace(rr.js.Text())
+		if line == "" {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return Record{}, fmt.Errorf("%w: line %d: %v", ErrInvalidRecord, rr.line, err)
+		}
+		if rec.Key == "" {
+			return Record{}, fmt.Errorf("%w: line %d: key is required", ErrInvalidRecord, rr.line)
+		}
+		return rec, nil
+	}
+	if err := rr.js.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (rr *RecordReader) readCSV() (Record, error) {
+	for {
+		fields, err := rr.cr.Read()
+		if err == io.EOF {
+			return Record{}, io.EOF
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		rr.line++
+		// 首行可以是表头
+		if rr.line == 1 && fields[0] == "key" && fields[1] == "value" {
+			continue
+		}
+		if fields[0] == "" {
+			line, _ := rr.cr.FieldPos(0)
+			return Record{}, fmt.Errorf("%w: line %d: key is required", ErrInvalidRecord, line)
+		}
+		return Record{Key: fields[0], Value: fields[1]}, nil
+	}
+}
+
+// ExportOptions 导出的参数
+type ExportOptions struct {
+	Format string           // jsonl 或 csv
+	Prefix string           // 只导出该前缀下的键，为空表示全部
+	Level  ConsistencyLevel // 读取的一致性级别
+}
+
+// ExportResult 导出的结果
+type ExportResult struct {
+	Count    int    `json:"count"`
+	Revision uint64 `json:"revision"` // 导出数据所在的修订号
+}
+
+// Export 将同一修订号下的键按升序写入 w
+func (s *Store) Export(w io.Writer, opts ExportOptions) (*ExportResult, error) {
+	rw, err := NewRecordWriter(w, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ExportResult{}
+	cur := newExportCursor(s, opts)
+	for {
+		kv, err := cur.peek()
+		if err != nil {
+			return res, err
+		}
+		if kv == nil {
+			break
+		}
+		if err := rw.Write(Record{Key: kv.Key, Value: kv.Value}); err != nil {
+			return res, err
+		}
+		res.Count++
+		cur.pop()
+	}
+	res.Revision = cur.scan.Revision
+	return res, rw.Flush()
+}
+
+// Export 将所有组中的键按升序合并后写入 w，只有一个组时等同于 Store.Export
+// 每个组的数据固定在各自第一页的修订号上，修订号在组之间不可比较，因此多个组时返回的 Revision 为 0
+// 槽迁移中同时出现在源组和目标组中的键只取当前归属的组
+func (sh *Shards) Export(w io.Writer, opts ExportOptions) (*ExportResult, error) {
+	if len(sh.groups) == 1 {
+		return sh.groups[0].Export(w, opts)
+	}
+	rw, err := NewRecordWriter(w, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ExportResult{}
+	cursors := make([]*exportCursor, len(sh.groups))
+	for i, g := range sh.groups {
+		cursors[i] = newExportCursor(g, opts)
+	}
+	for {
+		next, head := -1, (*KeyValue)(nil)
+		for i, cur := range cursors {
+			kv, err := cur.peek()
+			if err != nil {
+				return res, groupError(len(cursors), i, err)
+			}
+			if kv != nil && (head == nil || kv.Key < head.Key) {
+				next, head = i, kv
+			}
+		}
+		if head == nil {
+			break
+		}
+		cursors[next].pop()
+		if sh.storedGroup(head.Key) != next {
+			continue
+		}
+		if err := rw.Write(Record{Key: head.Key, Value: head.Value}); err != nil {
+			return res, err
+		}
+		res.Count++
+	}
+	return res, rw.Flush()
+}
+
+// exportCursor 按页读取一个组中的键，后续页固定在第一页的修订号，一致性已由第一页保证
+type exportCursor struct {
+	store *Store
+	scan  ScanOptions
+	lvl   ConsistencyLevel
+	kvs   []KeyValue // 当前页中尚未读取的键
+	done  bool       // 已经读取了最后一页
+}
+
+func newExportCursor(s *Store, opts ExportOptions) *exportCursor {
+	return &exportCursor{
+		store: s,
+		scan:  ScanOptions{Prefix: opts.Prefix, Limit: exportPageSize},
+		lvl:   opts.Level,
+	}
+}
+
+// peek 返回下一个键，当前页读完时读取下一页，没有更多的键时返回 nil
+func (c *exportCursor) peek() (*KeyValue, error) {
+	for len(c.kvs) == 0 && !c.done {
+		page, err := c.store.Scan(c.scan, c.lvl)
+		if err != nil {
+			return nil, err
+		}
+		c.kvs, c.done = page.KVs, !page.More
+		c.scan.Start, c.scan.Revision, c.lvl = page.Next, page.Revision, Stale
+	}
+	if len(c.kvs) == 0 {
+		return nil, nil
+	}
+	return &c.kvs[0], nil
+}
+
+// pop 跳过 peek 返回的键
+func (c *exportCursor) pop() {
+	c.kvs = c.kvs[1:]
+}
+
+// ImportOptions 导入的参数
+type ImportOptions struct {
+	Format    string               // jsonl 或 csv
+	BatchSize int                  // 每个批次的记录数，<= 0 或超过上限时使用批量写入的上限
+	DryRun    bool                 // 只检查与现有键的冲突，不写入
+	Level     ConsistencyLevel     // 试运行时读取现有键的一致性级别
+	Progress  func(ImportProgress) // 每提交（或检查）一个批次后调用
+}
+
+// ImportProgress 导入的进度
+type ImportProgress struct {
+	Records  int    `json:"records"`            // 已处理的记录数
+	Batches  int    `json:"batches"`            // 已提交的批次数
+	Revision uint64 `json:"revision,omitempty"` // 最后一个批次的修订号
+}
+
+// ImportConflict 试运行时发现的与现有值不同的键
+type ImportConflict struct {
+	Key      string `json:"key"`
+	Existing string `json:"existing"`
+	Value    string `json:"value"`
+}
+
+// ImportResult 导入的结果
+type ImportResult struct {
+	ImportProgress
+	DryRun bool `json:"dryRun"`
+
+	// 以下字段只在试运行时填写
+	Created       int              `json:"created"`       // 不存在的键
+	Unchanged     int              `json:"unchanged"`     // 已存在且值相同的键
+	ConflictCount int              `json:"conflictCount"` // 已存在且值不同的键
+	Conflicts     []ImportConflict `json:"conflicts,omitempty"`
+}
+
+// Import 读取 r 中的记录，按批次作为一系列 Raft 提议写入
+// 每个批次原子地生效，批次之间不是原子的：出错时返回已提交部分的结果和错误
+func (s *Store) Import(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	return importRecords(r, opts, []*Store{s}, func(string) int { return 0 })
+}
+
+// Import 读取 r 中的记录，按键所在的组分别攒成批次写入各组，只有一个组时等同于 Store.Import
+// 各组的批次相互独立，修订号在组之间不可比较，因此多个组时进度和结果中的 Revision 为 0
+func (sh *Shards) Import(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	return importRecords(r, opts, sh.groups, sh.storedGroup)
+}
+
+// importRecords 将记录按 group 返回的组号放入 groups 中对应组的批次，每个批次满时提交到该组
+func importRecords(r io.Reader, opts ImportOptions, groups []*Store, group func(key string) int) (*ImportResult, error) {
+	rr, err := NewRecordReader(r, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	size := opts.BatchSize
+	if limit := groups[0].maxBatchSize; size <= 0 || size > limit {
+		size = limit
+	}
+	if opts.DryRun {
+		for i, s := range groups {
+			if err := s.readBarrier(opts.Level); err != nil {
+				return nil, groupError(len(groups), i, err)
+			}
+		}
+	}
+
+	res := &ImportResult{DryRun: opts.DryRun}
+	batches := make([][]Record, len(groups))
+	flush := func(i int) error {
+		batch := batches[i]
+		if len(batch) == 0 {
+			return nil
+		}
+		s := groups[i]
+		if opts.DryRun {
+			s.checkImport(batch, res)
+		} else {
+			ops := make([]Op, len(batch))
+			for j, rec := range batch {
+				ops[j] = Op{Type: OpPut, Key: rec.Key, Value: rec.Value}
+			}
+			txn, err := s.Batch(ops)
+			if err != nil {
+				return fmt.Errorf("batch %d: %w", res.Batches+1, groupError(len(groups), i, err))
+			}
+			if len(groups) == 1 {
+				res.Revision = txn.Revision
+			}
+		}
+		res.Records += len(batch)
+		res.Batches++
+		batches[i] = batch[:0]
+		if opts.Progress != nil {
+			opts.Progress(res.ImportProgress)
+		}
+		return nil
+	}
+
+	for {
+		rec, err := rr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+		i := group(rec.Key)
+		batches[i] = append(batches[i], rec)
+		if len(batches[i]) == size {
+			if err := flush(i); err != nil {
+				return res, err
+			}
+		}
+	}
+	for i := range groups {
+		if err := flush(i); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// groupError 在有多个组时为错误加上组号
+func groupError(groups, i int, err error) error {
+	if groups == 1 {
+		return err
+	}
+	return fmt.Errorf("raft group %d: %w", i, err)
+}
+
+// checkImport 将一个批次与当前数据比较，统计新建、不变和冲突的键
+func (s *Store) checkImport(batch []Record, res *ImportResult) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, rec := range batch {
+		kv, ok := s.current(rec.Key)
+		switch {
+		case !ok:
+			res.Created++
+		case kv.Value == rec.Value:
+			res.Unchanged++
+		default:
+			res.ConflictCount++
+			if len(res.Conflicts) < maxReportedConflicts {
+				res.Conflicts = append(res.Conflicts, ImportConflict{
+					Key:      rec.Key,
+					Existing: kv.Value,
+					Value:    rec.Value,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecordReader_CSVAndJSONL(t *testing.T) {
+	csvIn := "key,value\na,1\n\"b,c\",\"multi\nline\"\n"
+	rr, err := NewRecordReader(strings.NewReader(csvIn), FormatCSV)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	var got []Record
+	for {
+		rec, err := rr.Read()
+		if err != nil {
+			break
+		}
+		got = append(got, rec)
+	}
+	if len(got) != 2 || got[1].Key != "b,c" || got[1].Value != "multi\nline" {
+		t.Fatalf("csv records: %+v", got)
+	}
+
+	rr, _ = NewRecordReader(strings.NewReader("{\"key\":\"a\",\"value\":\"1\"}\n\n{\"value\":\"x\"}\n"), FormatJSONL)
+	if _, err := rr.Read(); err != nil {
+		t.Fatalf("first record: %v", err)
+	}
+	if _, err := rr.Read(); !errors.Is(err, ErrInvalidRecord) || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("missing key: got %v, want %v on line 3", err, ErrInvalidRecord)
+	}
+
+	if _, err := NewRecordReader(strings.NewReader(""), "xml"); !errors.Is(err, ErrInvalidFormat) {
+		t.Fatalf("format: got %v, want %v", err, ErrInvalidFormat)
+	}
+}
+
+func TestStore_ExportImport(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			src := openSingleNode(t)
+			for _, k := range []string{"app/a", "app/b", "app/c", "other"} {
+				if _, err := src.Put(k, "v-"+k, PutOptions{}); err != nil {
+					t.Fatalf("set: %v", err)
+				}
+			}
+
+			var buf bytes.Buffer
+			exp, err := src.Export(&buf, ExportOptions{Format: format, Prefix: "app/", Level: Linearizable})
+			if err != nil || exp.Count != 3 {
+				t.Fatalf("export: %+v, %v", exp, err)
+			}
+
+			dst := openSingleNode(t)
+			if _, err := dst.Put("app/a", "v-app/a", PutOptions{}); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+			if _, err := dst.Put("app/b", "local", PutOptions{}); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+
+			dry, err := dst.Import(bytes.NewReader(buf.Bytes()), ImportOptions{Format: format, DryRun: true})
+			if err != nil {
+				t.Fatalf("dry run: %v", err)
+			}
+			if dry.Records != 3 || dry.Created != 1 || dry.Unchanged != 1 || dry.ConflictCount != 1 ||
+				dry.Conflicts[0].Key != "app/b" || dry.Conflicts[0].Existing != "local" {
+				t.Fatalf("dry run result: %+v", dry)
+			}
+			if _, err := dst.Get("app/c", Linearizable); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("dry run should not write, got %v", err)
+			}
+
+			var progress []ImportProgress
+			res, err := dst.Import(bytes.NewReader(buf.Bytes()), ImportOptions{
+				Format:    format,
+				BatchSize: 2,
+				Progress:  func(p ImportProgress) { progress = append(progress, p) },
+			})
+			if err != nil {
+				t.Fatalf("import: %v", err)
+			}
+			if res.Records != 3 || res.Batches != 2 || len(progress) != 2 || progress[1].Records != 3 {
+				t.Fatalf("import result %+v, progress %+v", res, progress)
+			}
+			for _, k := range []string{"app/a", "app/b", "app/c"} {
+				if v, err := dst.Get(k, Linearizable); err != nil || v != "v-"+k {
+					t.Fatalf("%s after import: %q, %v", k, v, err)
+				}
+			}
+			if _, err := dst.Get("other", Linearizable); !errors.Is(err, ErrKeyNotFound) {
+				t.Fatalf("keys outside the prefix should not be exported, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"errors"
+	"gotoraft/pkg/logger"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	expiryInterval = 500 * time.Millisecond // Leader 检查过期键的间隔
+	maxExpireBatch = 1000                   // 单条过期日志最多删除的键数
+)
+
+// expireTarget 是一条过期日志要删除的键
+// ModRevision 用于确认键在提议之后没有被重新写入
+type expireTarget struct {
+	Key         string `json:"key"`
+	ModRevision uint64 `json:"modRevision"`
+}
+
+// logTime 返回日志条目由 Leader 追加时的时间（Unix 毫秒）
+// 各副本看到的是同一个值，因此基于它的过期判断是确定的
+func logTime(l *raft.Log) int64 {
+	return l.AppendedAt.UnixMilli()
+}
+
+// expireAt 根据日志时间和 TTL 计算过期时间，ttl 为 0 表示不过期
+func expireAt(l *raft.Log, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return l.AppendedAt.Add(ttl).UnixMilli()
+}
+
+// trackTTL 更新过期索引，调用方需持有写锁
+func (s *Store) trackTTL(key string, expireAt int64) {
+	if expireAt == 0 {
+		delete(s.ttls, key)
+		return
+	}
+	s.ttls[key] = expireAt
+}
+
+// RemainingTTL 返回键距离过期的剩余时间，取键自身的过期时间和绑定租约的过期时间中较早的一个
+// 不会过期时返回 false；已经过期但还没有被删除时返回 0
+func (s *Store) RemainingTTL(kv *KeyValue, now time.Time) (time.Duration, bool) {
+	at := kv.ExpireAt
+	if kv.Lease != 0 {
+		s.mu.RLock()
+		if l, ok := s.leases[kv.Lease]; ok && (at == 0 || l.expireAt < at) {
+			at = l.expireAt
+		}
+		s.mu.RUnlock()
+	}
+	if at == 0 {
+		return 0, false
+	}
+	return max(time.UnixMilli(at).Sub(now), 0), true
+}
+
+// applyExpire 删除仍然过期的目标键，调用方需持有写锁
+// 目标在提议之后被重新写入，或按日志时间尚未过期的键会被跳过
+func (s *Store) applyExpire(targets []expireTarget, index uint64, now int64) []string {
+	var expired []string
+	for _, t := range targets {
+		cur, ok := s.current(t.Key)
+		if !ok || cur.ModRevision != t.ModRevision || cur.ExpireAt == 0 || cur.ExpireAt > now {
+			continue
+		}
+		s.deleteKey(t.Key, index, true)
+		expired = append(expired, t.Key)
+	}
+	return expired
+}
+
+// dueKeys 返回按本地时钟已经过期的键，按键排序
+func (s *Store) dueKeys(now int64) []expireTarget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var targets []expireTarget
+	for key, at := range s.ttls {
+		if at > now {
+			continue
+		}
+		if cur, ok := s.current(key); ok {
+			targets = append(targets, expireTarget{Key: key, ModRevision: cur.ModRevision})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Key < targets[j].Key })
+	if len(targets) > maxExpireBatch {
+		targets = targets[:maxExpireBatch]
+	}
+	return targets
+}
+
+// runExpiry 在 Leader 上定期提议键和租约的过期日志，直到 Store 关闭
+func (s *Store) runExpiry() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.shutdownCh:
+			return
+		case <-ticker.C:
+			if s.raft.State() != raft.Leader {
+				continue
+			}
+			now := time.Now().UnixMilli()
+			if targets := s.dueKeys(now); len(targets) > 0 {
+				if _, err := s.apply(&command{Op: opExpire, Expired: targets}); err != nil {
+					logger.Warnf("failed to propose key expiry: %v", err)
+				}
+			}
+			for _, id := range s.dueLeases(now) {
+				_, err := s.apply(&command{Op: opLeaseRevoke, Lease: id, LeaseExpired: true})
+				if err != nil && !errors.Is(err, ErrLeaseNotFound) {
+					logger.Warnf("failed to propose lease expiry: %v", err)
+				}
+			}
+		}
+	}
+}
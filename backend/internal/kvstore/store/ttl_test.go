@@ -0,0 +1,116 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestTTL_ExpireEntry(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	// 第 1 条日志的时间为 testEpoch+1s，TTL 5s，过期时间为 testEpoch+6s
+	res := applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v", TTL: 5 * time.Second})
+	if want := testEpoch.Add(6 * time.Second).UnixMilli(); res.kv.ExpireAt != want {
+		t.Fatalf("expireAt: got %d, want %d", res.kv.ExpireAt, want)
+	}
+
+	w, _ := s.Watch(WatchOptions{Key: "k"})
+	defer w.Cancel()
+	var entries []LogEntry
+	s.SetLogHandler(func(e LogEntry) { entries = append(entries, e) })
+
+	if due := s.dueKeys(testEpoch.Add(5 * time.Second).UnixMilli()); len(due) != 0 {
+		t.Fatalf("key should not be due yet: %+v", due)
+	}
+	due := s.dueKeys(testEpoch.Add(6 * time.Second).UnixMilli())
+	if len(due) != 1 || due[0].Key != "k" || due[0].ModRevision != 1 {
+		t.Fatalf("due keys: %+v", due)
+	}
+
+	// 按日志时间尚未过期的过期条目会被忽略，保证各副本结果一致
+	applyCommand(t, f, 2, &command{Op: opExpire, Expired: due})
+	if _, err := s.Get("k", Stale); err != nil {
+		t.Fatalf("key expired before its log time: %v", err)
+	}
+
+	applyCommand(t, f, 6, &command{Op: opExpire, Expired: due})
+	if _, err := s.Get("k", Stale); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("key should be expired, got %v", err)
+	}
+	if ev := <-w.Events(); ev.Type != EventDelete || !ev.Expired || ev.KV.ModRevision != 6 {
+		t.Fatalf("expected expiry delete event, got %+v", ev)
+	}
+	if len(s.ttls) != 0 {
+		t.Fatalf("ttl index should be empty, got %v", s.ttls)
+	}
+
+	// 日志视图只在真正删除时显示过期的键
+	if len(entries) != 2 || entries[0].Op != opExpire || len(entries[0].Expired) != 0 {
+		t.Fatalf("log entries: %+v", entries)
+	}
+	if e := entries[1]; e.Index != 6 || e.Op != opExpire || len(e.Expired) != 1 || e.Expired[0] != "k" {
+		t.Fatalf("expire log entry: %+v", e)
+	}
+}
+
+func TestTTL_RewriteCancelsExpiry(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v1", TTL: time.Second})
+	due := s.dueKeys(testEpoch.Add(time.Hour).UnixMilli())
+
+	// 提议过期之后键被重新写入，过期条目不应删除新值
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "v2"})
+	applyCommand(t, f, 3, &command{Op: opExpire, Expired: due})
+	if v, err := s.Get("k", Stale); err != nil || v != "v2" {
+		t.Fatalf("rewritten key: got %q, %v", v, err)
+	}
+	if len(s.dueKeys(testEpoch.Add(time.Hour).UnixMilli())) != 0 {
+		t.Fatalf("rewrite without ttl should clear expiry")
+	}
+}
+
+func TestTTL_KeyMetadata(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "v1"})
+	b, _ := json.Marshal(&command{Op: opSet, Key: "k", Value: "v2", TTL: 10 * time.Second})
+	f.Apply(&raft.Log{Index: 2, Term: 3, Data: b, AppendedAt: testEpoch.Add(2 * time.Second)})
+
+	kv, err := s.GetAt("k", 0, Stale)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if kv.CreateRevision != 1 || kv.ModRevision != 2 || kv.ModTerm != 3 || kv.Version != 2 {
+		t.Fatalf("metadata: %+v", kv)
+	}
+	if want := testEpoch.Add(2 * time.Second).UnixMilli(); kv.ModTime != want {
+		t.Fatalf("modTime: got %d, want %d", kv.ModTime, want)
+	}
+	if ttl, ok := s.RemainingTTL(kv, testEpoch.Add(5*time.Second)); !ok || ttl != 7*time.Second {
+		t.Fatalf("remaining ttl: %v, %v", ttl, ok)
+	}
+	if ttl, ok := s.RemainingTTL(kv, testEpoch.Add(time.Hour)); !ok || ttl != 0 {
+		t.Fatalf("remaining ttl after expiry: %v, %v", ttl, ok)
+	}
+
+	// 绑定的租约比键自身的 TTL 更早过期时以租约为准
+	res := applyCommand(t, f, 3, &command{Op: opLeaseGrant, TTL: 4 * time.Second})
+	applyCommand(t, f, 4, &command{Op: opSet, Key: "leased", Value: "v", Lease: res.lease.ID})
+	kv, _ = s.GetAt("leased", 0, Stale)
+	if ttl, ok := s.RemainingTTL(kv, testEpoch.Add(5*time.Second)); !ok || ttl != 2*time.Second {
+		t.Fatalf("remaining lease ttl: %v, %v", ttl, ok)
+	}
+	applyCommand(t, f, 5, &command{Op: opSet, Key: "plain", Value: "v"})
+	kv, _ = s.GetAt("plain", 0, Stale)
+	if _, ok := s.RemainingTTL(kv, testEpoch); ok {
+		t.Fatalf("key without ttl should not expire")
+	}
+}
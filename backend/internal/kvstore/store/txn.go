@@ -0,0 +1,204 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// 事务比较的目标字段
+const (
+	CompareValue          = "value"    // 比较键的值
+	CompareRevision       = "revision" // 比较键的修订号，不存在的键修订号为 0
+	CompareCreateRevision = "create"   // 比较键的创建修订号
+	CompareVersion        = "version"  // 比较键的版本，不存在的键版本为 0
+)
+
+// 事务中的操作类型
+const (
+	OpPut    = "put"
+	OpDelete = "delete"
+	OpGet    = "get"
+)
+
+// Compare 事务中的一个比较条件，不存在的键视为值为空、修订号为 0
+type Compare struct {
+	Key      string `json:"key"`
+	Target   string `json:"target"` // value、revision、create 或 version
+	Result   string `json:"result"` // =, !=, <, >
+	Value    string `json:"value,omitempty"`
+	Revision uint64 `json:"revision,omitempty"` // revision 和 create 的比较值
+	Version  int64  `json:"version,omitempty"`
+}
+
+// Op 事务中的一个操作
+type Op struct {
+	Type  string `json:"type"` // put, delete 或 get
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Lease int64  `json:"lease,omitempty"` // put 时绑定的租约
+}
+
+// Txn 是一个 compare/then/else 事务，作为一条 Raft 日志原子地应用
+type Txn struct {
+	Compare []Compare `json:"compare,omitempty"`
+	Success []Op      `json:"success,omitempty"`
+	Failure []Op      `json:"failure,omitempty"`
+}
+
+// OpResult 事务中单个操作的结果
+type OpResult struct {
+	Type string    `json:"type"`
+	Key  string    `json:"key"`
+	KV   *KeyValue `json:"kv,omitempty"` // put 为写入后的值，delete 为被删除的值，get 为当前值
+}
+
+// TxnResult 事务的执行结果
+type TxnResult struct {
+	Succeeded bool       `json:"succeeded"` // 所有比较是否都成立，决定执行了哪一组操作
+	Results   []OpResult `json:"results"`
+	Revision  uint64     `json:"revision"` // 事务所在日志的索引
+}
+
+// Keys 返回事务中比较和操作涉及的所有键
+func (t *Txn) Keys() []string {
+	var keys []string
+	for _, c := range t.Compare {
+		keys = append(keys, c.Key)
+	}
+	for _, ops := range [][]Op{t.Success, t.Failure} {
+		for _, op := range ops {
+			keys = append(keys, op.Key)
+		}
+	}
+	return keys
+}
+
+// Validate 在提交之前检查事务格式，避免无效事务进入日志
+func (t *Txn) Validate() error {
+	for _, c := range t.Compare {
+		if c.Key == "" {
+			return fmt.Errorf("compare key is required")
+		}
+		switch c.Target {
+		case CompareValue, CompareRevision, CompareCreateRevision, CompareVersion:
+		default:
+			return fmt.Errorf("unknown compare target: %q", c.Target)
+		}
+		switch c.Result {
+		case "=", "!=", "<", ">":
+		default:
+			return fmt.Errorf("unknown compare result: %q", c.Result)
+		}
+	}
+	for _, ops := range [][]Op{t.Success, t.Failure} {
+		for _, op := range ops {
+			if op.Key == "" {
+				return fmt.Errorf("op key is required")
+			}
+			switch op.Type {
+			case OpPut, OpDelete, OpGet:
+			default:
+				return fmt.Errorf("unknown op type: %q", op.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// Txn 提交一个事务
+func (s *Store) Txn(t *Txn, wopts ...WriteOption) (*TxnResult, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	res, err := s.apply(&command{Op: opTxn, Txn: t}, wopts...)
+	if err != nil {
+		return nil, err
+	}
+	return res.txn, nil
+}
+
+// applyTxn 在状态机中执行事务，调用方需持有写锁
+// 将执行的分支引用了不存在的租约时整个事务失败，不修改任何数据
+func (s *Store) applyTxn(t *Txn, index uint64) (*TxnResult, error) {
+	succeeded := true
+	for _, c := range t.Compare {
+		if !s.compare(c) {
+			succeeded = false
+			break
+		}
+	}
+
+	ops := t.Success
+	if !succeeded {
+		ops = t.Failure
+	}
+	for _, op := range ops {
+		if op.Type != OpPut || op.Lease == 0 {
+			continue
+		}
+		if _, ok := s.leases[op.Lease]; !ok {
+			return nil, ErrLeaseNotFound
+		}
+	}
+	writes := make([]pendingWrite, 0, len(ops))
+	for _, op := range ops {
+		if op.Type == OpPut || op.Type == OpDelete {
+			writes = append(writes, pendingWrite{key: op.Key, value: op.Value, delete: op.Type == OpDelete})
+		}
+	}
+	if err := s.checkQuota(writes...); err != nil {
+		return nil, err
+	}
+
+	results := make([]OpResult, 0, len(ops))
+	for _, op := range ops {
+		r := OpResult{Type: op.Type, Key: op.Key}
+		switch op.Type {
+		case OpPut:
+			r.KV = s.put(op.Key, op.Value, index, 0, op.Lease)
+		case OpDelete:
+			r.KV = s.remove(op.Key, index)
+		case OpGet:
+			r.KV, _ = s.current(op.Key)
+		}
+		results = append(results, r)
+	}
+	return &TxnResult{Succeeded: succeeded, Results: results, Revision: index}, nil
+}
+
+// compare 判断单个比较条件是否成立，调用方需持有读锁
+func (s *Store) compare(c Compare) bool {
+	var value string
+	var revision, create uint64
+	var version int64
+	if kv, ok := s.current(c.Key); ok {
+		value, revision, create, version = kv.Value, kv.ModRevision, kv.CreateRevision, kv.Version
+	}
+
+	var r int
+	switch c.Target {
+	case CompareValue:
+		r = cmp.Compare(value, c.Value)
+	case CompareRevision:
+		r = cmp.Compare(revision, c.Revision)
+	case CompareCreateRevision:
+		r = cmp.Compare(create, c.Revision)
+	case CompareVersion:
+		r = cmp.Compare(version, c.Version)
+	default:
+		return false
+	}
+
+	switch c.Result {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case "<":
+		return r < 0
+	case ">":
+		return r > 0
+	default:
+		return false
+	}
+}
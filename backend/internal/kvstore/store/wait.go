@@ -0,0 +1,68 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrIndexTimeout 表示等待本节点应用到指定日志索引超时
+var ErrIndexTimeout = errors.New("timed out waiting for index to be applied")
+
+// indexWaiter 是等待状态机应用到 index 的调用方，应用后关闭 ch
+type indexWaiter struct {
+	index uint64
+	ch    chan struct{}
+}
+
+// WaitForIndex 等待本节点的状态机应用到日志索引 index，最多等待 timeout
+// 写操作返回的索引作为读自己写的凭证，等待之后 Follower 也可以读到该写入
+func (s *Store) WaitForIndex(index uint64, timeout time.Duration) error {
+	s.mu.Lock()
+	if s.revision >= index {
+		s.mu.Unlock()
+		return nil
+	}
+	w := &indexWaiter{index: index, ch: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ch:
+		return nil
+	case <-timer.C:
+	case <-s.shutdownCh:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, x := range s.waiters {
+		if x == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			break
+		}
+	}
+	if s.revision >= index {
+		return nil
+	}
+	return fmt.Errorf("%w: applied %d, want %d", ErrIndexTimeout, s.revision, index)
+}
+
+// notifyApplied 唤醒已经应用到所等待索引的调用方，调用方需持有写锁
+func (s *Store) notifyApplied() {
+	if len(s.waiters) == 0 {
+		return
+	}
+	pending := s.waiters[:0]
+	for _, w := range s.waiters {
+		if w.index <= s.revision {
+			close(w.ch)
+		} else {
+			pending = append(pending, w)
+		}
+	}
+	clear(s.waiters[len(pending):])
+	s.waiters = pending
+}
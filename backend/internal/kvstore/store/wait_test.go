@@ -0,0 +1,46 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitForIndex(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "a", Value: "1"})
+	if err := s.WaitForIndex(1, 0); err != nil {
+		t.Fatalf("applied index: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.WaitForIndex(3, 5*time.Second) }()
+	time.Sleep(20 * time.Millisecond)
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "a", Value: "2"})
+	select {
+	case err := <-done:
+		t.Fatalf("woken before index 3 was applied: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	applyCommand(t, f, 3, &command{Op: opSet, Key: "a", Value: "3"})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiter was not woken after index 3 was applied")
+	}
+	// 等待结束时写入已经可见
+	if v, err := s.Get("a", Stale); err != nil || v != "3" {
+		t.Fatalf("read after wait: %q, %v", v, err)
+	}
+
+	if err := s.WaitForIndex(10, 10*time.Millisecond); !errors.Is(err, ErrIndexTimeout) {
+		t.Fatalf("wait for a future index: got %v, want %v", err, ErrIndexTimeout)
+	}
+	if len(s.waiters) != 0 {
+		t.Fatalf("timed out waiter should be removed, %d left", len(s.waiters))
+	}
+}
@@ -0,0 +1,296 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// watcher 的事件缓冲区大小，消费者跟不上时 watcher 会被关闭
+const watchBufferSize = 256
+
+// watch 相关的错误
+var (
+	ErrWatchOverflow = errors.New("watcher is too slow, resume from the last received revision")
+	ErrWatchReset    = errors.New("state machine was restored from a snapshot, watch must be re-established")
+)
+
+// EventType 键变更事件的类型
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event 是 FSM.Apply 产生的键变更事件
+type Event struct {
+	Type   EventType `json:"type"`
+	KV     KeyValue  `json:"kv"`               // 删除事件只有 Key 和 ModRevision
+	PrevKV *KeyValue `json:"prevKv,omitempty"` // 变更前的值，键原本不存在时为空
+
+	Expired bool `json:"expired,omitempty"` // 删除是否由 TTL 过期引起
+
+	slotMigration bool // 由槽迁移复制或释放键产生，见 Shards.Watch
+}
+
+// WatchOptions 监听的范围和起点
+type WatchOptions struct {
+	Key           string
+	Prefix        bool   // 为 true 时监听以 Key 为前缀的所有键
+	StartRevision uint64 // 从该修订号开始（含）推送，0 表示只推送之后的变更
+}
+
+// Watcher 监听一个键或前缀的变更
+type Watcher struct {
+	store *Store
+	opts  WatchOptions
+	ch    chan Event
+	parts []*Watcher // 合并多个组的监听时各组的 watcher，见 Shards.Watch
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// watchHub 保存所有活跃的 watcher
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*Watcher]struct{}
+}
+
+// Events 返回事件通道，watcher 关闭后通道被关闭，原因见 Err
+func (w *Watcher) Events() <-chan Event {
+	return w.ch
+}
+
+// Err 返回 watcher 被关闭的原因，主动取消时为 nil
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Cancel 取消监听
+func (w *Watcher) Cancel() {
+	if w.parts != nil {
+		w.stop(nil)
+		return
+	}
+	hub := &w.store.watches
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.watchers, w)
+	w.close(nil)
+}
+
+func (w *Watcher) close(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.err = err
+	close(w.ch)
+}
+
+// send 将事件放入合并的 watcher，通道已满时以 ErrWatchOverflow 关闭，返回是否仍在监听
+func (w *Watcher) send(ev Event) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return false
+	}
+	select {
+	case w.ch <- ev:
+		return true
+	default:
+		w.closed = true
+		w.err = ErrWatchOverflow
+		close(w.ch)
+		return false
+	}
+}
+
+// stop 以 err 关闭合并的 watcher 并取消各组的监听
+func (w *Watcher) stop(err error) {
+	w.close(err)
+	for _, p := range w.parts {
+		p.Cancel()
+	}
+}
+
+func (w *Watcher) matches(key string) bool {
+	if w.opts.Prefix {
+		return strings.HasPrefix(key, w.opts.Key)
+	}
+	return key == w.opts.Key
+}
+
+// Watch 开始监听，StartRevision 不晚于已压缩的修订号时返回 ErrCompacted
+// （压缩会丢弃该修订号上的删除记录，无法完整回放）
+func (s *Store) Watch(opts WatchOptions) (*Watcher, error) {
+	// 持有写锁以保证历史回放与实时事件之间没有遗漏
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.StartRevision != 0 && opts.StartRevision <= s.compactRevision {
+		return nil, ErrCompacted
+	}
+
+	var replay []Event
+	if opts.StartRevision != 0 && opts.StartRevision <= s.revision {
+		replay = s.history(opts)
+	}
+
+	w := &Watcher{
+		store: s,
+		opts:  opts,
+		ch:    make(chan Event, watchBufferSize+len(replay)),
+	}
+	for _, ev := range replay {
+		w.ch <- ev
+	}
+
+	hub := &s.watches
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.watchers == nil {
+		hub.watchers = make(map[*Watcher]struct{})
+	}
+	hub.watchers[w] = struct{}{}
+	return w, nil
+}
+
+// Watch 在键所在的组中监听，前缀监听合并所有组的事件，只有一个组时等同于 Store.Watch
+// 修订号在组之间不可比较，因此多个组时前缀监听不支持 StartRevision，单个键的 StartRevision 是其所在组的修订号
+// 槽迁移复制和释放键不产生事件，键所在的槽迁走后单个键的监听以 ErrWatchReset 关闭，需要重新建立
+func (sh *Shards) Watch(opts WatchOptions) (*Watcher, error) {
+	if len(sh.groups) == 1 {
+		return sh.groups[0].Watch(opts)
+	}
+	groups := []int{sh.storedGroup(opts.Key)}
+	if opts.Prefix {
+		if opts.StartRevision != 0 {
+			return nil, fmt.Errorf("%w: revision is not comparable across groups", ErrCrossGroup)
+		}
+		groups = groups[:0]
+		for i := range sh.groups {
+			groups = append(groups, i)
+		}
+	}
+
+	w := &Watcher{opts: opts, ch: make(chan Event, watchBufferSize)}
+	for _, i := range groups {
+		p, err := sh.groups[i].Watch(opts)
+		if err != nil {
+			w.stop(nil)
+			return nil, groupError(len(sh.groups), i, err)
+		}
+		w.parts = append(w.parts, p)
+	}
+	for j, i := range groups {
+		go sh.forward(w, w.parts[j], i)
+	}
+	return w, nil
+}
+
+// forward 将第 i 个组的 watcher p 中属于该组的键的事件转发到合并的 watcher w
+// 任一组的监听结束时关闭 w，原因取最先结束的组
+func (sh *Shards) forward(w *Watcher, p *Watcher, i int) {
+	for ev := range p.Events() {
+		if ev.slotMigration || sh.storedGroup(ev.KV.Key) != i {
+			continue
+		}
+		if !w.send(ev) {
+			break
+		}
+	}
+	w.stop(p.Err())
+}
+
+// history 从保留的历史版本中重建 StartRevision 之后的事件，调用方需持有读锁
+func (s *Store) history(opts WatchOptions) []Event {
+	var events []Event
+	collect := func(ki *keyIndex) {
+		for i, kv := range ki.Revs {
+			if kv.ModRevision < opts.StartRevision {
+				continue
+			}
+			ev := Event{Type: EventPut, KV: kv}
+			if kv.tombstone() {
+				ev.Type = EventDelete
+			}
+			if i > 0 && !ki.Revs[i-1].tombstone() {
+				prev := ki.Revs[i-1]
+				ev.PrevKV = &prev
+			}
+			events = append(events, ev)
+		}
+	}
+
+	if opts.Prefix {
+		s.data.Ascend(opts.Key, func(ki *keyIndex) bool {
+			if !strings.HasPrefix(ki.Key, opts.Key) {
+				return false
+			}
+			collect(ki)
+			return true
+		})
+	} else if ki, ok := s.data.Get(opts.Key); ok {
+		collect(ki)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].KV.ModRevision < events[j].KV.ModRevision
+	})
+	return events
+}
+
+// notify 将事件推送给匹配的 watcher，在 Apply 中调用，不会阻塞
+func (s *Store) notify(ev Event) {
+	s.captureChange(ev)
+	ev.slotMigration = s.applyingMigration
+	hub := &s.watches
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for w := range hub.watchers {
+		if !w.matches(ev.KV.Key) || ev.KV.ModRevision < w.opts.StartRevision {
+			continue
+		}
+		select {
+		case w.ch <- ev:
+		default:
+			delete(hub.watchers, w)
+			w.close(ErrWatchOverflow)
+		}
+	}
+}
+
+// closeSlotWatchers 关闭监听迁出的槽中单个键的 watcher，之后该键的变更发生在目标组中，调用方需持有写锁
+func (s *Store) closeSlotWatchers(slot int) {
+	hub := &s.watches
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for w := range hub.watchers {
+		if w.opts.Prefix || slotOf(w.opts.Key, s.slotCount) != slot || s.namespaceOf(w.opts.Key) != nil {
+			continue
+		}
+		delete(hub.watchers, w)
+		w.close(fmt.Errorf("%w: %v", ErrWatchReset, ErrSlotMoved))
+	}
+}
+
+// resetWatchers 关闭所有 watcher，用于从快照恢复之后
+func (s *Store) resetWatchers() {
+	hub := &s.watches
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for w := range hub.watchers {
+		delete(hub.watchers, w)
+		w.close(ErrWatchReset)
+	}
+}
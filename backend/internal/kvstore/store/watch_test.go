@@ -0,0 +1,88 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWatch_LiveEvents(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+
+	w, err := s.Watch(WatchOptions{Key: "app/", Prefix: true})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer w.Cancel()
+
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "app/a", Value: "1"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "other", Value: "x"})
+	applyCommand(t, f, 3, &command{Op: opSet, Key: "app/a", Value: "2"})
+	applyCommand(t, f, 4, &command{Op: opDelete, Key: "app/a"})
+
+	want := []struct {
+		typ  EventType
+		rev  uint64
+		prev string
+	}{
+		{EventPut, 1, ""},
+		{EventPut, 3, "1"},
+		{EventDelete, 4, "2"},
+	}
+	for _, wt := range want {
+		ev := <-w.Events()
+		if ev.Type != wt.typ || ev.KV.ModRevision != wt.rev {
+			t.Fatalf("got event %+v, want %s at %d", ev, wt.typ, wt.rev)
+		}
+		if (wt.prev == "") != (ev.PrevKV == nil) || (ev.PrevKV != nil && ev.PrevKV.Value != wt.prev) {
+			t.Fatalf("event at %d: unexpected prevKv %+v", wt.rev, ev.PrevKV)
+		}
+	}
+	select {
+	case ev := <-w.Events():
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestWatch_ResumeFromRevision(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	f := newFSM(s)
+	applyCommand(t, f, 1, &command{Op: opSet, Key: "k", Value: "1"})
+	applyCommand(t, f, 2, &command{Op: opSet, Key: "k", Value: "2"})
+	applyCommand(t, f, 3, &command{Op: opSet, Key: "k", Value: "3"})
+
+	w, err := s.Watch(WatchOptions{Key: "k", StartRevision: 2})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer w.Cancel()
+	applyCommand(t, f, 4, &command{Op: opDelete, Key: "k"})
+
+	for _, rev := range []uint64{2, 3, 4} {
+		if ev := <-w.Events(); ev.KV.ModRevision != rev {
+			t.Fatalf("got event at %d, want %d", ev.KV.ModRevision, rev)
+		}
+	}
+
+	applyCommand(t, f, 5, &command{Op: opCompact, Revision: 3})
+	if _, err := s.Watch(WatchOptions{Key: "k", StartRevision: 2}); !errors.Is(err, ErrCompacted) {
+		t.Fatalf("watch from compacted revision: got %v", err)
+	}
+}
+
+func TestWatch_Cancel(t *testing.T) {
+	s := NewStore(t.TempDir(), "", true)
+	w, err := s.Watch(WatchOptions{Key: "k"})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	w.Cancel()
+	if _, ok := <-w.Events(); ok {
+		t.Fatalf("events channel should be closed after cancel")
+	}
+	if w.Err() != nil {
+		t.Fatalf("cancel should not set an error, got %v", w.Err())
+	}
+	applyCommand(t, newFSM(s), 1, &command{Op: opSet, Key: "k", Value: "v"})
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AppliedIndexHeader 是写响应中的读自己写凭证 "<group>:<index>"：写入所在的 Raft 组，以及写入完成时本节点在该组已应用的日志索引
+// 各组的日志索引相互独立，读请求带上该请求头时，节点只在读取同一个组时先等待自己应用到该索引
+const AppliedIndexHeader = "X-Raft-Index"
+
+// ContextAppliedIndex 是处理器在 gin.Context 中设置的 func() (int, uint64)，返回请求所在的 Raft 组及其已应用索引
+// 未设置时为 0 号组，已应用索引使用 AppliedIndex 的参数
+const ContextAppliedIndex = "appliedIndex"
+
+// FormatAppliedIndex 返回 group 组已应用到 index 的凭证
+func FormatAppliedIndex(group int, index uint64) string {
+	return strconv.Itoa(group) + ":" + strconv.FormatUint(index, 10)
+}
+
+// ParseAppliedIndex 解析 X-Raft-Index 凭证，返回组号和已应用索引
+func ParseAppliedIndex(token string) (int, uint64, error) {
+	g, i, ok := strings.Cut(token, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("missing raft group in %q", token)
+	}
+	group, err := strconv.Atoi(g)
+	if err != nil || group < 0 {
+		return 0, 0, fmt.Errorf("invalid raft group in %q", token)
+	}
+	index, err := strconv.ParseUint(i, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid index in %q", token)
+	}
+	return group, index, nil
+}
+
+// AppliedIndex 中间件在写请求的响应头中加入 X-Raft-Index，applied 返回 0 号组的已应用索引
+// 写入在响应之前已经应用，因此响应时的已应用索引不小于写入所在的日志索引
+// 转发到其他节点的请求沿用对方响应中的 X-Raft-Index
+func AppliedIndex(applied func() uint64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		c.Writer = &appliedIndexWriter{ResponseWriter: c.Writer, ctx: c, applied: applied}
+		c.Next()
+	}
+}
+
+// appliedIndexWriter 在写出响应头之前设置 X-Raft-Index
+type appliedIndexWriter struct {
+	gin.ResponseWriter
+	ctx     *gin.Context
+	applied func() uint64
+	done    bool
+}
+
+func (w *appliedIndexWriter) setIndex() {
+	if w.done || w.Written() {
+		return
+	}
+	w.done = true
+	if w.Header().Get(AppliedIndexHeader) != "" {
+		return
+	}
+	group, index := 0, uint64(0)
+	if v, ok := w.ctx.Get(ContextAppliedIndex); ok {
+		group, index = v.(func() (int, uint64))()
+	} else {
+		index = w.applied()
+	}
+	w.Header().Set(AppliedIndexHeader, FormatAppliedIndex(group, index))
+}
+
+func (w *appliedIndexWriter) WriteHeader(code int) {
+	w.setIndex()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *appliedIndexWriter) WriteHeaderNow() {
+	w.setIndex()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *appliedIndexWriter) Write(data []byte) (int, error) {
+	w.setIndex()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *appliedIndexWriter) WriteString(s string) (int, error) {
+	w.setIndex()
+	return w.ResponseWriter.WriteString(s)
+}
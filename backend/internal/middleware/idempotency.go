@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader 写请求的幂等键请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// 幂等键和请求摘要在 gin.Context 中的键
+const (
+	ContextIdempotencyKey = "idempotencyKey"
+	ContextFingerprint    = "idempotencyFingerprint"
+)
+
+// 幂等键的最大长度
+const maxIdempotencyKeyLen = 255
+
+// Idempotency 中间件为带 Idempotency-Key 的写请求计算请求摘要
+// 摘要覆盖方法、路径、查询参数和请求体，处理器将幂等键和摘要随写操作一起提交
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"status":  "error",
+				"message": IdempotencyKeyHeader + " is too long",
+			})
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			body, err = io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"status":  "error",
+					"message": "Failed to read request body: " + err.Error(),
+				})
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		h := sha256.New()
+		io.WriteString(h, c.Request.Method+"\n"+c.Request.URL.RequestURI()+"\n")
+		h.Write(body)
+
+		c.Set(ContextIdempotencyKey, key)
+		c.Set(ContextFingerprint, hex.EncodeToString(h.Sum(nil)))
+		c.Next()
+	}
+}
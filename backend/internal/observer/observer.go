@@ -45,6 +45,13 @@ type RaftStateMessage struct {
 	Metrics   RaftMetrics `json:"metrics"`
 }
 
+// RaftLogMessage 表示状态机应用的一条日志，包括 Leader 提议的过期删除
+type RaftLogMessage struct {
+	Type      string         `json:"type"` // 消息类型，固定为 raft_log
+	Timestamp time.Time      `json:"timestamp"`
+	Entry     store.LogEntry `json:"entry"`
+}
+
 // RaftStateObserver 观察Raft状态的观察器
 type RaftStateObserver struct {
 	store     *store.Store
@@ -58,9 +65,17 @@ type RaftStateObserver struct {
 }
 
 // NewRaftStateObserver 创建一个新的Raft状态观察器
-func NewRaftStateObserver(store *store.Store, wsManager *websocket.Manager) *RaftStateObserver {
+// 应用的日志通过 WebSocket 以 raft_log 消息广播给可视化的日志视图
+func NewRaftStateObserver(kvStore *store.Store, wsManager *websocket.Manager) *RaftStateObserver {
+	kvStore.SetLogHandler(func(entry store.LogEntry) {
+		wsManager.BroadcastJSON(RaftLogMessage{
+			Type:      "raft_log",
+			Timestamp: time.Now(),
+			Entry:     entry,
+		})
+	})
 	return &RaftStateObserver{
-		store:     store,
+		store:     kvStore,
 		wsManager: wsManager,
 		stopChan:  make(chan struct{}), // 初始化停止通道
 	}
@@ -164,7 +179,7 @@ func (o *RaftStateObserver) collectAndBroadcastState() error {
 
 	message := RaftStateMessage{
 		Type:      "raft_state",
-		NodeID:    o.nodeID,
+		NodeID:    o.store.NodeID(),
 		Timestamp: time.Now(),
 		Metrics:   *metrics,
 	}
@@ -0,0 +1,628 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"gotoraft/internal/kvstore/store"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compatVersion 是 INFO 中声明兼容的 Redis 版本，SCAN 等命令从该版本开始提供，部分客户端据此判断可用的命令
+const compatVersion = "2.8.0"
+
+const (
+	keysPageSize     = 1000 // KEYS 每次扫描的键数
+	defaultScanCount = 10   // SCAN 未指定 COUNT 时每次返回的键数
+	maxCursors       = 64   // 每个连接保留的 SCAN 游标数，超出时丢弃最早的
+	maxSetRetries    = 16   // SET XX 遇到并发修改时的最多重试次数
+)
+
+// commandSpec 描述一个命令
+type commandSpec struct {
+	arity int // 参数个数（含命令名），负数表示至少 -arity 个
+	run   func(ss *session, args []string) (quit bool)
+}
+
+// commands 是支持的命令，键为大写的命令名
+var commands = map[string]commandSpec{
+	"PING":        {-1, (*session).ping},
+	"QUIT":        {1, (*session).quit},
+	"SELECT":      {2, (*session).selectDB},
+	"COMMAND":     {-1, (*session).command},
+	"INFO":        {-1, (*session).info},
+	"READONLY":    {1, (*session).readOnly},
+	"READWRITE":   {1, (*session).readWrite},
+	"CONSISTENCY": {2, (*session).consistency},
+	"GET":         {2, (*session).get},
+	"SET":         {-3, (*session).set},
+	"DEL":         {-2, (*session).del},
+	"EXISTS":      {-2, (*session).exists},
+	"INCR":        {2, (*session).incr},
+	"KEYS":        {2, (*session).keys},
+	"SCAN":        {-2, (*session).scan},
+
+	forwardedCommand: {1, (*session).markForwarded},
+}
+
+// dispatch 执行一个命令，返回是否需要关闭连接
+func (ss *session) dispatch(args []string) bool {
+	name := strings.ToUpper(args[0])
+	spec, ok := commands[name]
+	if !ok {
+		ss.w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+	if (spec.arity > 0 && len(args) != spec.arity) || (spec.arity < 0 && len(args) < -spec.arity) {
+		ss.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return false
+	}
+	return spec.run(ss, args)
+}
+
+// storeError 将存储层的错误写为错误回复，错误码尽量与 Redis Cluster 一致
+func (w writer) storeError(err error) {
+	switch {
+	case errors.Is(err, store.ErrNotLeader):
+		w.error("NOTLEADER " + err.Error())
+	case errors.Is(err, store.ErrCrossGroup):
+		w.error("CROSSSLOT Keys in request don't hash to the same slot")
+	case errors.Is(err, store.ErrSlotFrozen), errors.Is(err, store.ErrSlotMoved):
+		// 槽正在迁移或本节点的槽路由还没有更新，稍后重试会被路由到新的组
+		w.error("TRYAGAIN " + err.Error())
+	case errors.Is(err, store.ErrNoSpace), errors.Is(err, store.ErrQuotaExceeded):
+		w.error("OOM " + err.Error())
+	case errors.Is(err, store.ErrNotANumber):
+		w.error("ERR value is not an integer or out of range")
+	case errors.Is(err, store.ErrCounterOutOfRange):
+		w.error("ERR increment or decrement would overflow")
+	default:
+		w.error("ERR " + err.Error())
+	}
+}
+
+func (ss *session) ping(args []string) bool {
+	switch len(args) {
+	case 1:
+		ss.w.simple("PONG")
+	case 2:
+		ss.w.bulk(args[1])
+	default:
+		ss.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+	return false
+}
+
+func (ss *session) quit(args []string) bool {
+	ss.w.simple("OK")
+	return true
+}
+
+// selectDB 只有 0 号数据库，客户端连接时常会发送 SELECT 0
+func (ss *session) selectDB(args []string) bool {
+	if args[1] != "0" {
+		ss.w.error("ERR DB index is out of range")
+		return false
+	}
+	ss.w.simple("OK")
+	return false
+}
+
+// command 不提供命令文档，返回空数组以兼容连接时发送 COMMAND 的客户端
+func (ss *session) command(args []string) bool {
+	ss.w.array(0)
+	return false
+}
+
+func (ss *session) readOnly(args []string) bool {
+	ss.level = store.Stale
+	ss.w.simple("OK")
+	return false
+}
+
+func (ss *session) readWrite(args []string) bool {
+	ss.level = store.Default
+	ss.w.simple("OK")
+	return false
+}
+
+// consistency 设置连接上读取的一致性级别：stale、default 或 linearizable
+func (ss *session) consistency(args []string) bool {
+	lvl, err := store.ParseConsistencyLevel(strings.ToLower(args[1]))
+	if err != nil {
+		ss.w.error("ERR " + err.Error())
+		return false
+	}
+	ss.level = lvl
+	ss.w.simple("OK")
+	return false
+}
+
+func (ss *session) markForwarded(args []string) bool {
+	ss.forwarded = true
+	ss.w.simple("OK")
+	return false
+}
+
+func (ss *session) get(args []string) bool {
+	s, ok := ss.routeKeys(args, args[1:2], ss.level)
+	if !ok {
+		return false
+	}
+	v, err := s.Get(args[1], ss.level)
+	switch {
+	case errors.Is(err, store.ErrKeyNotFound):
+		ss.w.null()
+	case err != nil:
+		ss.w.storeError(err)
+	default:
+		ss.w.bulk(v)
+	}
+	return false
+}
+
+// set 写入键：SET key value [EX seconds | PX milliseconds] [NX | XX]
+// 没有 EX/PX 时清除原有的 TTL；NX、XX 的条件不满足时返回空回复
+func (ss *session) set(args []string) bool {
+	key, value := args[1], args[2]
+	var opts store.PutOptions
+	var nx, xx, expire bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NX" && !xx:
+			nx = true
+		case opt == "XX" && !nx:
+			xx = true
+		case (opt == "EX" || opt == "PX") && !expire && i+1 < len(args):
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				ss.w.error("ERR value is not an integer or out of range")
+				return false
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > int64(1<<62)/int64(unit) {
+				ss.w.error("ERR invalid expire time in 'set' command")
+				return false
+			}
+			opts.TTL = time.Duration(n) * unit
+			expire = true
+			i++
+		default:
+			ss.w.error("ERR syntax error")
+			return false
+		}
+	}
+
+	s, ok := ss.routeKeys(args, args[1:2], store.Default)
+	if !ok {
+		return false
+	}
+	var err error
+	switch {
+	case nx:
+		_, err = s.SetIfAbsent(key, value, opts)
+		if errors.Is(err, store.ErrKeyExists) {
+			ss.w.null()
+			return false
+		}
+	case xx:
+		var done bool
+		done, err = setIfPresent(s, key, value, opts)
+		if err == nil && !done {
+			ss.w.null()
+			return false
+		}
+	default:
+		_, err = s.Put(key, value, opts)
+	}
+	if err != nil {
+		ss.w.storeError(err)
+		return false
+	}
+	ss.w.simple("OK")
+	return false
+}
+
+// setIfPresent 仅当键存在时写入，用修订号作为条件，期间键被并发修改时重试
+// 键不存在时返回 false
+func setIfPresent(s *store.Store, key, value string, opts store.PutOptions) (bool, error) {
+	for i := 0; i < maxSetRetries; i++ {
+		cur, err := s.GetAt(key, 0, store.Stale)
+		if errors.Is(err, store.ErrKeyNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err = s.CompareAndSwap(key, value, store.Condition{PrevRevision: cur.ModRevision}, opts)
+		if !errors.Is(err, store.ErrPreconditionFailed) {
+			return err == nil, err
+		}
+	}
+	return false, fmt.Errorf("%w: key %q is being modified concurrently", store.ErrPreconditionFailed, key)
+}
+
+// del 在一个事务中删除所有键，返回实际删除的键数
+func (ss *session) del(args []string) bool {
+	keys := args[1:]
+	s, ok := ss.routeKeys(args, keys, store.Default)
+	if !ok {
+		return false
+	}
+	txn := &store.Txn{}
+	for _, k := range keys {
+		txn.Success = append(txn.Success, store.Op{Type: store.OpDelete, Key: k})
+	}
+	if err := txn.Validate(); err != nil {
+		ss.w.error("ERR " + err.Error())
+		return false
+	}
+	res, err := s.Txn(txn)
+	if err != nil {
+		ss.w.storeError(err)
+		return false
+	}
+	var n int64
+	for _, r := range res.Results {
+		if r.KV != nil {
+			n++
+		}
+	}
+	ss.w.integer(n)
+	return false
+}
+
+// exists 返回存在的键数，重复的键重复计数
+func (ss *session) exists(args []string) bool {
+	keys := args[1:]
+	s, ok := ss.routeKeys(args, keys, ss.level)
+	if !ok {
+		return false
+	}
+	var n int64
+	lvl := ss.level
+	for _, k := range keys {
+		_, err := s.GetAt(k, 0, lvl)
+		switch {
+		case err == nil:
+			n++
+		case !errors.Is(err, store.ErrKeyNotFound):
+			ss.w.storeError(err)
+			return false
+		}
+		// 第一次读取已经满足一致性级别，之后的键读取本地状态即可
+		lvl = store.Stale
+	}
+	ss.w.integer(n)
+	return false
+}
+
+func (ss *session) incr(args []string) bool {
+	s, ok := ss.routeKeys(args, args[1:2], store.Default)
+	if !ok {
+		return false
+	}
+	kv, err := s.Increment(args[1], 1, store.IncrOptions{})
+	if err != nil {
+		ss.w.storeError(err)
+		return false
+	}
+	n, _ := strconv.ParseInt(kv.Value, 10, 64)
+	ss.w.integer(n)
+	return false
+}
+
+// scanner 返回按键升序扫描的函数，规则与 HTTP 的列表接口相同：多个组时在本节点读取所有组，
+// 只有一个组时按该组的 Leader 转发，已写入回复时返回 false
+func (ss *session) scanner(args []string) (func(store.ScanOptions) (*store.ScanResult, error), bool) {
+	lvl := ss.level
+	if ss.srv.shards.Len() > 1 {
+		return func(opts store.ScanOptions) (*store.ScanResult, error) {
+			return ss.srv.shards.Scan(opts, lvl)
+		}, true
+	}
+	s, ok := ss.route(args, 0, lvl)
+	if !ok {
+		return nil, false
+	}
+	return func(opts store.ScanOptions) (*store.ScanResult, error) {
+		return s.Scan(opts, lvl)
+	}, true
+}
+
+// keys 返回匹配 glob 模式的所有键
+func (ss *session) keys(args []string) bool {
+	scan, ok := ss.scanner(args)
+	if !ok {
+		return false
+	}
+	pattern := args[1]
+	opts := store.ScanOptions{Prefix: literalPrefix(pattern), Limit: keysPageSize}
+	var keys []string
+	for {
+		res, err := scan(opts)
+		if err != nil {
+			ss.w.storeError(err)
+			return false
+		}
+		for _, kv := range res.KVs {
+			if match(pattern, kv.Key) {
+				keys = append(keys, kv.Key)
+			}
+		}
+		if !res.More {
+			break
+		}
+		opts.Start = res.Next
+	}
+	ss.w.array(len(keys))
+	for _, k := range keys {
+		ss.w.bulk(k)
+	}
+	return false
+}
+
+// scan 增量遍历键：SCAN cursor [MATCH pattern] [COUNT count]
+// 游标是连接内的编号，对应下一页的起始键；遍历期间一直存在的键保证被返回
+func (ss *session) scan(args []string) bool {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		ss.w.error("ERR invalid cursor")
+		return false
+	}
+	pattern := "*"
+	count := defaultScanCount
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "MATCH" && i+1 < len(args):
+			pattern = args[i+1]
+			i++
+		case opt == "COUNT" && i+1 < len(args):
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				ss.w.error("ERR value is not an integer or out of range")
+				return false
+			}
+			if n < 1 {
+				ss.w.error("ERR syntax error")
+				return false
+			}
+			count = min(n, keysPageSize)
+			i++
+		default:
+			ss.w.error("ERR syntax error")
+			return false
+		}
+	}
+
+	opts := store.ScanOptions{Prefix: literalPrefix(pattern), Limit: count}
+	if cursor != 0 {
+		start, ok := ss.cursors[cursor]
+		if !ok {
+			ss.w.error("ERR invalid cursor")
+			return false
+		}
+		opts.Start = start
+	}
+	scan, ok := ss.scanner(args)
+	if !ok {
+		return false
+	}
+	res, err := scan(opts)
+	if err != nil {
+		ss.w.storeError(err)
+		return false
+	}
+
+	next := uint64(0)
+	if res.More {
+		next = ss.saveCursor(res.Next)
+	}
+	var keys []string
+	for _, kv := range res.KVs {
+		if match(pattern, kv.Key) {
+			keys = append(keys, kv.Key)
+		}
+	}
+	ss.w.array(2)
+	ss.w.bulk(strconv.FormatUint(next, 10))
+	ss.w.array(len(keys))
+	for _, k := range keys {
+		ss.w.bulk(k)
+	}
+	return false
+}
+
+// saveCursor 保存下一页的起始键并返回新的游标
+func (ss *session) saveCursor(start string) uint64 {
+	ss.nextCursor++
+	ss.cursors[ss.nextCursor] = start
+	if len(ss.cursors) > maxCursors {
+		delete(ss.cursors, ss.nextCursor-maxCursors)
+	}
+	return ss.nextCursor
+}
+
+// info 返回节点和各 Raft 组的状态：INFO [section]
+func (ss *session) info(args []string) bool {
+	if len(args) > 2 {
+		ss.w.error("ERR syntax error")
+		return false
+	}
+	section := "default"
+	if len(args) == 2 {
+		section = strings.ToLower(args[1])
+	}
+	shards := ss.srv.shards
+	status := shards.Status()
+	g0 := shards.Group(0)
+	leaderID, _ := g0.Leader()
+	role := "slave"
+	if g0.IsLeader() {
+		role = "master"
+	}
+	mode := "standalone"
+	if shards.Len() > 1 {
+		mode = "cluster"
+	}
+
+	type infoSection struct {
+		name  string
+		lines []string
+	}
+	sections := []infoSection{
+		{"server", []string{
+			"redis_version:" + compatVersion,
+			"redis_mode:" + mode,
+			"node_id:" + g0.NodeID(),
+			"tcp_addr:" + ss.srv.Addr(),
+			fmt.Sprintf("uptime_in_seconds:%d", int64(time.Since(ss.srv.start).Seconds())),
+		}},
+		{"clients", []string{
+			fmt.Sprintf("connected_clients:%d", ss.srv.clients()),
+		}},
+		{"replication", []string{
+			"role:" + role,
+			"leader_id:" + leaderID,
+		}},
+	}
+	raftLines := []string{
+		fmt.Sprintf("raft_groups:%d", shards.Len()),
+		fmt.Sprintf("hash_slots:%d", shards.NumSlots()),
+	}
+	var storage int64
+	for _, st := range status {
+		size := shards.Group(st.Group).StorageSize()
+		storage += size
+		raftLines = append(raftLines, fmt.Sprintf("group%d:state=%s,leader=%s,term=%d,applied_index=%d,slots=%d,storage_bytes=%d",
+			st.Group, st.State, st.LeaderID, st.Term, st.AppliedIndex, countSlots(st.Slots), size))
+	}
+	raftLines = append(raftLines, fmt.Sprintf("storage_bytes:%d", storage))
+	sections = append(sections, infoSection{"raft", raftLines})
+
+	var b strings.Builder
+	found := false
+	for _, sec := range sections {
+		if section != "default" && section != "all" && section != "everything" && section != sec.name {
+			continue
+		}
+		if found {
+			b.WriteString("\r\n")
+		}
+		found = true
+		b.WriteString("# " + strings.ToUpper(sec.name[:1]) + sec.name[1:] + "\r\n")
+		for _, l := range sec.lines {
+			b.WriteString(l + "\r\n")
+		}
+	}
+	ss.w.bulk(b.String())
+	return false
+}
+
+// countSlots 返回槽范围中的槽数
+func countSlots(ranges []store.SlotRange) int {
+	n := 0
+	for _, r := range ranges {
+		n += r.End - r.Start + 1
+	}
+	return n
+}
+
+// literalPrefix 返回 glob 模式中第一个通配符之前的部分，用于缩小扫描范围
+func literalPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// match 按 Redis 的 glob 规则匹配：* 任意串，? 任意字符，[abc]、[^a-z] 字符集合，\ 转义
+// 与 Redis 相同，按字节匹配
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest := matchClass(pattern[1:], s[0])
+			if !matched {
+				return false
+			}
+			s = s[1:]
+			pattern = rest
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass 匹配 [ 之后的字符集合，返回 c 是否属于集合以及 ] 之后的模式
+// 没有闭合的 ] 时集合延续到模式末尾，与 Redis 相同
+func matchClass(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			if pattern[1] == c {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) >= 3 && pattern[1] == '-':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == c {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != not, pattern
+}
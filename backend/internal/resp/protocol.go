@@ -0,0 +1,172 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxArgs    = 1 << 20   // 单个命令最多的参数数
+	maxBulkLen = 512 << 20 // 单个参数的最大长度，与 Redis 的默认值相同
+	readerSize = 64 << 10  // 读缓冲区大小，也是内联命令一行的上限
+)
+
+// protocolError 是客户端发送的数据不符合协议，回复后关闭连接
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// readCommand 读取一个命令：由批量字符串组成的数组，或者以空格分隔的内联命令（便于 telnet 调试）
+// 空的内联命令返回空切片
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(string(line)), nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%s'", line))
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("bulk string is not terminated by CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine 读取一行，返回的内容不含行尾的 CRLF（或单独的 LF），在下一次读取之前有效
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolError("too big inline request")
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+// readReply 读取一个完整的回复并原样追加到 out，用于把 Leader 的回复转发给客户端
+func readReply(r *bufio.Reader, out []byte) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return out, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return out, protocolError("invalid reply line")
+	}
+	out = append(out, line...)
+	switch line[0] {
+	case '+', '-', ':':
+		return out, nil
+	case '$':
+		n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+		if err != nil || n > maxBulkLen {
+			return out, protocolError("invalid bulk length in reply")
+		}
+		if n < 0 {
+			return out, nil
+		}
+		start := len(out)
+		out = append(out, make([]byte, n+2)...)
+		if _, err := io.ReadFull(r, out[start:]); err != nil {
+			return out, err
+		}
+		return out, nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+		if err != nil || n > maxArgs {
+			return out, protocolError("invalid multibulk length in reply")
+		}
+		for i := 0; i < n; i++ {
+			if out, err = readReply(r, out); err != nil {
+				return out, err
+			}
+		}
+		return out, nil
+	default:
+		return out, protocolError(fmt.Sprintf("unknown reply type '%c'", line[0]))
+	}
+}
+
+// writer 编码 RESP2 回复，写入错误保存在 bufio.Writer 中，由 Flush 返回
+type writer struct {
+	*bufio.Writer
+}
+
+func (w writer) simple(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// error 写入错误回复，msg 以错误码开头，例如 "ERR syntax error"
+func (w writer) error(msg string) {
+	// 错误回复只有一行
+	msg = strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+	w.WriteString("-" + msg + "\r\n")
+}
+
+func (w writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n")
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// null 写入空的批量字符串，表示键不存在或条件写入没有执行
+func (w writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+func (w writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// command 以批量字符串数组编码一个命令，用于转发
+func (w writer) command(args []string) {
+	w.array(len(args))
+	for _, a := range args {
+		w.bulk(a)
+	}
+}
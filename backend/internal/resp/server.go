@@ -0,0 +1,308 @@
+// Package resp 提供兼容 Redis 协议（RESP2）的 TCP 前端，命令映射到与 HTTP API 相同的存储操作
+//
+// 路由规则与 HTTP API 相同：键按哈希槽路由到所在的 Raft 组，需要 Leader 的命令（写入以及非 stale 的读取）
+// 在本节点不是该组的 Leader 时转发到 Leader 的 RESP 地址；不知道 Leader 的地址时由本节点处理，返回 NOTLEADER 错误。
+// 读取默认使用 default 一致性级别，READONLY 切换为 stale（可由 Follower 提供），CONSISTENCY 可以指定任意级别
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/pkg/logger"
+	"net"
+	"sync"
+	"time"
+)
+
+// Server 是 RESP 前端的监听器
+type Server struct {
+	shards *store.Shards
+	peers  map[string]string // 其他节点的 ID 及其 RESP 地址，用于转发到 Leader
+	start  time.Time
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer 创建 RESP 前端，peers 为其他节点的 ID 及其 RESP 地址
+func NewServer(shards *store.Shards, peers map[string]string) *Server {
+	return &Server{
+		shards: shards,
+		peers:  peers,
+		start:  time.Now(),
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen 在 addr 上监听，并在后台处理连接
+func (srv *Server) Listen(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("resp listen: %s", err)
+	}
+	srv.mu.Lock()
+	srv.listener = lis
+	srv.mu.Unlock()
+	srv.wg.Add(1)
+	go srv.serve(lis)
+	return nil
+}
+
+// Addr 返回监听地址，没有监听时返回空字符串
+func (srv *Server) Addr() string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.listener == nil {
+		return ""
+	}
+	return srv.listener.Addr().String()
+}
+
+// Close 停止监听，关闭所有连接并等待它们退出
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	srv.closed = true
+	var err error
+	if srv.listener != nil {
+		err = srv.listener.Close()
+	}
+	for c := range srv.conns {
+		c.Close()
+	}
+	srv.mu.Unlock()
+	srv.wg.Wait()
+	return err
+}
+
+func (srv *Server) serve(lis net.Listener) {
+	defer srv.wg.Done()
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			srv.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("RESP accept failed:", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		srv.mu.Lock()
+		if srv.closed {
+			srv.mu.Unlock()
+			conn.Close()
+			return
+		}
+		srv.conns[conn] = struct{}{}
+		srv.wg.Add(1)
+		srv.mu.Unlock()
+		go srv.handle(conn)
+	}
+}
+
+// clients 返回当前的连接数
+func (srv *Server) clients() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return len(srv.conns)
+}
+
+// handle 逐个读取并执行连接上的命令，客户端流水线发送的命令执行完后一起写回
+func (srv *Server) handle(conn net.Conn) {
+	defer srv.wg.Done()
+	ss := newSession(srv, conn)
+	defer func() {
+		ss.close()
+		srv.mu.Lock()
+		delete(srv.conns, conn)
+		srv.mu.Unlock()
+	}()
+
+	for {
+		args, err := readCommand(ss.r)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				ss.w.error("ERR " + perr.Error())
+				ss.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := ss.dispatch(args)
+		if quit || ss.r.Buffered() == 0 {
+			if err := ss.w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// session 是一个客户端连接的状态
+type session struct {
+	srv  *Server
+	conn net.Conn
+	r    *bufio.Reader
+	w    writer
+
+	level     store.ConsistencyLevel // 读取的一致性级别
+	forwarded bool                   // 连接来自转发命令的其他节点，不再转发
+	peers     map[string]*peerConn   // 到各 Leader 的转发连接
+
+	cursors    map[uint64]string // SCAN 游标对应的下一个键
+	nextCursor uint64
+}
+
+func newSession(srv *Server, conn net.Conn) *session {
+	return &session{
+		srv:     srv,
+		conn:    conn,
+		r:       bufio.NewReaderSize(conn, readerSize),
+		w:       writer{bufio.NewWriter(conn)},
+		level:   store.Default,
+		peers:   make(map[string]*peerConn),
+		cursors: make(map[uint64]string),
+	}
+}
+
+func (ss *session) close() {
+	for _, p := range ss.peers {
+		p.close()
+	}
+	ss.conn.Close()
+}
+
+// route 返回处理命令的组
+// 需要 Leader 的命令在本节点不是该组的 Leader 时转发到 Leader，此时已写入回复并返回 false
+func (ss *session) route(args []string, group int, lvl store.ConsistencyLevel) (*store.Store, bool) {
+	s := ss.srv.shards.Group(group)
+	if lvl == store.Stale || s.IsLeader() || ss.forwarded {
+		return s, true
+	}
+	id, _ := s.Leader()
+	addr, ok := ss.srv.peers[id]
+	if id == "" || !ok {
+		return s, true
+	}
+	reply, err := ss.forward(addr, args)
+	if err != nil {
+		ss.w.error("ERR failed to forward to leader: " + err.Error())
+		return nil, false
+	}
+	ss.w.Write(reply)
+	return nil, false
+}
+
+// routeKeys 返回所有键共同所在的组，键属于不同的组时写入 CROSSSLOT 错误
+func (ss *session) routeKeys(args []string, keys []string, lvl store.ConsistencyLevel) (*store.Store, bool) {
+	group, err := ss.srv.shards.GroupOfKeys(keys...)
+	if err != nil {
+		ss.w.storeError(err)
+		return nil, false
+	}
+	return ss.route(args, group, lvl)
+}
+
+// forward 把命令发送到 addr 并返回原始回复，转发连接在会话内复用
+// 连接出错时关闭，下一次转发重新建立
+func (ss *session) forward(addr string, args []string) ([]byte, error) {
+	p, ok := ss.peers[addr]
+	if !ok {
+		var err error
+		if p, err = dialPeer(addr); err != nil {
+			return nil, err
+		}
+		ss.peers[addr] = p
+	}
+	reply, err := p.do(ss.level, args)
+	if err != nil {
+		p.close()
+		delete(ss.peers, addr)
+	}
+	return reply, err
+}
+
+// forwardTimeout 转发一个命令的最长时间，包括 Leader 提交写入的时间
+const forwardTimeout = 15 * time.Second
+
+// forwardedCommand 在转发连接建立时发送，对方节点不再转发该连接上的命令，避免 Leader 变化时循环转发
+const forwardedCommand = "RAFT.FORWARDED"
+
+// peerConn 是转发命令到其他节点的连接
+type peerConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	w     writer
+	level store.ConsistencyLevel // 对方会话当前的一致性级别
+}
+
+func dialPeer(addr string) (*peerConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, forwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	p := &peerConn{
+		conn:  conn,
+		r:     bufio.NewReader(conn),
+		w:     writer{bufio.NewWriter(conn)},
+		level: store.Default,
+	}
+	if err := p.call([]string{forwardedCommand}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// do 以一致性级别 lvl 执行命令，返回原始回复
+func (p *peerConn) do(lvl store.ConsistencyLevel, args []string) ([]byte, error) {
+	if lvl != p.level {
+		if err := p.call([]string{"CONSISTENCY", levelName(lvl)}); err != nil {
+			return nil, err
+		}
+		p.level = lvl
+	}
+	p.conn.SetDeadline(time.Now().Add(forwardTimeout))
+	p.w.command(args)
+	if err := p.w.Flush(); err != nil {
+		return nil, err
+	}
+	return readReply(p.r, nil)
+}
+
+// call 执行期望回复 +OK 的命令
+func (p *peerConn) call(args []string) error {
+	reply, err := p.do(p.level, args)
+	if err != nil {
+		return err
+	}
+	if string(reply) != "+OK\r\n" {
+		return fmt.Errorf("unexpected reply to %s: %q", args[0], reply)
+	}
+	return nil
+}
+
+func (p *peerConn) close() {
+	p.conn.Close()
+}
+
+// levelName 返回一致性级别在 CONSISTENCY 命令中的名称
+func levelName(lvl store.ConsistencyLevel) string {
+	switch lvl {
+	case store.Stale:
+		return "stale"
+	case store.Linearizable:
+		return "linearizable"
+	default:
+		return "default"
+	}
+}
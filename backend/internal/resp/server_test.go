@@ -0,0 +1,376 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"gotoraft/internal/kvstore/store"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// respError 是服务端返回的错误回复
+type respError string
+
+// client 是测试用的 RESP 客户端
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send 以批量字符串数组发送命令，不读取回复
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// do 发送命令并返回回复：简单字符串和批量字符串为 string，空回复为 nil，
+// 整数为 int64，错误为 respError，数组为 []any
+func (c *client) do(args ...string) any {
+	c.t.Helper()
+	c.send(args...)
+	return c.read()
+}
+
+func (c *client) read() any {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("read reply: %v", err)
+	}
+	if !strings.HasSuffix(line, "\r\n") {
+		c.t.Fatalf("reply line without CRLF: %q", line)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return respError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			c.t.Fatalf("invalid integer reply %q", line)
+		}
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatalf("read bulk: %v", err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		out := make([]any, n)
+		for i := range out {
+			out[i] = c.read()
+		}
+		return out
+	default:
+		c.t.Fatalf("unknown reply %q", line)
+		return nil
+	}
+}
+
+// expect 发送命令并检查回复
+func (c *client) expect(want any, args ...string) {
+	c.t.Helper()
+	if got := c.do(args...); !reflect.DeepEqual(got, want) {
+		c.t.Fatalf("%v: got %#v, want %#v", args, got, want)
+	}
+}
+
+// expectError 发送命令并检查错误回复的前缀
+func (c *client) expectError(prefix string, args ...string) {
+	c.t.Helper()
+	got, ok := c.do(args...).(respError)
+	if !ok || !strings.HasPrefix(string(got), prefix) {
+		c.t.Fatalf("%v: got %#v, want error %q", args, got, prefix)
+	}
+}
+
+// freeAddr 返回一个空闲的本地地址，加入集群的节点需要可以对外通告的 Raft 端口
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// openNode 打开一个节点的所有 Raft 组，0 号组的 Raft 地址为 bind，bootstrap 为 true 时等待各组选出 Leader
+func openNode(t *testing.T, id, bind string, bootstrap bool, cfg store.ShardConfig) *store.Shards {
+	t.Helper()
+	sh, err := store.NewShards(store.NewStore(t.TempDir(), bind, true), cfg)
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	if err := sh.Open(bootstrap, id); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { sh.Shutdown() })
+	for i := 0; bootstrap && i < sh.Len(); i++ {
+		waitFor(t, "leader election", sh.Group(i).IsLeader)
+	}
+	return sh
+}
+
+func startServer(t *testing.T, sh *store.Shards, peers map[string]string) *Server {
+	t.Helper()
+	srv := NewServer(sh, peers)
+	if err := srv.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestServer_Commands(t *testing.T) {
+	sh := openNode(t, "node0", "127.0.0.1:0", true, store.ShardConfig{Groups: 2, Slots: 16})
+	srv := startServer(t, sh, nil)
+	c := dial(t, srv.Addr())
+
+	c.expect("PONG", "PING")
+	c.expect("hello", "ping", "hello")
+	c.expect("OK", "SELECT", "0")
+	c.expectError("ERR unknown command", "FLUSHALL")
+	c.expectError("ERR wrong number of arguments for 'get'", "GET")
+
+	// SET 的各种选项
+	c.expect("OK", "SET", "k", "v1")
+	c.expect("v1", "GET", "k")
+	c.expect(nil, "GET", "missing")
+	c.expect(nil, "SET", "k", "v2", "NX")
+	c.expect(nil, "SET", "missing", "v", "XX")
+	c.expect(nil, "GET", "missing")
+	c.expect("OK", "SET", "k", "v2", "XX", "EX", "100")
+	c.expect("v2", "GET", "k")
+	s := sh.Group(sh.GroupOf("k"))
+	if kv, err := s.GetAt("k", 0, store.Stale); err != nil || kv.ExpireAt == 0 {
+		t.Fatalf("SET EX should set a TTL: %+v, %v", kv, err)
+	}
+	c.expect("OK", "SET", "k", "v3")
+	if kv, _ := s.GetAt("k", 0, store.Stale); kv.ExpireAt != 0 {
+		t.Fatalf("SET without EX should clear the TTL: %+v", kv)
+	}
+	c.expect("OK", "SET", "new", "v", "NX", "PX", "60000")
+	c.expectError("ERR syntax error", "SET", "k", "v", "NX", "XX")
+	c.expectError("ERR invalid expire time", "SET", "k", "v", "EX", "0")
+
+	// INCR
+	c.expect(int64(1), "INCR", "counter")
+	c.expect(int64(2), "INCR", "counter")
+	c.expectError("ERR value is not an integer", "INCR", "k")
+
+	// EXISTS 和 DEL，同一个 {tag} 的键在同一个组
+	c.expect("OK", "SET", "{u}:a", "1")
+	c.expect("OK", "SET", "{u}:b", "2")
+	c.expect(int64(3), "EXISTS", "{u}:a", "{u}:b", "{u}:a", "{u}:c")
+	c.expect(int64(2), "DEL", "{u}:a", "{u}:b", "{u}:c")
+	c.expect(int64(0), "EXISTS", "{u}:a")
+	var a, b string
+	for i := 0; b == ""; i++ {
+		k := fmt.Sprintf("k%d", i)
+		switch {
+		case a == "":
+			a = k
+		case sh.GroupOf(k) != sh.GroupOf(a):
+			b = k
+		}
+	}
+	c.expectError("CROSSSLOT", "DEL", a, b)
+
+	// KEYS 和 SCAN 合并所有组的键
+	var users []any
+	for i := 0; i < 12; i++ {
+		key := fmt.Sprintf("user:%02d", i)
+		c.expect("OK", "SET", key, "x")
+		users = append(users, key)
+	}
+	c.expect(users, "KEYS", "user:*")
+	c.expect([]any{"user:00", "user:01", "user:10", "user:11"}, "KEYS", "user:[01][01]")
+	c.expect([]any{"counter"}, "KEYS", "c?unter")
+
+	var scanned []string
+	cursor := "0"
+	for pages := 0; ; pages++ {
+		reply := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "5").([]any)
+		for _, k := range reply[1].([]any) {
+			scanned = append(scanned, k.(string))
+		}
+		cursor = reply[0].(string)
+		if cursor == "0" {
+			break
+		}
+		if pages > 10 {
+			t.Fatalf("scan did not finish")
+		}
+	}
+	if !sort.StringsAreSorted(scanned) || len(scanned) != 12 {
+		t.Fatalf("scanned %v", scanned)
+	}
+	c.expectError("ERR invalid cursor", "SCAN", "12345")
+
+	info := c.do("INFO").(string)
+	for _, want := range []string{"# Server\r\n", "role:master\r\n", "raft_groups:2\r\n", "group1:state=Leader,leader=node0"} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("INFO does not contain %q:\n%s", want, info)
+		}
+	}
+	if info := c.do("INFO", "replication").(string); strings.Contains(info, "# Server") {
+		t.Fatalf("INFO replication returned other sections:\n%s", info)
+	}
+}
+
+func TestServer_InlineAndPipeline(t *testing.T) {
+	sh := openNode(t, "node0", "127.0.0.1:0", true, store.ShardConfig{Groups: 1})
+	srv := startServer(t, sh, nil)
+	c := dial(t, srv.Addr())
+
+	// 内联命令
+	io.WriteString(c.conn, "SET inline value\r\nGET inline\r\n")
+	if got := c.read(); got != "OK" {
+		t.Fatalf("inline SET: %#v", got)
+	}
+	if got := c.read(); got != "value" {
+		t.Fatalf("inline GET: %#v", got)
+	}
+
+	// 流水线：一次写入多个命令，依次读取回复
+	var b strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&b, "*2\r\n$4\r\nINCR\r\n$1\r\nn\r\n")
+	}
+	io.WriteString(c.conn, b.String())
+	for i := 1; i <= 50; i++ {
+		if got := c.read(); got != int64(i) {
+			t.Fatalf("pipelined INCR %d: %#v", i, got)
+		}
+	}
+
+	// 协议错误时回复错误并关闭连接
+	io.WriteString(c.conn, "*1\r\n+PING\r\n")
+	if got, ok := c.read().(respError); !ok || !strings.HasPrefix(string(got), "ERR Protocol error") {
+		t.Fatalf("protocol error reply: %#v", got)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("connection should be closed after a protocol error, got %v", err)
+	}
+}
+
+func TestServer_ForwardsToLeader(t *testing.T) {
+	leader := openNode(t, "node0", "127.0.0.1:0", true, store.ShardConfig{Groups: 1})
+	bind := freeAddr(t)
+	follower := openNode(t, "node1", bind, false, store.ShardConfig{Groups: 1})
+	if err := leader.Group(0).GetRaft().AddVoter("node1", raft.ServerAddress(bind), 0, 0).Error(); err != nil {
+		t.Fatalf("add voter: %v", err)
+	}
+	waitFor(t, "follower to learn the leader", func() bool {
+		id, _ := follower.Group(0).Leader()
+		return id == "node0"
+	})
+
+	leaderSrv := startServer(t, leader, nil)
+	followerSrv := startServer(t, follower, map[string]string{"node0": leaderSrv.Addr()})
+	c := dial(t, followerSrv.Addr())
+
+	// 写入和默认级别的读取转发到 Leader
+	c.expect("OK", "SET", "k", "v")
+	c.expect(int64(1), "INCR", "n")
+	c.expect("v", "GET", "k")
+	c.expect("OK", "CONSISTENCY", "linearizable")
+	c.expect("v", "GET", "k")
+	c.expect([]any{"k", "n"}, "KEYS", "*")
+
+	// stale 读取由本节点提供
+	c.expect("OK", "READONLY")
+	waitFor(t, "replication to the follower", func() bool {
+		return c.do("GET", "k") == "v"
+	})
+	if _, err := follower.Group(0).GetAt("k", 0, store.Stale); err != nil {
+		t.Fatalf("follower should have the key locally: %v", err)
+	}
+
+	// 不知道 Leader 的 RESP 地址时由本节点处理
+	lonely := dial(t, startServer(t, follower, nil).Addr())
+	lonely.expectError("NOTLEADER", "SET", "k", "v2")
+	lonely.expect("OK", "READONLY")
+	lonely.expect("v", "GET", "k")
+}
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "users", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+	for _, tc := range cases {
+		if got := match(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tc.pattern, tc.s, got, tc.want)
+		}
+	}
+	if p := literalPrefix("user:[0-9]*"); p != "user:" {
+		t.Errorf("literal prefix: %q", p)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"gotoraft/internal/handler"
 	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/middleware"
 	"gotoraft/internal/observer"
 	"gotoraft/internal/websocket"
 
@@ -16,25 +17,33 @@ import (
 // Router 封装gin路由器
 type Router struct {
 	engine    *gin.Engine
-	store     *store.Store
+	store     *store.Store  // 0 号 Raft 组，负责命名空间、租约等非分片的功能
+	shards    *store.Shards // 所有 Raft 组，KV 请求按键路由
 	wsManager *websocket.Manager
 	observer  *observer.RaftStateObserver
 }
 
 // NewRouter 创建一个新的路由器实例
-func NewRouter(wsManager *websocket.Manager, store *store.Store, observer *observer.RaftStateObserver) *Router {
+func NewRouter(wsManager *websocket.Manager, shards *store.Shards, observer *observer.RaftStateObserver) *Router {
+	store := shards.Group(0)
 	engine := gin.New() // 使用gin.New()而不是gin.Default()以自定义中间件
 
 	// 添加中间件
-	engine.Use(gin.Logger())   // 日志中间件
-	engine.Use(gin.Recovery()) // 恢复中间件
+	engine.Use(gin.Logger())             // 日志中间件
+	engine.Use(gin.Recovery())           // 恢复中间件
+	engine.Use(middleware.Idempotency()) // 带 Idempotency-Key 的写请求计算请求摘要
+	// 写响应带上读自己写的凭证 X-Raft-Index
+	engine.Use(middleware.AppliedIndex(func() uint64 {
+		rev, _ := store.Revisions()
+		return rev
+	}))
 
 	// CORS中间件配置
 	engine.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Idempotency-Key", "X-Client-ID", "X-Client-Seq", "X-Namespace", middleware.AppliedIndexHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.AppliedIndexHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -42,6 +51,7 @@ func NewRouter(wsManager *websocket.Manager, store *store.Store, observer *obser
 	return &Router{
 		engine:    engine,
 		store:     store,
+		shards:    shards,
 		wsManager: wsManager,
 		observer:  observer,
 	}
@@ -50,7 +60,7 @@ func NewRouter(wsManager *websocket.Manager, store *store.Store, observer *obser
 // RegisterRoutes 注册所有路由
 func (r *Router) RegisterRoutes() {
 	// 基础健康检查路由
-	systemHandler := handler.NewSystemHandler()
+	systemHandler := handler.NewSystemHandler(r.store, r.wsManager)
 	api := r.engine.Group("/api")
 	{
 		systemGroup := api.Group("/system")
@@ -59,6 +69,10 @@ func (r *Router) RegisterRoutes() {
 			systemGroup.GET("/health", systemHandler.HandleHealth)
 			systemGroup.GET("/info", systemHandler.HandleSystemInfo)
 			systemGroup.GET("/status", systemHandler.HandleSystemStatus)
+
+			// 存储空间告警，压缩历史后需要显式解除
+			systemGroup.GET("/alarm", systemHandler.HandleAlarm)
+			systemGroup.POST("/alarm/disarm", systemHandler.HandleDisarmAlarm)
 		}
 	}
 
@@ -68,13 +82,31 @@ func (r *Router) RegisterRoutes() {
 	// KV存储路由
 	r.registerKVStoreRoutes()
 
-	// TODO: 实现配置管理路由
-	r.engine.GET("/api/config", r.handleGetConfig)
-	r.engine.PUT("/api/config", r.handleUpdateConfig)
+	// 配置查询，配置在启动时加载，修改后需要重启节点
+	configHandler := handler.NewConfigHandler()
+	r.engine.GET("/api/config", configHandler.HandleGetConfig)
 
-	// TODO: 实现集群管理路由
-	r.engine.POST("/api/cluster/join", r.handleJoinCluster)
-	r.engine.POST("/api/cluster/leave", r.handleLeaveCluster)
+	// 集群成员管理，成员变更尚未实现，请求返回 501
+	clusterHandler := handler.NewClusterHandler(r.shards)
+	r.engine.POST("/api/cluster/join", clusterHandler.HandleJoin)
+	r.engine.POST("/api/cluster/leave", clusterHandler.HandleLeave)
+
+	// 副本一致性审计，通过 foorpc 比较各节点的状态摘要
+	r.engine.GET("/api/cluster/audit", clusterHandler.HandleAudit)
+	// 各 Raft 组的状态和哈希槽分配
+	r.engine.GET("/api/cluster/status", clusterHandler.HandleClusterStatus)
+
+	// 哈希槽在 Raft 组之间的在线迁移，进度同时通过 WebSocket 推送
+	migrationHandler := handler.NewMigrationHandler(r.shards, r.wsManager)
+	migrationGroup := r.engine.Group("/api/cluster/migrations")
+	{
+		migrationGroup.GET("", migrationHandler.HandleList)
+		migrationGroup.POST("", migrationHandler.HandleMigrate)
+		migrationGroup.GET("/:id", migrationHandler.HandleGet)
+		// 中止尚未交接的迁移并恢复槽的写入
+		migrationGroup.POST("/:id/abort", migrationHandler.HandleAbort)
+	}
+	r.engine.POST("/api/cluster/rebalance", migrationHandler.HandleRebalance)
 
 }
 
@@ -83,8 +115,6 @@ func (r *Router) registerWebSocketRoutes() {
 	websocketHandler := handler.NewWebSocketHandler(r.wsManager)
 	websocketGroup := r.engine.Group("/ws")
 	{
-		// WebSocket基础路由
-		websocketGroup.GET("/", websocketHandler.Handle)
 		// WebSocket连接端点
 		websocketGroup.GET("/connect", websocketHandler.HandleConnection)
 		// 获取WebSocket统计信息
@@ -94,13 +124,84 @@ func (r *Router) registerWebSocketRoutes() {
 
 // registerKVStoreRoutes 注册KV存储相关路由
 func (r *Router) registerKVStoreRoutes() {
-	kvStoreHandler := handler.NewKVStoreHandler(r.store)
+	kvStoreHandler := handler.NewKVStoreHandler(r.shards)
+	watchHandler := handler.NewWatchHandler(r.shards, r.wsManager)
 	kvStoreGroup := r.engine.Group("/api/kv")
 	{
+		kvStoreGroup.GET("", kvStoreHandler.HandleList)
+		// 静态路径优先于 :key，名为 backup、export、watch 的键不能通过 GET 单独读取，可以用列表的 prefix 参数读取
 		kvStoreGroup.GET("/:key", kvStoreHandler.HandleGet)
 		kvStoreGroup.POST("", kvStoreHandler.HandleSet)
 		kvStoreGroup.DELETE("/:key", kvStoreHandler.HandleDelete)
+
+		// 条件写入
+		kvStoreGroup.POST("/:key/cas", kvStoreHandler.HandleCompareAndSwap)
+		kvStoreGroup.POST("/:key/setnx", kvStoreHandler.HandleSetIfAbsent)
+		kvStoreGroup.POST("/:key/cad", kvStoreHandler.HandleCompareAndDelete)
+
+		// 原子计数器
+		kvStoreGroup.POST("/:key/incr", kvStoreHandler.HandleIncrement)
+
+		// 多键事务
+		kvStoreGroup.POST("/txn", kvStoreHandler.HandleTxn)
+
+		// 批量写入
+		kvStoreGroup.POST("/batch", kvStoreHandler.HandleBatch)
+
+		// 备份与恢复
+		kvStoreGroup.GET("/backup", kvStoreHandler.HandleBackup)
+		kvStoreGroup.POST("/restore", kvStoreHandler.HandleRestore)
+
+		// 批量导入导出（JSONL / CSV）
+		kvStoreGroup.GET("/export", kvStoreHandler.HandleExport)
+		kvStoreGroup.POST("/import", kvStoreHandler.HandleImport)
+
+		// 历史版本
+		kvStoreGroup.GET("/:key/history", kvStoreHandler.HandleHistory)
+		kvStoreGroup.POST("/compact", kvStoreHandler.HandleCompact)
+
+		// 键变更监听（SSE），WebSocket 客户端通过 /ws/connect 发送 watch 消息
+		kvStoreGroup.GET("/watch", watchHandler.HandleSSE)
+	}
+
+	leaseHandler := handler.NewLeaseHandler(r.store)
+	leaseGroup := r.engine.Group("/api/lease")
+	{
+		leaseGroup.GET("", leaseHandler.HandleList)
+		leaseGroup.POST("/grant", leaseHandler.HandleGrant)
+		leaseGroup.GET("/:id", leaseHandler.HandleGet)
+		leaseGroup.POST("/:id/keepalive", leaseHandler.HandleKeepAlive)
+		leaseGroup.DELETE("/:id", leaseHandler.HandleRevoke)
+	}
+
+	// 分布式锁和选举，持有者的租约通过 /api/lease 续期
+	lockHandler := handler.NewLockHandler(r.store)
+	lockGroup := r.engine.Group("/api/lock")
+	{
+		lockGroup.POST("/:name", lockHandler.HandleLock)
+		lockGroup.DELETE("/:name", lockHandler.HandleUnlock)
 	}
+	electionGroup := r.engine.Group("/api/election")
+	{
+		electionGroup.POST("/:name/campaign", lockHandler.HandleCampaign)
+		electionGroup.POST("/:name/resign", lockHandler.HandleResign)
+		electionGroup.GET("/:name/leader", lockHandler.HandleLeader)
+	}
+
+	// 命名空间管理，KV 请求通过 X-Namespace 请求头选择命名空间
+	namespaceHandler := handler.NewNamespaceHandler(r.store)
+	namespaceGroup := r.engine.Group("/api/namespaces")
+	{
+		namespaceGroup.GET("", namespaceHandler.HandleList)
+		namespaceGroup.POST("", namespaceHandler.HandleCreate)
+		namespaceGroup.GET("/:name", namespaceHandler.HandleGet)
+		namespaceGroup.PUT("/:name/quota", namespaceHandler.HandleSetQuota)
+		namespaceGroup.DELETE("/:name", namespaceHandler.HandleDelete)
+	}
+
+	// 变更数据捕获，需要在本节点配置 cdc_dir，每个 Raft 组分别消费
+	cdcHandler := handler.NewCDCHandler(r.shards)
+	r.engine.GET("/api/cdc", cdcHandler.HandleStream)
 }
 
 // Run 启动HTTP服务器
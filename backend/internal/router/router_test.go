@@ -0,0 +1,268 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"gotoraft/internal/kvstore/store"
+	"gotoraft/internal/websocket"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter 启动单节点的 groups 个 Raft 组，等待各组选出 Leader 后注册所有路由
+func newTestRouter(t *testing.T, groups int) (*Router, *store.Shards) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	sh, err := store.NewShards(store.NewStore(t.TempDir(), "127.0.0.1:0", true), store.ShardConfig{Groups: groups, Slots: 16})
+	if err != nil {
+		t.Fatalf("new shards: %v", err)
+	}
+	if err := sh.Open(true, "node0"); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { sh.Shutdown() })
+	deadline := time.Now().Add(5 * time.Second)
+	for _, g := range sh.Groups() {
+		for !g.IsLeader() {
+			if time.Now().After(deadline) {
+				t.Fatalf("groups did not elect leaders")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	ws := websocket.NewManager(websocket.Config{MaxConnections: 10, HeartbeatTimeout: time.Minute})
+	r := NewRouter(ws, sh, nil)
+	r.RegisterRoutes()
+	return r, sh
+}
+
+// response 是 API 的响应体
+type response struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do 发送请求并返回状态码、响应头和原始响应体
+func do(t *testing.T, r *Router, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.engine.ServeHTTP(w, req)
+	return w
+}
+
+// decode 解析响应体，状态码不是 want 时失败
+func decode(t *testing.T, w *httptest.ResponseRecorder, want int) response {
+	t.Helper()
+	var res response
+	if w.Code != want {
+		t.Fatalf("status %d, want %d: %s", w.Code, want, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return res
+}
+
+func TestRouter_KeysNamedLikeEndpoints(t *testing.T) {
+	r, _ := newTestRouter(t, 1)
+
+	// 只有 POST 的端点不影响同名键的读取
+	for _, key := range []string{"restore", "import", "txn", "batch", "compact"} {
+		decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"`+key+`","value":""}`, nil), http.StatusOK)
+		res := decode(t, do(t, r, http.MethodGet, "/api/kv/"+key, "", nil), http.StatusOK)
+		var data struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(res.Data, &data); err != nil || data.Key != key || data.Value != "" {
+			t.Fatalf("get %q: %s", key, res.Data)
+		}
+		decode(t, do(t, r, http.MethodDelete, "/api/kv/"+key, "", nil), http.StatusOK)
+	}
+
+	// GET 端点同名的键可以写入和删除，读取时用列表的 prefix 参数
+	for _, key := range []string{"backup", "export", "watch"} {
+		decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"`+key+`","value":"v"}`, nil), http.StatusOK)
+		res := decode(t, do(t, r, http.MethodGet, "/api/kv?keysOnly=true&prefix="+key, "", nil), http.StatusOK)
+		if !strings.Contains(string(res.Data), `"keys":["`+key+`"]`) {
+			t.Fatalf("list %q: %s", key, res.Data)
+		}
+		decode(t, do(t, r, http.MethodDelete, "/api/kv/"+key, "", nil), http.StatusOK)
+	}
+
+	// 缺少 value 仍然是无效请求
+	decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"k"}`, nil), http.StatusBadRequest)
+
+	if w := do(t, r, http.MethodGet, "/api/kv/backup", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("backup: %d %s", w.Code, w.Body.String())
+	}
+	decode(t, do(t, r, http.MethodPost, "/api/kv/txn", `{"success":[{"type":"put","key":"a","value":"1"}]}`, nil), http.StatusOK)
+	decode(t, do(t, r, http.MethodPost, "/api/kv/batch", `{"ops":[{"type":"put","key":"b","value":"2"}]}`, nil), http.StatusOK)
+}
+
+func TestRouter_RetryReturnsOriginalResult(t *testing.T) {
+	r, _ := newTestRouter(t, 1)
+	seq := func(n string) map[string]string {
+		return map[string]string{"X-Client-ID": "c1", "X-Client-Seq": n}
+	}
+	var first, retry struct {
+		Value    string `json:"value"`
+		Revision uint64 `json:"revision"`
+	}
+
+	res := decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"k","value":"z"}`, seq("1")), http.StatusOK)
+	json.Unmarshal(res.Data, &first)
+	// 以相同序号重试但请求体不同，返回的是第一次写入的结果
+	res = decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"k","value":"zz"}`, seq("1")), http.StatusOK)
+	json.Unmarshal(res.Data, &retry)
+	if retry != first || retry.Value != "z" {
+		t.Fatalf("retried set: got %+v, want %+v", retry, first)
+	}
+	res = decode(t, do(t, r, http.MethodGet, "/api/kv/k", "", nil), http.StatusOK)
+	if !strings.Contains(string(res.Data), `"value":"z"`) {
+		t.Fatalf("value after retried set: %s", res.Data)
+	}
+
+	var del struct {
+		Deleted bool            `json:"deleted"`
+		PrevKV  *store.KeyValue `json:"prevKv"`
+	}
+	res = decode(t, do(t, r, http.MethodDelete, "/api/kv/k", "", seq("2")), http.StatusOK)
+	json.Unmarshal(res.Data, &del)
+	if !del.Deleted || del.PrevKV == nil || del.PrevKV.Value != "z" {
+		t.Fatalf("delete: %s", res.Data)
+	}
+	res = decode(t, do(t, r, http.MethodDelete, "/api/kv/k", "", seq("2")), http.StatusOK)
+	del.PrevKV = nil
+	json.Unmarshal(res.Data, &del)
+	if !del.Deleted || del.PrevKV == nil || del.PrevKV.Value != "z" {
+		t.Fatalf("retried delete: %s", res.Data)
+	}
+	res = decode(t, do(t, r, http.MethodDelete, "/api/kv/k", "", seq("3")), http.StatusOK)
+	if !strings.Contains(string(res.Data), `"deleted":false`) {
+		t.Fatalf("delete of a missing key: %s", res.Data)
+	}
+}
+
+func TestRouter_WholeKeyspaceAcrossGroups(t *testing.T) {
+	r, sh := newTestRouter(t, 2)
+
+	var body strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&body, `{"key":"k%d","value":"v%d"}`+"\n", i, i)
+	}
+	w := do(t, r, http.MethodPost, "/api/kv/import?batchSize=3", body.String(), nil)
+	decode(t, w, http.StatusOK)
+	groups := map[int]bool{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("k%d", i)
+		groups[sh.GroupOf(key)] = true
+		res := decode(t, do(t, r, http.MethodGet, "/api/kv/"+key, "", nil), http.StatusOK)
+		if !strings.Contains(string(res.Data), fmt.Sprintf(`"value":"v%d"`, i)) {
+			t.Fatalf("get %s: %s", key, res.Data)
+		}
+	}
+	if len(groups) != 2 {
+		t.Fatalf("keys landed in groups %v", groups)
+	}
+
+	w = do(t, r, http.MethodGet, "/api/kv/export", "", nil)
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), "\n") != 10 {
+		t.Fatalf("export: %d %s", w.Code, w.Body.String())
+	}
+
+	// 只能作用于单个组的操作明确拒绝
+	decode(t, do(t, r, http.MethodGet, "/api/kv/backup", "", nil), http.StatusNotImplemented)
+	decode(t, do(t, r, http.MethodPost, "/api/kv/restore", "x", nil), http.StatusNotImplemented)
+	decode(t, do(t, r, http.MethodGet, "/api/cdc?follow=false", "", nil), http.StatusBadRequest)
+	decode(t, do(t, r, http.MethodGet, "/api/cdc?group=2", "", nil), http.StatusBadRequest)
+	decode(t, do(t, r, http.MethodGet, "/api/kv/watch?key=k&prefix=true&startRevision=1", "", nil), http.StatusBadRequest)
+}
+
+func TestRouter_AppliedIndexTokenCarriesGroup(t *testing.T) {
+	r, sh := newTestRouter(t, 2)
+	var keys [2]string
+	for i := 0; keys[0] == "" || keys[1] == ""; i++ {
+		key := fmt.Sprintf("k%d", i)
+		if g := sh.GroupOf(key); keys[g] == "" {
+			keys[g] = key
+		}
+	}
+	decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"`+keys[0]+`","value":"a"}`, nil), http.StatusOK)
+	// 让 1 号组的索引远超 0 号组
+	for i := 0; i < 20; i++ {
+		decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"`+keys[1]+`","value":"b"}`, nil), http.StatusOK)
+	}
+	w := do(t, r, http.MethodPost, "/api/kv", `{"key":"`+keys[1]+`","value":"c"}`, nil)
+	decode(t, w, http.StatusOK)
+	token := w.Header().Get("X-Raft-Index")
+	if !strings.HasPrefix(token, "1:") {
+		t.Fatalf("token %q does not name group 1", token)
+	}
+
+	// 1 号组的凭证不会让 0 号组的读取等待
+	start := time.Now()
+	decode(t, do(t, r, http.MethodGet, "/api/kv/"+keys[0], "", map[string]string{"X-Raft-Index": token}), http.StatusOK)
+	if time.Since(start) > time.Second {
+		t.Fatalf("read of group 0 waited for a group 1 token")
+	}
+	res := decode(t, do(t, r, http.MethodGet, "/api/kv/"+keys[1], "", map[string]string{"X-Raft-Index": token}), http.StatusOK)
+	if !strings.Contains(string(res.Data), `"value":"c"`) {
+		t.Fatalf("read your write: %s", res.Data)
+	}
+	decode(t, do(t, r, http.MethodGet, "/api/kv/"+keys[1], "", map[string]string{"X-Raft-Index": "12"}), http.StatusBadRequest)
+}
+
+func TestRouter_BackupIndexIsReadToken(t *testing.T) {
+	r, _ := newTestRouter(t, 1)
+
+	decode(t, do(t, r, http.MethodPost, "/api/kv", `{"key":"k","value":"v"}`, nil), http.StatusOK)
+	w := do(t, r, http.MethodGet, "/api/kv/backup", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("backup: %d %s", w.Code, w.Body.String())
+	}
+	token := w.Header().Get("X-Raft-Index")
+	if !strings.HasPrefix(token, "0:") {
+		t.Fatalf("backup token %q does not name group 0", token)
+	}
+	decode(t, do(t, r, http.MethodGet, "/api/kv/k", "", map[string]string{"X-Raft-Index": token}), http.StatusOK)
+}
+
+func TestRouter_AbortMigration(t *testing.T) {
+	r, sh := newTestRouter(t, 2)
+
+	decode(t, do(t, r, http.MethodPost, "/api/cluster/migrations/x/abort", "", nil), http.StatusBadRequest)
+	decode(t, do(t, r, http.MethodPost, "/api/cluster/migrations/12345/abort", "", nil), http.StatusNotFound)
+
+	m, err := sh.Migrate(sh.SlotOf("{s}"), 1-sh.GroupOf("{s}"))
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for cur, _ := sh.GetMigration(m.ID); cur.State != store.MigrationDone; cur, _ = sh.GetMigration(m.ID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("migration stuck in %s", cur.State)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// 已经结束的迁移不能中止
+	decode(t, do(t, r, http.MethodPost, fmt.Sprintf("/api/cluster/migrations/%d/abort", m.ID), "", nil), http.StatusBadRequest)
+}
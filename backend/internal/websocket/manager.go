@@ -17,6 +17,15 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// 写消息的超时时间
+const writeWait = 10 * time.Second
+
+// 管理器的错误
+var (
+	ErrClientNotFound = errors.New("websocket client not found")
+	ErrSendBufferFull = errors.New("websocket client send buffer is full")
+)
+
 // Client WebSocket 客户端
 type Client struct {
 	ID         string // 客户端ID
@@ -24,6 +33,20 @@ type Client struct {
 	SendChan   chan []byte
 	CloseChan  chan struct{}
 	LastActive time.Time
+
+	closeOnce sync.Once
+}
+
+// MessageHandler 处理客户端发来的消息
+type MessageHandler func(clientID string, message []byte)
+
+// CloseHandler 在客户端断开后调用，用于清理与该客户端相关的资源
+type CloseHandler func(clientID string)
+
+// ConnectionStats 连接统计信息
+type ConnectionStats struct {
+	ActiveConnections int    `json:"activeConnections"`
+	Status            string `json:"status"`
 }
 
 // Manager websocket 管理器
@@ -33,6 +56,10 @@ type Manager struct {
 	clients        map[string]*Client
 	maxConnections int
 	config         Config
+
+	handlersMu sync.RWMutex
+	onMessage  MessageHandler
+	onClose    CloseHandler
 }
 
 // Config WebSocket 配置
@@ -61,14 +88,18 @@ func NewManager(config Config) *Manager {
 	}
 }
 
-// Register 注册新的WebSocket连接
-func (m *Manager) Register(conn *websocket.Conn) {
-	m.clientsMu.Lock()
-	defer m.clientsMu.Unlock()
-	m.clients[conn.RemoteAddr().String()] = true // 使用地址字符串作为键
-	logger.Info("新的WebSocket连接注册成功",
-		"remoteAddr", conn.RemoteAddr().String(),
-	)
+// SetMessageHandler 设置客户端消息的处理函数
+func (m *Manager) SetMessageHandler(h MessageHandler) {
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+	m.onMessage = h
+}
+
+// SetCloseHandler 设置客户端断开时的处理函数
+func (m *Manager) SetCloseHandler(h CloseHandler) {
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+	m.onClose = h
 }
 
 // RegisterClient 注册客户端时生成唯一ID
@@ -95,14 +126,76 @@ func (m *Manager) RegisterClient(conn *websocket.Conn) (string, error) {
 	return clientID, nil
 }
 
-// Unregister 注销WebSocket连接
-func (m *Manager) Unregister(conn *websocket.Conn) {
+// UnregisterClient 注销客户端并关闭连接
+func (m *Manager) UnregisterClient(clientID string) {
 	m.clientsMu.Lock()
-	defer m.clientsMu.Unlock()
-	delete(m.clients, conn.RemoteAddr().String()) // 使用地址字符串作为键
-	logger.Info("WebSocket连接注销成功",
-		"remoteAddr", conn.RemoteAddr().String(),
-	)
+	client, ok := m.clients[clientID]
+	delete(m.clients, clientID)
+	m.clientsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	client.closeOnce.Do(func() {
+		close(client.CloseChan)
+		client.Conn.Close()
+	})
+
+	m.handlersMu.RLock()
+	onClose := m.onClose
+	m.handlersMu.RUnlock()
+	if onClose != nil {
+		onClose(clientID)
+	}
+	logger.Infof("WebSocket连接注销成功: %s", clientID)
+}
+
+// handleClient 启动客户端的读写循环，读循环退出时注销客户端
+func (m *Manager) handleClient(client *Client) {
+	go m.writeLoop(client)
+	defer m.UnregisterClient(client.ID)
+
+	client.Conn.SetPongHandler(func(string) error {
+		m.touch(client)
+		return nil
+	})
+	for {
+		_, message, err := client.Conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		m.touch(client)
+
+		m.handlersMu.RLock()
+		onMessage := m.onMessage
+		m.handlersMu.RUnlock()
+		if onMessage != nil {
+			onMessage(client.ID, message)
+		}
+	}
+}
+
+// writeLoop 是唯一向连接写数据消息的协程
+func (m *Manager) writeLoop(client *Client) {
+	for {
+		select {
+		case message := <-client.SendChan:
+			client.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				logger.Errorf("websocket 发送消息失败: %v", err)
+				m.UnregisterClient(client.ID)
+				return
+			}
+		case <-client.CloseChan:
+			return
+		}
+	}
+}
+
+func (m *Manager) touch(client *Client) {
+	m.clientsMu.Lock()
+	client.LastActive = time.Now()
+	m.clientsMu.Unlock()
 }
 
 // GetConnectionStats 获取连接统计信息
@@ -117,37 +210,56 @@ func (m *Manager) GetConnectionStats() ConnectionStats {
 	}
 }
 
+// Send 发送消息给指定客户端，不会阻塞
+func (m *Manager) Send(clientID string, message []byte) error {
+	m.clientsMu.RLock()
+	client, ok := m.clients[clientID]
+	m.clientsMu.RUnlock()
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	select {
+	case client.SendChan <- message:
+		return nil
+	case <-client.CloseChan:
+		return ErrClientNotFound
+	default:
+		return ErrSendBufferFull
+	}
+}
+
+// SendJSON 发送JSON消息给指定客户端
+func (m *Manager) SendJSON(clientID string, data interface{}) error {
+	message, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return m.Send(clientID, message)
+}
+
 // Broadcast 广播消息给所有连接的客户端
 func (m *Manager) Broadcast(message []byte) {
 	m.clientsMu.RLock()
 	defer m.clientsMu.RUnlock()
 
-	for client := range m.clients {
-		err := client.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			logger.Errorf("websocket 广播消息失败: %v", err)
-			continue
+	for _, client := range m.clients {
+		select {
+		case client.SendChan <- message:
+		default:
+			logger.Errorf("websocket 广播消息失败: 客户端 %s 发送缓冲区已满", client.ID)
 		}
 	}
 }
 
 // BroadcastJSON 广播JSON消息给所有连接的客户端
 func (m *Manager) BroadcastJSON(data interface{}) {
-	_, err := json.Marshal(data) // 验证数据可以被序列化
+	message, err := json.Marshal(data)
 	if err != nil {
 		logger.Errorf("websocket JSON序列化失败: %v", err)
 		return
 	}
-
-	m.clientsMu.RLock()
-	defer m.clientsMu.RUnlock()
-
-	for client := range m.clients {
-		if err := client.WriteJSON(data); err != nil {
-			logger.Errorf("websocket 广播JSON消息失败: %v", err)
-			continue
-		}
-	}
+	m.Broadcast(message)
 }
 
 func (m *Manager) StartHeartbeat() {
@@ -155,10 +267,11 @@ func (m *Manager) StartHeartbeat() {
 	defer ticker.Stop()
 
 	for range ticker.C {
+		var stale []string
 		m.clientsMu.RLock()
 		for _, client := range m.clients {
 			if time.Since(client.LastActive) > m.config.HeartbeatTimeout {
-				m.UnregisterClient(client.ID)
+				stale = append(stale, client.ID)
 				continue
 			}
 
@@ -168,9 +281,27 @@ func (m *Manager) StartHeartbeat() {
 				[]byte{},
 				time.Now().Add(time.Second),
 			); err != nil {
-				m.UnregisterClient(client.ID)
+				stale = append(stale, client.ID)
 			}
 		}
 		m.clientsMu.RUnlock()
+
+		for _, id := range stale {
+			m.UnregisterClient(id)
+		}
+	}
+}
+
+// Shutdown 关闭所有连接
+func (m *Manager) Shutdown() {
+	m.clientsMu.RLock()
+	ids := make([]string, 0, len(m.clients))
+	for id := range m.clients {
+		ids = append(ids, id)
+	}
+	m.clientsMu.RUnlock()
+
+	for _, id := range ids {
+		m.UnregisterClient(id)
 	}
 }
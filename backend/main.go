@@ -2,10 +2,17 @@ package main
 
 import (
 	"gotoraft/cmd/bootstrap"
+	"gotoraft/cmd/kvtool"
 	"gotoraft/pkg/logger"
+	"os"
 )
 
 func main() {
+	// 导入导出等子命令作为客户端访问运行中的节点
+	if len(os.Args) > 1 && kvtool.IsCommand(os.Args[1]) {
+		os.Exit(kvtool.Run(os.Args[1:]))
+	}
+
 	// 初始化各个组件
 	app := bootstrap.NewApp()
 	if err := app.Init(); err != nil {
@@ -0,0 +1,260 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memKV 是内存中的 KV 实现，修订号随每次写入递增
+type memKV struct {
+	mu      sync.Mutex
+	rev     uint64
+	kvs     map[string]KeyValue
+	leases  map[int64]bool
+	changed chan struct{} // 每次写入后关闭并替换
+	history []KeyValue    // 每次变更的键及修订号，删除时 CreateRevision 为 0
+}
+
+func newMemKV() *memKV {
+	return &memKV{
+		kvs:     make(map[string]KeyValue),
+		leases:  make(map[int64]bool),
+		changed: make(chan struct{}),
+	}
+}
+
+func (m *memKV) commit(kv KeyValue) {
+	m.history = append(m.history, kv)
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *memKV) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rev++
+	m.leases[int64(m.rev)] = true
+	return int64(m.rev), nil
+}
+
+func (m *memKV) KeepAlive(ctx context.Context, lease int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.leases[lease] {
+		return errors.New("lease not found")
+	}
+	return nil
+}
+
+func (m *memKV) Revoke(ctx context.Context, lease int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.leases[lease] {
+		return errors.New("lease not found")
+	}
+	delete(m.leases, lease)
+	m.rev++
+	for key, kv := range m.kvs {
+		if kv.Lease == lease {
+			delete(m.kvs, key)
+			m.commit(KeyValue{Key: key, ModRevision: m.rev})
+		}
+	}
+	return nil
+}
+
+func (m *memKV) Create(ctx context.Context, key, value string, lease int64) (KeyValue, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if kv, ok := m.kvs[key]; ok {
+		return kv, false, nil
+	}
+	if lease != 0 && !m.leases[lease] {
+		return KeyValue{}, false, errors.New("lease not found")
+	}
+	m.rev++
+	kv := KeyValue{Key: key, Value: value, CreateRevision: m.rev, ModRevision: m.rev, Lease: lease}
+	m.kvs[key] = kv
+	m.commit(kv)
+	return kv, true, nil
+}
+
+func (m *memKV) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.kvs[key]; !ok {
+		return nil
+	}
+	m.rev++
+	delete(m.kvs, key)
+	m.commit(KeyValue{Key: key, ModRevision: m.rev})
+	return nil
+}
+
+func (m *memKV) List(ctx context.Context, prefix string) ([]KeyValue, uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []KeyValue
+	for key, kv := range m.kvs {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, kv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, m.rev, nil
+}
+
+func (m *memKV) Wait(ctx context.Context, key string, prefix bool, rev uint64) error {
+	for {
+		m.mu.Lock()
+		for _, kv := range m.history {
+			if kv.ModRevision <= rev {
+				continue
+			}
+			if kv.Key == key || (prefix && strings.HasPrefix(kv.Key, key)) {
+				m.mu.Unlock()
+				return nil
+			}
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func newTestSession(t *testing.T, kv KV) *Session {
+	t.Helper()
+	s, err := NewSession(kv, time.Minute)
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestMutex_SerializesHolders(t *testing.T) {
+	kv := newMemKV()
+	s1, s2 := newTestSession(t, kv), newTestSession(t, kv)
+	m1, m2 := NewMutex(s1, "locks/job"), NewMutex(s2, "locks/job")
+	ctx := context.Background()
+
+	if err := m1.Lock(ctx); err != nil {
+		t.Fatalf("lock m1: %v", err)
+	}
+	if err := m2.TryLock(ctx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("trylock while held: got %v, want %v", err, ErrLocked)
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- m2.Lock(ctx) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("m2 acquired while m1 holds the lock: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first := m1.Token()
+	if err := m1.Unlock(ctx); err != nil {
+		t.Fatalf("unlock m1: %v", err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("lock m2: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("m2 did not acquire the lock after unlock")
+	}
+	if m2.Token() <= first {
+		t.Fatalf("fencing token should increase: %d then %d", first, m2.Token())
+	}
+}
+
+func TestMutex_ReleasedWhenSessionEnds(t *testing.T) {
+	kv := newMemKV()
+	s1, s2 := newTestSession(t, kv), newTestSession(t, kv)
+	ctx := context.Background()
+
+	if err := NewMutex(s1, "locks/job").Lock(ctx); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	acquired := make(chan error, 1)
+	go func() { acquired <- NewMutex(s2, "locks/job").Lock(ctx) }()
+
+	// 持有者的租约被撤销，相当于进程崩溃后租约过期
+	s1.Close()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("lock after holder session closed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("lock was not released with the holder session")
+	}
+}
+
+func TestMutex_LockCanceled(t *testing.T) {
+	kv := newMemKV()
+	s1, s2 := newTestSession(t, kv), newTestSession(t, kv)
+
+	if err := NewMutex(s1, "locks/job").Lock(context.Background()); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := NewMutex(s2, "locks/job").Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock with timeout: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	// 放弃排队后不应留下等待的键
+	if kvs, _, _ := kv.List(context.Background(), "locks/job/"); len(kvs) != 1 {
+		t.Fatalf("waiter key should be removed, got %+v", kvs)
+	}
+}
+
+func TestElection_CampaignResignObserve(t *testing.T) {
+	kv := newMemKV()
+	s1, s2 := newTestSession(t, kv), newTestSession(t, kv)
+	e1, e2 := NewElection(s1, "elections/svc"), NewElection(s2, "elections/svc")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := e1.Leader(ctx); !errors.Is(err, ErrNoLeader) {
+		t.Fatalf("leader before campaign: got %v, want %v", err, ErrNoLeader)
+	}
+	observed := e2.Observe(ctx)
+
+	if err := e1.Campaign(ctx, "node-1"); err != nil {
+		t.Fatalf("campaign e1: %v", err)
+	}
+	if info := <-observed; info.Value != "node-1" || info.Token != e1.Token() {
+		t.Fatalf("observed leader: %+v", info)
+	}
+
+	elected := make(chan error, 1)
+	go func() { elected <- e2.Campaign(ctx, "node-2") }()
+	if err := e1.Resign(ctx); err != nil {
+		t.Fatalf("resign: %v", err)
+	}
+	if err := <-elected; err != nil {
+		t.Fatalf("campaign e2: %v", err)
+	}
+	if info := <-observed; info.Value != "node-2" {
+		t.Fatalf("observed leader after resign: %+v", info)
+	}
+
+	leader, err := e1.Leader(ctx)
+	if err != nil || leader.Key != e2.Key() {
+		t.Fatalf("leader: %+v, %v", leader, err)
+	}
+}
@@ -0,0 +1,124 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoLeader 当前没有 Leader
+var ErrNoLeader = errors.New("concurrency: election has no leader")
+
+// observeRetryInterval Observe 读取失败后重试的间隔
+const observeRetryInterval = time.Second
+
+// LeaderInfo 描述一次选举的 Leader
+type LeaderInfo struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Lease int64  `json:"lease"`
+	Token uint64 `json:"token"` // Leader 键的创建修订号，任期之间单调递增
+}
+
+// Election 是基于 KV 存储的 Leader 选举
+type Election struct {
+	s     *Session
+	pfx   string
+	key   string
+	token uint64
+}
+
+// NewElection 创建前缀为 pfx 的选举
+func NewElection(s *Session, pfx string) *Election {
+	return &Election{s: s, pfx: pfx, key: queueKey(pfx, s.Lease())}
+}
+
+// Campaign 以 value 参选并阻塞直到当选，ctx 取消或会话过期时退出选举
+func (e *Election) Campaign(ctx context.Context, value string) error {
+	kv, err := acquire(ctx, e.s, e.pfx, value)
+	if err != nil {
+		return err
+	}
+	e.token = kv.CreateRevision
+	return nil
+}
+
+// Resign 放弃领导权或退出选举，下一个候选者随之当选
+func (e *Election) Resign(ctx context.Context) error {
+	if err := e.s.kv.Delete(ctx, e.key); err != nil {
+		return err
+	}
+	e.token = 0
+	return nil
+}
+
+// Leader 返回当前的 Leader，没有 Leader 时返回 ErrNoLeader
+func (e *Election) Leader(ctx context.Context) (LeaderInfo, error) {
+	info, _, err := e.leader(ctx)
+	return info, err
+}
+
+func (e *Election) leader(ctx context.Context) (LeaderInfo, uint64, error) {
+	kvs, rev, err := e.s.kv.List(ctx, e.pfx+"/")
+	if err != nil {
+		return LeaderInfo{}, 0, err
+	}
+	first, _, _ := head(kvs, "")
+	if first == nil {
+		return LeaderInfo{}, rev, ErrNoLeader
+	}
+	return LeaderInfo{
+		Key:   first.Key,
+		Value: first.Value,
+		Lease: first.Lease,
+		Token: first.CreateRevision,
+	}, rev, nil
+}
+
+// Observe 推送 Leader 的变化，ctx 取消后通道被关闭
+func (e *Election) Observe(ctx context.Context) <-chan LeaderInfo {
+	ch := make(chan LeaderInfo)
+	go func() {
+		defer close(ch)
+		var last LeaderInfo
+		for {
+			info, rev, err := e.leader(ctx)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case err != nil && !errors.Is(err, ErrNoLeader):
+				select {
+				case <-time.After(observeRetryInterval):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			case err == nil && info != last:
+				select {
+				case ch <- info:
+					last = info
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err := e.s.kv.Wait(ctx, e.pfx+"/", true, rev); err != nil {
+				select {
+				case <-time.After(observeRetryInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// Key 返回本次参选在存储中的键
+func (e *Election) Key() string {
+	return e.key
+}
+
+// Token 返回当选时的 fencing token，未当选时为 0
+func (e *Election) Token() uint64 {
+	return e.token
+}
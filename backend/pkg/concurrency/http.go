@@ -0,0 +1,242 @@
+package concurrency
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError 是 KV HTTP API 返回的错误
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("concurrency: http %d: %s", e.StatusCode, e.Message)
+}
+
+// HTTPClient 通过 gotoraft 的 KV HTTP API 实现 KV
+// 写请求需要发往 Leader，非 Leader 节点返回 503
+type HTTPClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPClient 创建访问 endpoint（例如 http://127.0.0.1:8080）的客户端
+func NewHTTPClient(endpoint string) *HTTPClient {
+	return &HTTPClient{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		client:   &http.Client{},
+	}
+}
+
+// response 是 API 的统一响应格式
+type response struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// do 发送请求并将成功响应的 data 解析到 out
+func (c *HTTPClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return &APIError{StatusCode: resp.StatusCode, Message: "invalid response: " + err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{StatusCode: resp.StatusCode, Message: res.Message}
+	}
+	if out == nil || len(res.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(res.Data, out)
+}
+
+// Grant 实现 KV，租约 TTL 按秒向上取整
+func (c *HTTPClient) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	secs := int64((ttl + time.Second - 1) / time.Second)
+	var lease struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/lease/grant", map[string]int64{"ttl": secs}, &lease); err != nil {
+		return 0, err
+	}
+	return lease.ID, nil
+}
+
+// KeepAlive 实现 KV
+func (c *HTTPClient) KeepAlive(ctx context.Context, lease int64) error {
+	return c.do(ctx, http.MethodPost, "/api/lease/"+strconv.FormatInt(lease, 10)+"/keepalive", nil, nil)
+}
+
+// Revoke 实现 KV
+func (c *HTTPClient) Revoke(ctx context.Context, lease int64) error {
+	return c.do(ctx, http.MethodDelete, "/api/lease/"+strconv.FormatInt(lease, 10), nil, nil)
+}
+
+// txnOp 与 txnCompare 对应服务端事务的请求格式
+type txnOp struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Lease int64  `json:"lease,omitempty"`
+}
+
+type txnCompare struct {
+	Key      string `json:"key"`
+	Target   string `json:"target"`
+	Result   string `json:"result"`
+	Revision uint64 `json:"revision"`
+}
+
+type txnRequest struct {
+	Compare []txnCompare `json:"compare,omitempty"`
+	Success []txnOp      `json:"success,omitempty"`
+	Failure []txnOp      `json:"failure,omitempty"`
+}
+
+type txnResult struct {
+	Succeeded bool `json:"succeeded"`
+	Results   []struct {
+		KV *KeyValue `json:"kv"`
+	} `json:"results"`
+}
+
+// Create 实现 KV，用一个事务完成“不存在则写入，否则读取”
+// 键中可以包含 /，因此不使用以键为路径参数的接口
+func (c *HTTPClient) Create(ctx context.Context, key, value string, lease int64) (KeyValue, bool, error) {
+	req := txnRequest{
+		Compare: []txnCompare{{Key: key, Target: "create", Result: "=", Revision: 0}},
+		Success: []txnOp{{Type: "put", Key: key, Value: value, Lease: lease}},
+		Failure: []txnOp{{Type: "get", Key: key}},
+	}
+	var res txnResult
+	if err := c.do(ctx, http.MethodPost, "/api/kv/txn", req, &res); err != nil {
+		return KeyValue{}, false, err
+	}
+	if len(res.Results) == 0 || res.Results[0].KV == nil {
+		// 比较与读取之间键不会变化，这里只可能是服务端返回了意外的结果
+		return KeyValue{}, false, fmt.Errorf("concurrency: unexpected txn result for %q", key)
+	}
+	return *res.Results[0].KV, res.Succeeded, nil
+}
+
+// Delete 实现 KV
+func (c *HTTPClient) Delete(ctx context.Context, key string) error {
+	req := txnRequest{Success: []txnOp{{Type: "delete", Key: key}}}
+	return c.do(ctx, http.MethodPost, "/api/kv/txn", req, nil)
+}
+
+// List 实现 KV，按页读取直到结束，所有页都在第一页的修订号上读取
+func (c *HTTPClient) List(ctx context.Context, prefix string) ([]KeyValue, uint64, error) {
+	var (
+		kvs    []KeyValue
+		rev    uint64
+		cursor string
+	)
+	for {
+		q := url.Values{}
+		q.Set("prefix", prefix)
+		q.Set("limit", "1000")
+		if rev == 0 {
+			q.Set("level", "linearizable")
+		} else {
+			q.Set("revision", strconv.FormatUint(rev, 10))
+		}
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+
+		var page struct {
+			KVs        []KeyValue `json:"kvs"`
+			More       bool       `json:"more"`
+			NextCursor string     `json:"nextCursor"`
+			Revision   uint64     `json:"revision"`
+		}
+		if err := c.do(ctx, http.MethodGet, "/api/kv?"+q.Encode(), nil, &page); err != nil {
+			return nil, 0, err
+		}
+		kvs = append(kvs, page.KVs...)
+		rev = page.Revision
+		if !page.More {
+			return kvs, rev, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// Wait 实现 KV，通过 Server-Sent Events 等待第一个事件
+func (c *HTTPClient) Wait(ctx context.Context, key string, prefix bool, rev uint64) error {
+	q := url.Values{}
+	q.Set("key", key)
+	q.Set("prefix", strconv.FormatBool(prefix))
+	q.Set("startRevision", strconv.FormatUint(rev+1, 10))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/api/kv/watch?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		// 历史已被压缩，由调用方重新读取
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		var res response
+		json.NewDecoder(resp.Body).Decode(&res)
+		return &APIError{StatusCode: resp.StatusCode, Message: res.Message}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		// 任意事件（包括 watcher 被关闭的 error 事件）都意味着调用方需要重新读取
+		if strings.HasPrefix(scanner.Text(), "data:") {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+var _ KV = (*HTTPClient)(nil)
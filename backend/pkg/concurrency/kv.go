@@ -0,0 +1,42 @@
+// Package concurrency 在 gotoraft KV 存储之上实现分布式锁和 Leader 选举
+//
+// 锁和选举都基于同一个排队模型：每个参与者以自己租约的 ID 在前缀下创建一个键，
+// 创建修订号（即写入该键的 Raft 日志索引）最小的参与者持有锁或成为 Leader，
+// 其余参与者等待排在自己前面的键被删除。持有者的创建修订号可以作为 fencing token，
+// 它随获得锁的顺序单调递增，下游服务拒绝比已见过的更小的 token 即可屏蔽过期的持有者。
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// KeyValue 是锁和选举关心的键的状态
+type KeyValue struct {
+	Key            string `json:"key"`
+	Value          string `json:"value"`
+	CreateRevision uint64 `json:"createRevision"`
+	ModRevision    uint64 `json:"modRevision"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+// KV 是锁和选举依赖的最小 KV 操作集合
+// HTTPClient 通过 KV HTTP API 实现它，服务端也可以直接基于本地存储实现
+type KV interface {
+	// Grant 授予一个新租约并返回其 ID
+	Grant(ctx context.Context, ttl time.Duration) (int64, error)
+	// KeepAlive 续期租约
+	KeepAlive(ctx context.Context, lease int64) error
+	// Revoke 撤销租约，绑定的键会被删除
+	Revoke(ctx context.Context, lease int64) error
+
+	// Create 仅当键不存在时写入并绑定租约，返回键的当前状态以及是否由本次调用创建
+	Create(ctx context.Context, key, value string, lease int64) (KeyValue, bool, error)
+	// Delete 删除键，键不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 线性一致地读取以 prefix 开头的所有键（按键排序）以及读取时的修订号
+	List(ctx context.Context, prefix string) ([]KeyValue, uint64, error)
+	// Wait 阻塞直到键（prefix 为 true 时为前缀）在修订号 rev 之后发生变更
+	// 无法确定是否发生变更（例如历史已被压缩）时也会返回，调用方应重新读取
+	Wait(ctx context.Context, key string, prefix bool, rev uint64) error
+}
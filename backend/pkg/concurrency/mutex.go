@@ -0,0 +1,73 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLocked TryLock 时锁已被其他会话持有
+var ErrLocked = errors.New("concurrency: mutex is locked by another session")
+
+// Mutex 是基于 KV 存储的分布式互斥锁
+// 同一个 Session 上的 Mutex 不可重入，也不应被多个协程同时使用
+type Mutex struct {
+	s     *Session
+	pfx   string
+	key   string
+	token uint64
+}
+
+// NewMutex 创建前缀为 pfx 的锁，使用同一前缀的 Mutex 互斥
+func NewMutex(s *Session, pfx string) *Mutex {
+	return &Mutex{s: s, pfx: pfx, key: queueKey(pfx, s.Lease())}
+}
+
+// Lock 阻塞直到获得锁，ctx 取消或会话过期时放弃排队
+func (m *Mutex) Lock(ctx context.Context) error {
+	kv, err := acquire(ctx, m.s, m.pfx, "")
+	if err != nil {
+		return err
+	}
+	m.token = kv.CreateRevision
+	return nil
+}
+
+// TryLock 尝试获得锁，锁已被持有时立即返回 ErrLocked
+func (m *Mutex) TryLock(ctx context.Context) error {
+	kv, err := enqueue(ctx, m.s, m.pfx, "")
+	if err != nil {
+		return err
+	}
+	kvs, _, err := m.s.kv.List(ctx, m.pfx+"/")
+	if err != nil {
+		return err
+	}
+	if first, _, _ := head(kvs, m.key); first != nil && first.Key == m.key {
+		m.token = kv.CreateRevision
+		return nil
+	}
+	if err := m.s.kv.Delete(ctx, m.key); err != nil {
+		return err
+	}
+	return ErrLocked
+}
+
+// Unlock 释放锁
+func (m *Mutex) Unlock(ctx context.Context) error {
+	if err := m.s.kv.Delete(ctx, m.key); err != nil {
+		return err
+	}
+	m.token = 0
+	return nil
+}
+
+// Key 返回锁在存储中的键
+func (m *Mutex) Key() string {
+	return m.key
+}
+
+// Token 返回本次持有锁的 fencing token，即锁键被创建时的 Raft 日志索引
+// 未持有锁时为 0
+func (m *Mutex) Token() uint64 {
+	return m.token
+}
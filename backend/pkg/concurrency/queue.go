@@ -0,0 +1,102 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 放弃排队时删除自己键的超时时间
+const cleanupTimeout = 5 * time.Second
+
+// queueKey 返回会话在前缀下排队的键
+func queueKey(pfx string, lease int64) string {
+	return fmt.Sprintf("%s/%016x", pfx, lease)
+}
+
+// enqueue 以会话的租约在前缀下创建排队的键，已存在时沿用
+func enqueue(ctx context.Context, s *Session, pfx, value string) (KeyValue, error) {
+	kv, _, err := s.kv.Create(ctx, queueKey(pfx, s.lease), value, s.lease)
+	return kv, err
+}
+
+// head 返回队首以及 key 前面的一个键，key 不在队列中时 self 为 nil
+func head(kvs []KeyValue, key string) (first, self, pred *KeyValue) {
+	for i := range kvs {
+		kv := &kvs[i]
+		if first == nil || kv.CreateRevision < first.CreateRevision {
+			first = kv
+		}
+		if kv.Key == key {
+			self = kv
+		}
+	}
+	if self == nil {
+		return first, nil, nil
+	}
+	for i := range kvs {
+		kv := &kvs[i]
+		if kv.CreateRevision < self.CreateRevision && (pred == nil || kv.CreateRevision > pred.CreateRevision) {
+			pred = kv
+		}
+	}
+	return first, self, pred
+}
+
+// acquire 排队并等待成为队首，失败时删除自己的键
+// 返回的键的创建修订号即 fencing token
+func acquire(ctx context.Context, s *Session, pfx, value string) (KeyValue, error) {
+	kv, err := enqueue(ctx, s, pfx, value)
+	if err != nil {
+		return KeyValue{}, err
+	}
+
+	kv, err = waitHead(ctx, s, pfx, kv.Key)
+	if err != nil {
+		cctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		s.kv.Delete(cctx, queueKey(pfx, s.lease))
+		return KeyValue{}, err
+	}
+	return kv, nil
+}
+
+// waitHead 等待前面的键依次被删除，直到 key 成为队首
+func waitHead(ctx context.Context, s *Session, pfx, key string) (KeyValue, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		kvs, rev, err := s.kv.List(ctx, pfx+"/")
+		if err != nil {
+			return KeyValue{}, sessionErr(s, err)
+		}
+		_, self, pred := head(kvs, key)
+		if self == nil {
+			return KeyValue{}, ErrSessionExpired
+		}
+		if pred == nil {
+			return *self, nil
+		}
+		if err := s.kv.Wait(ctx, pred.Key, false, rev); err != nil {
+			return KeyValue{}, sessionErr(s, err)
+		}
+	}
+}
+
+// sessionErr 会话已结束时返回 ErrSessionExpired，否则原样返回 err
+func sessionErr(s *Session, err error) error {
+	select {
+	case <-s.Done():
+		return ErrSessionExpired
+	default:
+		return err
+	}
+}
@@ -0,0 +1,117 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL 会话租约的默认存活时间
+const DefaultSessionTTL = 60 * time.Second
+
+// ErrSessionExpired 会话的租约已过期或被撤销，通过它持有的锁和领导权都已失效
+var ErrSessionExpired = errors.New("concurrency: session expired")
+
+// Session 持有一个租约，锁和选举中创建的键都绑定到它
+// 进程崩溃或与集群失联时租约过期，这些键随之被删除
+type Session struct {
+	kv    KV
+	lease int64
+	ttl   time.Duration
+	owned bool // 是否由会话授予并负责续期
+
+	cancel    context.CancelFunc
+	donec     chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSession 授予一个 ttl 的租约，并在后台按 ttl/3 的间隔续期，ttl 为 0 时使用 DefaultSessionTTL
+func NewSession(kv KV, ttl time.Duration) (*Session, error) {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	lease, err := kv.Grant(ctx, ttl)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &Session{
+		kv:     kv,
+		lease:  lease,
+		ttl:    ttl,
+		owned:  true,
+		cancel: cancel,
+		donec:  make(chan struct{}),
+	}
+	go s.keepAlive(ctx)
+	return s, nil
+}
+
+// ResumeSession 使用已有的租约创建会话，租约由调用方续期，Close 不会撤销它
+func ResumeSession(kv KV, lease int64) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		kv:     kv,
+		lease:  lease,
+		cancel: cancel,
+		donec:  make(chan struct{}),
+	}
+	go func() {
+		<-ctx.Done()
+		close(s.donec)
+	}()
+	return s
+}
+
+// keepAlive 定期续期租约，续期失败且超过一个 TTL 后认为会话已过期
+func (s *Session) keepAlive(ctx context.Context) {
+	defer close(s.donec)
+	ticker := time.NewTicker(s.ttl / 3)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.kv.KeepAlive(ctx, s.lease)
+			switch {
+			case err == nil:
+				last = time.Now()
+			case ctx.Err() != nil:
+				return
+			case time.Since(last) >= s.ttl:
+				return
+			}
+		}
+	}
+}
+
+// Lease 返回会话的租约 ID
+func (s *Session) Lease() int64 {
+	return s.lease
+}
+
+// Done 在会话关闭或续期失败时关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.donec
+}
+
+// Close 停止续期，会话自己授予的租约会被撤销
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.donec
+		if s.owned {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err = s.kv.Revoke(ctx, s.lease)
+		}
+	})
+	return err
+}
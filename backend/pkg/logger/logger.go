@@ -16,9 +16,10 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// 调用 InitLogger 之前（例如在测试中）日志被丢弃
 var (
-	logger *zap.Logger
-	sugar  *zap.SugaredLogger
+	logger = zap.NewNop()
+	sugar  = logger.Sugar()
 )
 
 // InitLogger 初始化日志系统
@@ -0,0 +1,52 @@
+import { AnimatePresence, motion } from 'framer-motion';
+import { useLanguage } from '@/contexts/language-context';
+import { useRaftLog } from '@/hooks/use-raft-log';
+import type { AppliedLogEntry } from '@/lib/raft-types';
+
+// 日志视图最多显示的条目数
+const MAX_ENTRIES = 20;
+
+// 过期删除的日志由 Leader 提议，单独高亮并列出被删除的键
+function describe(entry: AppliedLogEntry, expiredLabel: string) {
+  if (entry.op === 'expire') {
+    const keys = entry.expired ?? [];
+    return keys.length > 0 ? `${expiredLabel}: ${keys.join(', ')}` : expiredLabel;
+  }
+  return entry.key ?? '';
+}
+
+export default function LogView() {
+  const { t } = useLanguage();
+  const entries = useRaftLog(MAX_ENTRIES);
+
+  return (
+    <div className='relative w-full max-w-[800px] mx-auto px-4 pb-4'>
+      <h3 className='text-sm font-medium text-slate-300 mb-2'>{t('logViewTitle')}</h3>
+      <div className='h-48 overflow-y-auto rounded-lg bg-slate-900/60 border border-slate-700 font-mono text-xs'>
+        {entries.length === 0 && (
+          <div className='p-3 text-slate-500'>{t('logViewEmpty')}</div>
+        )}
+        <AnimatePresence initial={false}>
+          {entries.map((entry) => {
+            const expired = entry.op === 'expire';
+            return (
+              <motion.div
+                key={`${entry.term}-${entry.index}`}
+                initial={{ opacity: 0, y: -8 }}
+                animate={{ opacity: 1, y: 0 }}
+                className={`flex gap-3 px-3 py-1 border-b border-slate-800 ${
+                  expired ? 'text-amber-300 bg-amber-900/20' : 'text-slate-300'
+                }`}>
+                <span className='w-12 text-slate-500'>#{entry.index}</span>
+                <span className='w-10 text-slate-500'>T{entry.term}</span>
+                <span className={`w-24 ${expired ? 'text-amber-400' : 'text-emerald-400'}`}>{entry.op}</span>
+                <span className='flex-1 truncate'>{describe(entry, t('logViewExpired'))}</span>
+                {entry.error && <span className='text-red-400 truncate'>{entry.error}</span>}
+              </motion.div>
+            );
+          })}
+        </AnimatePresence>
+      </div>
+    </div>
+  );
+}
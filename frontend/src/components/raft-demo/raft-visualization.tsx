@@ -2,6 +2,7 @@ import { useEffect, useState } from 'react';
 import { motion, AnimatePresence } from 'framer-motion';
 import { useInterval } from '@/hooks/use-interval';
 import { RaftLayout } from '@/layout/raft-bg-layout';
+import LogView from './log-view';
 
 
 interface Node {
@@ -430,6 +431,9 @@ export default function RaftVisualization() {
             ))}
           </svg>
         </div>
+
+        {/* 后端应用的日志，包括过期删除 */}
+        <LogView />
       </div>
     </RaftLayout>
   );
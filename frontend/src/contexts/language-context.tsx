@@ -135,6 +135,19 @@ const translations: Translations = {
     en: 'Follower',
     zh: '跟随者',
   },
+  // 日志视图
+  logViewTitle: {
+    en: 'Applied Log',
+    zh: '已应用的日志',
+  },
+  logViewEmpty: {
+    en: 'Waiting for log entries...',
+    zh: '等待日志条目...',
+  },
+  logViewExpired: {
+    en: 'expired',
+    zh: '已过期',
+  },
 };
 
 interface LanguageContextType {
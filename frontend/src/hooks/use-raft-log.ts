@@ -0,0 +1,29 @@
+import { useEffect, useState } from 'react'
+import type { AppliedLogEntry } from '@/lib/raft-types'
+
+// 后端 WebSocket 地址，未配置时连接当前主机的 8080 端口
+function websocketURL() {
+  return process.env.NEXT_PUBLIC_WS_URL || `ws://${window.location.hostname}:8080/ws/connect`
+}
+
+// useRaftLog 订阅后端推送的 raft_log 消息，返回最近的 limit 条日志，新的在前
+export function useRaftLog(limit: number) {
+  const [entries, setEntries] = useState<AppliedLogEntry[]>([])
+
+  useEffect(() => {
+    const ws = new WebSocket(websocketURL())
+    ws.onmessage = (event) => {
+      let message
+      try {
+        message = JSON.parse(event.data)
+      } catch {
+        return // 忽略不是 JSON 的状态广播
+      }
+      if (message?.type !== 'raft_log') return
+      setEntries((prev) => [message.entry as AppliedLogEntry, ...prev].slice(0, limit))
+    }
+    return () => ws.close()
+  }, [limit])
+
+  return entries
+}
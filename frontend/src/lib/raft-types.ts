@@ -35,3 +35,14 @@ export function createInitialNode(id: number): RaftNode {
     lastApplied: 0,
   };
 }
+
+// 后端状态机应用的日志条目，由观察器通过 WebSocket 以 raft_log 消息推送
+export interface AppliedLogEntry {
+  index: number;
+  term: number;
+  timestamp: number; // 日志时间（Unix 毫秒）
+  op: string;
+  key?: string;
+  expired?: string[]; // expire 日志实际删除的键
+  error?: string;
+}